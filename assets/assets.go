@@ -70,7 +70,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _assetsDockerfile = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x53\xd1\x8e\xdb\x36\x10\x7c\xe7\x57\x0c\xec\x97\x04\x70\xe4\x4b\xfb\x50\x20\x0d\x82\x2a\x67\x39\x51\x73\x96\x0d\x59\xee\xc1\x08\x82\x82\x96\x56\x12\x7b\x32\x29\x90\x2b\x0b\xae\xa1\x7f\x2f\xa8\x73\x9a\x5e\x71\x6d\xde\xb4\xa3\x9d\xe1\x0c\x77\x39\x15\x53\x2c\x4c\xfe\x40\xb6\x54\x0d\x09\x5f\xde\x9a\xf6\x6c\x55\x55\x33\x5e\xe4\x2f\xf1\xc3\xcd\xeb\x9f\xf0\x6b\xa7\x5b\x52\xf8\x24\x7b\x79\x34\x6c\xc6\xb6\xac\x56\x0e\x9e\x04\xe5\xd0\x4a\xcb\x30\x25\x52\x23\x0b\x45\x08\xff\xec\x2c\x05\x63\xdb\x3f\x11\xdf\x59\x5a\x22\x38\x53\x72\x2f\x2d\xbd\xc1\xd9\x74\xc8\xa5\x86\xa5\x42\x39\xb6\xea\xd0\x31\x41\x31\xa4\x2e\xe6\xc6\xe2\x68\x0a\x55\x9e\xc5\xd4\x43\x9d\x2e\xc8\x82\x6b\x02\x93\x3d\x3a\x7f\x9c\x2f\x3e\x24\x3b\x7c\x20\x4d\x56\x36\xd8\x74\x87\x46\xe5\xb8\x53\x39\x69\x47\x90\x0e\xad\x47\x5c\x4d\x05\x0e\x5e\xc6\x13\x96\xde\xc1\xf6\xea\x00\x4b\xd3\xe9\x42\xb2\x32\x7a\x06\x52\x5c\x93\xc5\x89\xac\x53\x46\xe3\xc7\xaf\x47\x5c\xf5\x66\x30\x56\x4c\xf1\x42\xb2\xb7\x6d\x61\x5a\x4f\x7b\x09\xa9\xcf\x68\x24\x7f\x63\x3e\x9f\xfc\x5b\xc0\x02\x4a\x8f\xc2\xb5\x69\x09\x5c\x4b\xf6\xf9\x7a\xd5\x34\x38\x10\x3a\x47\x65\xd7\xcc\xc4\x14\x87\x8e\x71\x1f\x67\x1f\xd7\xbb\x0c\x61\xb2\xc7\x7d\x98\xa6\x61\x92\xed\x7f\x46\xaf\xb8\x36\x1d\x83\x4e\xf4\xa8\xa4\x8e\x6d\xa3\xa8\x40\x2f\xad\x95\x9a\xcf\x30\xa5\x98\x62\x15\xa5\xb7\x1f\xc3\x24\x0b\xdf\xc7\x77\x71\xb6\x87\xb1\x58\xc6\x59\x12\x6d\xb7\x58\xae\x53\x84\xd8\x84\x69\x16\xdf\xee\xee\xc2\x14\x9b\x5d\xba\x59\x6f\xa3\x00\xd8\x92\x37\x45\x62\xfa\x7f\x77\x5b\x8e\xd3\xb1\x84\x82\x58\xaa\xc6\x3d\x66\xde\x9b\x0e\xae\x36\x5d\x53\xa0\x96\x27\x82\xa5\x9c\xd4\x89\x0a\x48\xe4\xa6\x3d\x7f\x7f\x66\x62\x0a\xd9\x18\x5d\x8d\x09\x9f\xae\x13\xe2\x12\xda\xf0\x0c\x8e\x08\x6f\x6b\xe6\xf6\xcd\x7c\xde\xf7\x7d\x50\xe9\x2e\x30\xb6\x9a\x37\x8f\x12\x6e\xfe\xce\x9b\xf9\xba\xa2\x4c\xc7\xd6\x4f\xc7\x8f\x40\xa2\xf8\x7b\xd7\xd1\xd7\x2a\xaf\xa1\xb4\x63\xd9\x34\x0e\xb2\x65\xb4\x32\x7f\x90\x15\x8d\x61\x96\xe9\x7a\x85\xcb\x25\x88\x8f\xb2\xa2\x61\x10\xab\x30\x4e\xb2\x30\x4e\xa2\xf4\xdf\xcf\x01\x6f\x1f\xae\x5f\xc1\x1f\xe3\x9f\x5f\xaa\xa3\x54\x4d\x90\x9b\xe3\x3b\x21\xa2\xe4\x37\x64\x51\xba\xc2\x89\x5f\xdf\xdc\x8c\xe5\x22\x7a\x1f\x87\xc9\xef\xcb\x74\x9d\x64\x51\xb2\x80\x36\x5a\x69\x26\x2b\x73\x56\x27\x12\x22\xdd\x25\xde\xce\xab\x8a\x18\x5d\x5b\x48\xa6\x27\xd0\xd5\x32\x5e\x9d\x47\xa8\x63\xd5\x38\x54\x8a\xc5\xe5\x62\xa5\xae\x08\x41\xb8\xc9\x86\xe1\xbf\x38\x97\x4b\x30\x0c\xe2\x72\x21\x5d\x0c\x83\x10\xf7\xeb\xf4\xd3\x22\x4e\x31\x2f\x24\x4b\x11\x2e\x16\x08\xec\x78\xed\x73\xd2\x6c\xcf\xad\x51\x9a\x03\x57\x63\x6e\x8d\xe1\xa7\x98\x88\x92\x2c\xdd\x6f\xd6\x71\x92\xe1\xf3\xe4\x20\x5d\x3d\x99\x61\xf2\x4c\xe3\xe4\x8b\xb8\x5d\x2d\xf0\x79\x32\xf9\x22\xfe\x0a\x00\x00\xff\xff\x2e\xf9\x92\xed\x72\x04\x00\x00")
+var _assetsDockerfile = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x53\xd1\x8e\xdb\x36\x10\x7c\xe7\x57\x0c\xec\x97\x04\x70\xe4\x4b\xfb\x50\x20\x0d\x82\x2a\x67\x39\x51\x73\x96\x0d\x59\xee\xc1\x08\x82\x82\x96\x56\x12\x7b\x32\x29\x90\x2b\x0b\xae\xa1\x7f\x2f\xa8\x73\x9a\x5e\x71\x6d\xde\xb4\xa3\x9d\xe5\xcc\x0e\x39\x15\x53\x2c\x4c\xfe\x40\xb6\x54\x0d\x09\x5f\xde\x9a\xf6\x6c\x55\x55\x33\x5e\xe4\x2f\xf1\xc3\xcd\xeb\x9f\xf0\x6b\xa7\x5b\x52\xf8\x24\x7b\x79\x34\x6c\xc6\xb6\xac\x56\x0e\x9e\x04\xe5\xd0\x4a\xcb\x30\x25\x52\x23\x0b\x45\x08\xff\xec\x2c\x05\x63\xdb\x3f\x11\xdf\x59\x5a\x22\x38\x53\x72\x2f\x2d\xbd\xc1\xd9\x74\xc8\xa5\x86\xa5\x42\x39\xb6\xea\xd0\x31\x41\x31\xa4\x2e\xe6\xc6\xe2\x68\x0a\x55\x9e\xc5\xd4\x43\x9d\x2e\xc8\x82\x6b\x02\x93\x3d\x3a\x7f\x9c\x2f\x3e\x24\x3b\x7c\x20\x4d\x56\x36\xd8\x74\x87\x46\xe5\xb8\x53\x39\x69\x47\x90\x0e\xad\x47\x5c\x4d\x05\x0e\x7e\x8c\x27\x2c\xbd\x82\xed\x55\x01\x96\xa6\xd3\x85\x64\x65\xf4\x0c\xa4\xb8\x26\x8b\x13\x59\xa7\x8c\xc6\x8f\x5f\x8f\xb8\xce\x9b\xc1\x58\x31\xc5\x0b\xc9\x5e\xb6\x85\x69\x3d\xed\x25\xa4\x3e\xa3\x91\xfc\x8d\xf9\xbc\xf3\x6f\x06\x0b\x28\x3d\x1a\xa9\x4d\x4b\xe0\x5a\xb2\xf7\xd7\xab\xa6\xc1\x81\xd0\x39\x2a\xbb\x66\x26\xa6\x38\x74\x8c\xfb\x38\xfb\xb8\xde\x65\x08\x93\x3d\xee\xc3\x34\x0d\x93\x6c\xff\x33\x7a\xc5\xb5\xe9\x18\x74\xa2\xc7\x49\xea\xd8\x36\x8a\x0a\xf4\xd2\x5a\xa9\xf9\x0c\x53\x8a\x29\x56\x51\x7a\xfb\x31\x4c\xb2\xf0\x7d\x7c\x17\x67\x7b\x18\x8b\x65\x9c\x25\xd1\x76\x8b\xe5\x3a\x45\x88\x4d\x98\x66\xf1\xed\xee\x2e\x4c\xb1\xd9\xa5\x9b\xf5\x36\x0a\x80\x2d\x79\x51\x24\xa6\xff\xb7\xdb\x72\x4c\xc7\x12\x0a\x62\xa9\x1a\xf7\xe8\x79\x6f\x3a\xb8\xda\x74\x4d\x81\x5a\x9e\x08\x96\x72\x52\x27\x2a\x20\x91\x9b\xf6\xfc\xfd\xcc\xc4\x14\xb2\x31\xba\x1a\x1d\x3e\x59\x61\x80\xb8\x84\x36\x3c\x83\x23\xc2\xdb\x9a\xb9\x7d\x33\x9f\xf7\x7d\x1f\x54\xba\x0b\x8c\xad\xe6\xcd\x63\x4c\x6e\xfe\xce\x8b\xf9\x7a\x45\x99\x8e\xad\x4f\xc7\x47\x20\x51\xfc\x7d\xd7\xd1\xd7\x2a\xaf\xa1\xb4\x63\xd9\x34\x0e\xb2\x65\xb4\x32\x7f\x90\x15\x8d\x66\x96\xe9\x7a\x85\xcb\x25\x88\x8f\xb2\xa2\x61\x10\xab\x30\x4e\xb2\x30\x4e\xa2\xf4\xdf\xcf\x01\x6f\x1f\xae\x5f\xc1\x1f\xe3\x9f\x5f\xaa\xa3\x54\x4d\x90\x9b\xe3\x3b\x21\xa2\xe4\x37\x64\x51\xba\xc2\x89\x5f\xdf\xdc\x8c\xe5\x22\x7a\x1f\x87\xc9\xef\xcb\x74\x9d\x64\x51\xb2\x80\x36\x5a\x69\x26\x2b\x73\x56\x27\x12\x22\xdd\x25\x5e\xce\xab\x8a\x18\x5d\x5b\x48\xa6\x27\xd0\x55\x32\x5e\x9d\x47\xa8\x63\xd5\x38\x54\x8a\xc5\xe5\x62\xa5\xae\x08\x41\xb8\xc9\x86\xe1\xbf\x38\x97\x4b\x30\x0c\xe2\x72\x21\x5d\x0c\x83\x10\xf7\xeb\xf4\xd3\x22\x4e\x31\x2f\x24\x4b\x11\x2e\x16\x08\xec\xb8\xf6\x39\x69\xb6\xe7\xd6\x28\xcd\x81\xab\x31\x7f\x0e\x15\x51\x92\xa5\xfb\xcd\x3a\x4e\x32\x7c\x9e\x1c\xa4\xab\x27\x33\x4c\x9e\x6d\x9d\x7c\x11\xb7\xab\x05\x3e\x4f\x26\x5f\xc4\x5f\x03\x00\x2c\xe8\xfa\xfc\x76\x04\x00\x00")
 
 func assetsDockerfileBytes() ([]byte, error) {
 	return bindataRead(
@@ -90,7 +90,7 @@ func assetsDockerfile() (*asset, error) {
 	return a, nil
 }
 
-var _assetsEntrypointSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\x52\xd1\x8e\xdb\x36\x10\x7c\xe7\x57\x4c\x22\x3f\x24\x80\x2b\xa5\xed\x43\x81\x4b\x2f\xa8\x6a\x9c\x13\xb7\xae\xcf\x90\x65\x04\x46\x10\x14\xb4\xb8\xb2\x88\xca\xa4\x40\x2e\x2d\xbb\x82\xfe\xbd\xa0\x7d\x87\xa4\x40\xd1\x3c\x72\x31\x3b\x3b\xc3\x99\xe4\x45\xb6\xd7\x26\xdb\x4b\xdf\x88\x44\x24\x20\xc3\xee\xd2\x59\x6d\x38\x7d\x9a\xcc\x6c\x77\x71\xfa\xd0\x30\x5e\x55\xaf\xf1\xc3\x9b\xef\x7f\xc2\x6f\xc1\x74\xa4\xf1\xbb\xec\xe5\xd1\xb2\xbd\xc2\xca\x46\x7b\xd4\xba\x25\x68\x8f\x4e\x3a\x86\xad\x51\x58\xa9\x34\x21\xff\x3b\x38\x4a\xaf\xb0\xaf\x27\x11\x59\x3b\x22\x78\x5b\x73\x2f\x1d\xdd\xe1\x62\x03\x2a\x69\xe0\x48\x69\xcf\x4e\xef\x03\x13\x34\x43\x1a\x95\x59\x87\xa3\x55\xba\xbe\x88\x24\x8e\x82\x51\xe4\xc0\x0d\x81\xc9\x1d\x7d\x3c\x17\x1f\xef\x57\x5b\xbc\x27\x43\x4e\xb6\x58\x87\x7d\xab\x2b\x2c\x75\x45\xc6\x13\xa4\x47\x17\x27\xbe\x21\x85\x7d\xa4\x89\x0b\xf3\xa8\x60\xf3\xa4\x00\x73\x1b\x8c\x92\xac\xad\x99\x82\x34\x37\xe4\x70\x22\xe7\xb5\x35\xf8\xf1\xf9\xc4\x13\xdf\x14\xd6\x89\x04\xaf\x24\x47\xd9\x0e\xb6\x8b\x6b\xaf\x21\xcd\x05\xad\xe4\x2f\x9b\xff\xed\xfc\x8b\x41\x05\x6d\xae\xc4\x8d\xed\x08\xdc\x48\x8e\xfe\x7a\xdd\xb6\xd8\x13\x82\xa7\x3a\xb4\x53\x91\x60\x1f\x18\x1f\x17\xe5\x87\xc7\x6d\x89\x7c\xb5\xc3\xc7\xbc\x28\xf2\x55\xb9\x7b\x8b\x5e\x73\x63\x03\x83\x4e\x74\x63\xd2\xc7\xae\xd5\xa4\xd0\x4b\xe7\xa4\xe1\x0b\x6c\x2d\x12\xfc\xf1\x50\xcc\x3e\xe4\xab\x32\xff\x75\xb1\x5c\x94\x3b\x58\x87\xf9\xa2\x5c\x3d\x6c\x36\x98\x3f\x16\xc8\xb1\xce\x8b\x72\x31\xdb\x2e\xf3\x02\xeb\x6d\xb1\x7e\xdc\x3c\xa4\xc0\x86\xa2\x28\x12\xc9\xff\xfd\x6d\x7d\x4d\xc7\x11\x14\xb1\xd4\xad\xbf\x79\xde\xd9\x00\xdf\xd8\xd0\x2a\x34\xf2\x44\x70\x54\x91\x3e\x91\x82\x44\x65\xbb\xcb\xb7\x33\x13\x09\x64\x6b\xcd\xe1\xea\xf0\xdf\x75\xc2\xa2\x86\xb1\x3c\x85\x27\xc2\xcf\x0d\x73\x77\x97\x65\x7d\xdf\xa7\x07\x13\x52\xeb\x0e\x59\x7b\xa3\xf0\xd9\xbb\x28\xe6\xb9\xa2\x4c\xc7\x2e\xa6\x13\x23\x90\xe6\xab\xbe\x47\x31\x12\xca\x56\x7f\x91\x43\x65\x0d\x4b\x6d\x62\xc1\x2c\xe8\x4c\x55\xec\xa1\x0b\x06\x9e\xa9\xbb\x9a\xd3\x35\x3e\x7d\xc2\x24\xc1\x8b\x7b\xbc\xc1\xe7\xcf\x6f\xa3\x13\x23\x70\x45\x63\xf2\x8b\xa8\xb5\x10\x74\xee\xac\x63\x2c\x67\x7f\xe6\xcb\xe5\xfd\x4c\x0c\x83\x93\xe6\x40\x98\x68\xa3\xe8\x3c\xc5\x84\x5a\x3a\x92\x61\x8f\xbb\x7b\xa4\x45\x30\xe3\x28\xa8\x6a\x2c\x5e\x0e\x43\x3a\x8e\x2f\x85\x6f\xf0\x5d\xf5\xfc\xc2\x3b\x64\x7c\xec\x32\xcf\xca\x06\x1e\x86\x1b\xcb\x38\xa6\x7c\x66\x31\x0c\x64\xd4\x38\x8a\x7f\x02\x00\x00\xff\xff\x32\xb6\xf1\x27\xd1\x03\x00\x00")
+var _assetsEntrypointSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x56\x6b\x4f\xdb\xca\x16\xfd\x3e\xbf\x62\x35\x8e\x50\x2b\x11\x07\x68\xa5\x2b\xc1\x0d\xf7\xe6\x52\x28\xb9\x87\x42\x94\x04\x55\xa8\xaa\xd0\xc4\xde\x8e\x47\x38\x33\xd6\xcc\x98\x90\x63\xe5\xbf\x1f\x6d\xdb\x79\x40\x38\x8f\x2f\x28\x99\x99\xfd\x5a\x6b\xed\x45\x82\x0f\xdd\xa9\xd2\xdd\xa9\x74\xa9\x08\x44\x00\xd2\xde\x2e\x73\xa3\xb4\x0f\x9b\x93\x0b\x93\x2f\xad\x9a\xa5\x1e\x1f\xa3\x4f\x38\x39\x3a\xfe\x17\xfe\x5f\xe8\x9c\x14\x7e\x93\x0b\x39\x37\xde\x54\xcf\x26\xa9\x72\x48\x54\x46\x50\x0e\xb9\xb4\x1e\x26\xc1\xc8\xc8\x58\x11\xfa\xbf\x17\x96\xc2\xea\xd9\xee\x09\xbf\x4c\x2c\x11\x9c\x49\xfc\x42\x5a\x3a\xc5\xd2\x14\x88\xa4\x86\xa5\x58\x39\x6f\xd5\xb4\xf0\x04\xe5\x21\x75\xdc\x35\x16\x73\x13\xab\x64\x29\x02\x3e\x2a\x74\x4c\x16\x3e\x25\x78\xb2\x73\xc7\xe5\xf8\xcb\xb7\xdb\x7b\x7c\x23\x4d\x56\x66\x18\x16\xd3\x4c\x45\xb8\x51\x11\x69\x47\x90\x0e\x39\x9f\xb8\x94\x62\x4c\x39\x0d\x07\x5c\x71\x07\xe3\xa6\x03\x5c\x99\x42\xc7\xd2\x2b\xa3\x0f\x41\xca\xa7\x64\xf1\x4c\xd6\x29\xa3\xf1\x79\x5d\xa2\xc9\x77\x08\x63\x45\x80\x8f\xd2\x73\xdb\x16\x26\xe7\xb0\x4f\x90\x7a\x89\x4c\xfa\x6d\xe4\xfb\x93\x6f\x07\x8c\xa1\x74\x35\x48\x6a\x72\x82\x4f\xa5\xe7\xf9\x16\x2a\xcb\x30\x25\x14\x8e\x92\x22\x3b\x14\x01\xa6\x85\xc7\x8f\xc1\xe4\xfa\xee\x7e\x82\xfe\xed\x03\x7e\xf4\x47\xa3\xfe\xed\xe4\xe1\x0c\x0b\xe5\x53\x53\x78\xd0\x33\xd5\x99\xd4\x3c\xcf\x14\xc5\x58\x48\x6b\xa5\xf6\x4b\x98\x44\x04\xf8\x7e\x39\xba\xb8\xee\xdf\x4e\xfa\xff\x1b\xdc\x0c\x26\x0f\x30\x16\x57\x83\xc9\xed\xe5\x78\x8c\xab\xbb\x11\xfa\x18\xf6\x47\x93\xc1\xc5\xfd\x4d\x7f\x84\xe1\xfd\x68\x78\x37\xbe\x0c\x81\x31\x71\x53\x24\x82\xbf\xc2\x36\xa9\xd8\xb1\x84\x98\xbc\x54\x99\xab\x67\x7e\x30\x05\x5c\x6a\x8a\x2c\x46\x2a\x9f\x09\x96\x22\x52\xcf\x14\x43\x22\x32\xf9\xf2\xef\x39\x13\x01\x64\x66\xf4\xac\x9a\xf0\x15\x84\x21\x06\x09\xb4\xf1\x87\x70\x44\xf8\x77\xea\x7d\x7e\xda\xed\x2e\x16\x8b\x70\xa6\x8b\xd0\xd8\x59\x37\xab\x69\x72\xdd\x73\x6e\x66\x2d\x51\x4f\xf3\x9c\xd9\x61\x0a\xa4\xde\xd1\x3b\x37\x23\x11\x9b\xe8\x89\x2c\x22\xa3\xbd\x54\x9a\x05\x66\x40\x2f\x14\xb1\x0e\x6d\xa1\xe1\x3c\xe5\xd5\x70\x2a\xc1\xcf\x9f\x68\x07\xf8\xd0\xc3\x11\x7e\xfd\x3a\xe3\x49\xb4\x40\xf5\x1a\xed\xff\x8a\x44\x09\x41\x2f\xb9\xb1\x1e\x37\x17\x8f\xfd\x9b\x9b\xde\x85\x10\x01\xae\x8c\x5d\x48\x1b\x57\xa2\x55\xba\x52\x1a\x9c\x9a\x69\x99\x39\xae\xc5\xe4\xd9\x42\x6b\xa5\x67\x55\x2d\x38\xa5\x23\x02\xef\xe7\xe6\x5c\x3a\x0c\x07\x5f\x71\xcc\x7b\x30\xd3\xc6\x92\xe3\xda\x73\x4c\x97\x88\x29\x91\x45\xe6\x43\x11\xa5\x2a\x8b\x7b\x47\x62\x5d\x86\x3e\x7e\x42\xc9\xdd\x45\xa9\x41\x6b\xb4\xe5\x61\xbf\x8f\x16\xce\x0f\x4e\x04\xd0\x4c\x58\x65\xda\x9b\x12\x78\x62\x7d\x76\x26\x97\xa3\xef\xeb\x37\x27\xe7\xdd\x98\x9e\xbb\xba\xc8\xb2\xea\xc5\x42\x2a\xdf\xdc\x09\x20\x51\x5c\xfe\x45\x79\x1c\x7f\xf9\x2c\x56\xc2\x5b\x99\x6f\xaa\x13\xaa\x44\x83\xdb\xc9\x2e\x46\xa6\xda\xbf\x06\x9d\x43\x50\x38\x0b\x61\x34\xc1\x91\xf6\x98\x52\x62\x2c\x41\x6a\xd0\xb3\x8a\x18\xc7\xc3\xf7\x00\x14\x01\x9c\xd9\x2c\x15\x7b\x8b\x63\x25\x2a\xef\xe0\xbc\xf4\x14\x8a\xa4\x66\xa4\x01\xe8\x1f\x4d\xdd\x3e\x7e\x7f\xe6\x44\xad\x07\x6b\x35\x59\x71\x3f\x1e\x1d\xb7\xaa\xbf\xfb\x17\x27\xd5\xc5\xc9\x9b\x8b\xeb\xfb\x61\x0b\xd7\xf7\x43\x21\x02\x8c\x59\x6e\xeb\x51\x47\x77\xfd\xaf\x83\xcb\xc7\xab\xc1\x68\x3c\x79\x1c\x4f\x2e\x87\x48\x94\xae\xdd\x4c\x69\x06\x42\x69\x4f\xd6\x16\x39\x5b\x0a\xcb\xb0\x60\x54\xd8\x3b\x59\x1f\x8a\xcd\xca\xf9\x98\x7d\x82\x7d\xda\x81\xfd\xee\x89\x72\x1f\x8a\x44\x59\xe7\x7b\xed\x72\xaf\xc2\x69\xe7\x68\x55\xaf\x0e\xed\xec\x04\xbd\x30\x7c\xd5\x4a\x32\xdc\x8c\x63\xb1\x31\xe0\x2a\x17\x12\xa9\x32\x8a\x6b\x09\x57\xae\xa4\x92\xc6\x44\x12\x93\x65\x66\xb1\xa6\xc7\xc1\x15\x51\x44\x14\x87\xa2\x0e\xe9\x1d\x35\x1f\x1e\xf9\xba\x27\xbc\x9a\x53\xfc\x68\x0a\xdf\x13\x65\x69\xa5\x9e\x11\xda\x4a\xc7\xf4\x72\x88\x36\x65\x34\x27\xed\x1d\x4e\x7b\x08\x47\x85\x5e\xad\x44\x4d\x5f\x59\xd6\x6f\x56\x2b\x74\x32\x8f\x76\xdd\xd3\x0e\x91\xf5\x1a\x8c\x9f\x54\x9e\xaf\x3b\xd9\x0d\x5a\xa4\x2a\x4a\x91\x4a\xb7\x41\xb8\x25\x28\x73\xb4\x89\x0c\x02\x5b\x79\x51\x87\x23\x3b\x53\x9a\x29\xbd\x13\xdf\xda\xbc\x2b\xcb\xb0\xfe\x5a\x96\x2a\x41\x3b\x64\x3e\x27\x6a\x4e\xa6\xf0\xab\x15\x8f\xc6\x6c\x94\xe5\xab\x8b\x70\x4c\x91\xd1\xb1\x5b\xad\x50\x96\xa4\xe3\xd5\xca\xa5\xe8\x44\xeb\x64\x38\x47\xb7\x2e\xde\xb5\xe4\x8a\xcc\xbb\x6e\xcd\xea\xb6\x7e\xe8\x5f\x3c\x0e\x04\x50\x69\xb4\xd7\xfe\x20\xde\x2e\x63\x4d\x59\xaf\xfd\x1f\x01\x04\xf5\x9d\x25\x5f\x58\xed\xb0\x48\x49\x43\xa2\x51\x23\x73\x58\xed\x1f\xfb\xe5\xda\xbe\xcf\xf0\x44\x94\x57\x61\x8c\x5e\xad\x01\xca\x43\x2e\x93\xf2\x4f\x80\xda\x1b\x8e\xde\x59\x92\x33\xc4\xe6\x1d\x73\x78\xdd\x51\x6c\x34\x6d\xba\x3f\xfa\x13\xd0\x49\xc7\xbb\x94\xb5\xeb\x04\xad\xed\x0a\x37\xb2\xac\x9c\xeb\xe0\x00\xed\x46\x92\xbd\xbd\x9d\x6e\x84\xd7\x64\xd8\x39\xaa\x25\xb8\x2d\x52\xbb\x58\x59\x76\xb0\x4f\xe6\x5e\xdd\x5e\x0f\xc7\x27\x5f\x5e\x57\x6a\x64\xf7\x46\x6d\xac\x83\x18\xac\x04\x99\xf0\xcf\x86\x37\x7a\x58\xad\xd6\x8e\x0c\x6c\xb7\xa1\xd5\xde\x7c\xde\xc9\xd5\xda\xb6\x58\x29\x87\xff\x0b\x35\x22\x6a\x56\xa3\xa3\xb1\x13\xb9\xbf\x12\x95\xe1\x6c\x3a\x3a\xdd\xbe\xad\x9b\x48\x54\x93\x67\x0d\xe7\x5b\x8b\xdc\x19\xb1\x79\x52\xa1\xb8\x36\x84\xca\x34\x1a\x84\x9a\xfb\x4d\x62\xb6\x15\xb4\x13\xa9\x32\x8a\xc5\x1f\x03\x00\xdc\x64\xfe\xd5\x99\x0a\x00\x00")
 
 func assetsEntrypointShBytes() ([]byte, error) {
 	return bindataRead(
@@ -110,7 +110,7 @@ func assetsEntrypointSh() (*asset, error) {
 	return a, nil
 }
 
-var _assetsInitSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x52\x5d\x6f\xe4\x44\x10\x7c\xf7\xaf\x28\x6e\x79\x48\xa4\x78\xcd\x97\x40\x0a\x1f\x92\x89\x92\xbb\x85\xb0\x89\xf6\x43\xa7\x08\x10\x6a\x7b\xda\xeb\xd1\xcd\x4e\x5b\x33\x3d\x31\x46\xfc\x78\x34\xde\xbd\x3b\x90\x10\xdc\xdb\x4c\x4d\x77\x75\xd5\x74\x2d\x3e\xaa\x1a\xeb\xab\x86\x62\x5f\x2c\x8a\x05\xac\xb7\xba\x3c\x9f\x6f\x64\x98\x82\x3d\xf4\x8a\x8b\xf6\x12\x9f\x7d\xf2\xe9\x57\xf8\x21\xf9\x81\x2d\x7e\xa4\x91\x8e\xa2\x32\x97\xed\x7a\x1b\xd1\x59\xc7\xb0\x11\x03\x05\x85\x74\xd8\x08\x19\xcb\xa8\xff\x48\x81\x97\x73\xd9\xdf\x91\x5c\xd9\x05\x66\x44\xe9\x74\xa4\xc0\xd7\x98\x24\xa1\x25\x8f\xc0\xc6\x46\x0d\xb6\x49\xca\xb0\x0a\xf2\xa6\x92\x80\xa3\x18\xdb\x4d\x59\xa0\x22\x79\xc3\x01\xda\x33\x94\xc3\x31\xe6\x71\xf9\xf2\x72\xbd\xc7\x4b\xf6\x1c\xc8\xe1\x31\x35\xce\xb6\xb8\xb7\x2d\xfb\xc8\xa0\x88\x21\x23\xb1\x67\x83\x26\xd3\xe4\x86\xbb\xac\x60\x7b\x56\x80\x3b\x49\xde\x90\x5a\xf1\x57\x60\xab\x3d\x07\x3c\x73\x88\x56\x3c\x3e\x7f\x3b\xe2\xcc\x77\x05\x09\xc5\x02\x17\xa4\x59\x76\x80\x0c\xb9\xed\x12\xe4\x27\x38\xd2\xf7\x9d\xff\xee\xfc\xbd\x41\x03\xeb\x67\xe2\x5e\x06\x86\xf6\xa4\xd9\xdf\x68\x9d\x43\xc3\x48\x91\xbb\xe4\xae\x8a\x05\x9a\xa4\x78\xbd\xda\xbd\x7a\xd8\xef\x50\xaf\x9f\xf0\xba\xde\x6c\xea\xf5\xee\xe9\x6b\x8c\x56\x7b\x49\x0a\x7e\xe6\x13\x93\x3d\x0e\xce\xb2\xc1\x48\x21\x90\xd7\x09\xd2\x15\x0b\xfc\x74\xbb\xb9\x79\x55\xaf\x77\xf5\xf7\xab\xfb\xd5\xee\x09\x12\x70\xb7\xda\xad\x6f\xb7\x5b\xdc\x3d\x6c\x50\xe3\xb1\xde\xec\x56\x37\xfb\xfb\x7a\x83\xc7\xfd\xe6\xf1\x61\x7b\xbb\x04\xb6\x9c\x45\x71\xb1\xf8\xaf\xbf\xed\xe6\xed\x04\x86\x61\x25\xeb\xe2\xc9\xf3\x93\x24\xc4\x5e\x92\x33\xe8\xe9\x99\x11\xb8\x65\xfb\xcc\x06\x84\x56\x86\xe9\xff\x77\x56\x2c\x40\x4e\xfc\x61\x76\xf8\xcf\x38\x61\xd5\xc1\x8b\x5e\x21\x32\xe3\x9b\x5e\x75\xb8\xae\xaa\x71\x1c\x97\x07\x9f\x96\x12\x0e\x95\x3b\x51\xc4\xea\xbb\x2c\xe6\x6d\x44\x63\x1b\xec\xa0\xb0\x3e\x2a\x39\x17\x61\xa4\x7d\x93\x73\x24\x20\xec\x9b\xe4\x35\xc1\x8b\x99\xd3\x1a\x59\x51\x72\x51\xd0\xa0\xe5\x81\x15\x69\x30\xa4\xfc\xee\x7a\xa6\x40\x39\x21\x43\x1a\xc8\xc7\x41\x82\x96\x59\x4b\x44\x4b\x65\xcb\x41\x6d\x67\x5b\x52\x8e\x68\x53\x70\xef\x92\x5e\x0e\x41\x86\xfc\xca\xb1\x6c\xe5\x78\x14\x5f\xcc\xef\x65\x17\xb7\xf7\x98\x09\xae\xab\xca\xc8\xe8\x9d\x90\x59\x9e\x44\x2e\x5b\x39\x56\xce\xfa\xf4\x7b\x95\x66\xa5\xd5\x61\x38\xe0\xcf\x79\xfa\x1b\x9e\x40\xc6\xa0\x2c\x0a\x32\xa6\xcc\x50\xe0\x41\xa2\x55\x09\x13\x7e\x29\x80\x17\x86\x1b\xfc\x4c\xa1\xed\xbf\xa5\xa3\xf9\xf2\x8b\x5f\x3f\x78\xcc\xdc\xfe\xf1\x85\x8b\xcd\x6f\x81\x1d\x53\x64\x94\x6d\xbc\x9c\xe1\xa8\xd4\x38\x7e\xf1\x01\x7f\x74\x22\x2f\x5b\x2e\xfe\x0a\x00\x00\xff\xff\x24\xa7\x03\xff\x6e\x04\x00\x00")
+var _assetsInitSh = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x52\x5d\x6f\x24\x35\x10\x7c\x9f\x5f\x51\xdc\xf2\x70\x91\x32\x3b\x7c\x09\xa4\xf0\x21\x2d\x51\x72\xb7\x10\x36\xd1\x7e\xe8\x14\x01\x42\x3d\x76\xcf\x8e\x15\xaf\x7b\x64\xb7\x33\x0c\xe2\xc7\x23\x4f\x72\x77\x20\x21\xb8\x37\xbb\xba\xbb\xba\xaa\xbb\x17\x1f\x35\xad\x0b\x4d\x4b\xa9\xaf\x16\xd5\x02\x2e\x38\x5d\x3e\xbf\x2f\x65\x98\xa2\x3b\xf6\x8a\x97\xe6\x0c\x9f\x7d\xf2\xe9\x57\xf8\x21\x87\x81\x1d\x7e\xa4\x91\x4e\xa2\x32\xa7\xed\x7b\x97\xd0\x39\xcf\x70\x09\x03\x45\x85\x74\xd8\x0a\x59\xc7\x58\xfd\x91\x23\x2f\xe7\xb4\xbf\x23\x25\xb3\x8b\xcc\x48\xd2\xe9\x48\x91\x2f\x30\x49\x86\xa1\x80\xc8\xd6\x25\x8d\xae\xcd\xca\x70\x0a\x0a\xb6\x91\x88\x93\x58\xd7\x4d\x45\xa0\x22\x07\xcb\x11\xda\x33\x94\xe3\x29\x95\x76\xe5\xf3\x6a\x73\xc0\x2b\x0e\x1c\xc9\xe3\x2e\xb7\xde\x19\xdc\x38\xc3\x21\x31\x28\x61\x28\x48\xea\xd9\xa2\x2d\x34\xa5\xe0\xba\x28\xd8\x3d\x2b\xc0\xb5\xe4\x60\x49\x9d\x84\x73\xb0\xd3\x9e\x23\x1e\x39\x26\x27\x01\x9f\xbf\x6d\xf1\xcc\x77\x0e\x89\xd5\x02\x2f\x49\x8b\xec\x08\x19\x4a\xd9\x19\x28\x4c\xf0\xa4\xef\x2b\xff\xdd\xf9\x7b\x83\x16\x2e\xcc\x46\x7a\x19\x18\xda\x93\x16\x7f\xa3\xf3\x1e\x2d\x23\x27\xee\xb2\x3f\xaf\x16\x68\xb3\xe2\xcd\x7a\xff\xfa\xf6\xb0\xc7\x6a\x73\x8f\x37\xab\xed\x76\xb5\xd9\xdf\x7f\x8d\xd1\x69\x2f\x59\xc1\x8f\xfc\xc4\xe4\x4e\x83\x77\x6c\x31\x52\x8c\x14\x74\x82\x74\xd5\x02\x3f\x5d\x6d\x2f\x5f\xaf\x36\xfb\xd5\xf7\xeb\x9b\xf5\xfe\x1e\x12\x71\xbd\xde\x6f\xae\x76\x3b\x5c\xdf\x6e\xb1\xc2\xdd\x6a\xbb\x5f\x5f\x1e\x6e\x56\x5b\xdc\x1d\xb6\x77\xb7\xbb\xab\x25\xb0\xe3\x22\x8a\xab\xc5\x7f\xcd\xb6\x9b\xb7\x13\x19\x96\x95\x9c\x4f\x4f\x9e\xef\x25\x23\xf5\x92\xbd\x45\x4f\x8f\x8c\xc8\x86\xdd\x23\x5b\x10\x8c\x0c\xd3\xff\xef\xac\x5a\x80\xbc\x84\xe3\xec\xf0\x1f\x23\x5c\x62\xdd\x21\x88\x9e\x23\x31\xe3\x9b\x5e\x75\xb8\x68\x9a\x71\x1c\x97\xc7\x90\x97\x12\x8f\x8d\x7f\x5a\x53\x6a\xbe\x2b\x62\xde\x9e\x68\x32\xd1\x0d\x0a\x17\x92\x92\xf7\x09\x56\xcc\x43\xb9\x23\x01\xe1\xd0\xe6\xa0\x19\x41\xec\x7c\xad\x89\x15\x35\x57\x15\x0d\x5a\x1f\x59\x91\x07\x4b\xca\xef\xbe\xcf\x14\xa8\x27\x14\x48\x23\x85\x34\x48\xd4\xba\x68\x49\x30\x54\x1b\x8e\xea\x3a\x67\x48\x39\xc1\xe4\xe8\xdf\x5d\x7a\x3d\x44\x19\x4a\x94\x53\x6d\xe4\x74\x92\x50\xcd\xf1\xba\x4b\xbb\x1b\xcc\x04\x17\x4d\x63\x65\x0c\x5e\xc8\x2e\x9f\x44\x2e\x8d\x9c\x1a\xef\x42\xfe\xbd\xc9\xb3\xd2\xe6\x38\x1c\xf1\xe7\xdc\xfd\x81\x27\x90\xb5\xa8\xab\x8a\xac\xad\x0b\x14\x79\x90\xe4\x54\xe2\x84\x5f\x2a\xe0\x85\xe5\x16\x3f\x53\x34\xfd\xb7\x74\xb2\x5f\x7e\xf1\xeb\x07\xb7\x99\xcb\x3f\x7e\xe9\x53\xfb\x5b\x64\xcf\x94\x18\xb5\x49\x67\x33\x9c\x94\x5a\xcf\x2f\x3e\x60\x46\x56\xcc\x03\xc7\xda\x70\xf5\xd7\x00\x24\xa7\x03\xff\x6e\x04\x00\x00")
 
 func assetsInitShBytes() ([]byte, error) {
 	return bindataRead(
@@ -27,7 +27,73 @@ if [[ $# != 0 ]]; then
 fi
 
 export LC_ALL=C
+
+# Forward termination signals to the running step since bash running as PID 1
+# ignores them by default.
+child=0
+terminate() {
+  echo "Received a termination signal" >&2
+  if [[ $child != 0 ]]; then
+    kill -TERM $child 2>/dev/null
+    wait $child
+  fi
+  exit 143
+}
+trap terminate TERM INT
+
+# Forward other signals, e.g. one sent before an eviction, to the running step
+# so that it can save its state.
+forward() {
+  if [[ $child != 0 ]]; then
+    kill -$1 $child 2>/dev/null
+  fi
+}
+trap "forward USR1" USR1
+trap "forward USR2" USR2
+trap "forward HUP" HUP
+
+# Steps before ROADIE_FIRST_STEP finished in an interrupted execution and their
+# stdout files are kept.
+first=${ROADIE_FIRST_STEP:-0}
+
+# The container exits with the status of the first failed step even if the
+# following steps succeed.
+failed=0
+failed_step=
+timed_out=
 {{range $index, $elements := .Run}}
-echo "{{.}}"
-sh -c "{{.}}" > /tmp/stdout{{$index}}.txt
+if [[ {{$index}} -lt $first ]]; then
+  echo "Skipping step {{$index}} which has finished"
+else
+  echo "##roadie-step-begin {{$index}}"
+  echo "{{.}}"
+  {{if $.StepTimeout}}timeout {{$.StepTimeout.Seconds}} {{end}}sh -c "{{.}}" > /roadie/results/stdout{{$index}}.txt &
+  child=$!
+  wait $child
+  status=$?
+  # wait returns when a forwarded signal is received; keep waiting the step.
+  while kill -0 $child 2>/dev/null; do
+    wait $child
+    status=$?
+  done
+  child=0
+  echo "##roadie-step-end {{$index}} $status"
+  if [[ $status != 0 && $failed == 0 ]]; then
+    failed=$status
+    failed_step={{$index}}
+  fi
+{{- if $.StepTimeout}}
+  if [[ $status == 124 ]]; then
+    echo "Step {{$index}} timed out after {{$.StepTimeout}}" >&2
+    timed_out="$timed_out {{$index}}"
+  fi
+{{- end}}
+fi
 {{end}}
+if [[ -n $timed_out ]]; then
+  echo "Steps timed out:$timed_out" >&2
+fi
+if [[ $failed != 0 ]]; then
+  echo "Step $failed_step failed with status $failed" >&2
+fi
+exit $failed
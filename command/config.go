@@ -0,0 +1,101 @@
+//
+// command/config.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+	"github.com/jkawamoto/roadie/cloud/azure"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config defines settings of roadie-azure which are stored in a config file
+// with the configuration of Azure.
+type Config struct {
+	// Secrets maps secret names to their values.
+	Secrets roadie.Secrets `yaml:"secrets,omitempty"`
+	// Credential defines how to access the cloud storage.
+	Credential roadie.CredentialConfig `yaml:"credential,omitempty"`
+	// Storage defines where files are read and written; the Azure storage is
+	// used by default.
+	Storage roadie.StorageConfig `yaml:"storage,omitempty"`
+}
+
+// NewConfig reads a given named config file; settings for Azure are ignored.
+func NewConfig(filename string) (cfg *Config, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	cfg = new(Config)
+	err = yaml.Unmarshal(data, cfg)
+	return
+
+}
+
+// LoadSecrets returns secrets defined in the config file and a given named
+// secrets file; secrets in the file take precedence. If the filename is
+// empty, only secrets in the config file are returned.
+func (cfg *Config) LoadSecrets(filename string) (res roadie.Secrets, err error) {
+
+	res = make(roadie.Secrets)
+	res.Merge(cfg.Secrets)
+	if filename == "" {
+		return
+	}
+
+	secrets, err := roadie.ReadSecrets(filename)
+	if err != nil {
+		return
+	}
+	res.Merge(secrets)
+	return
+
+}
+
+// NewStorage creates the storage defined in the config file. The Azure
+// storage uses a token source with the credential defined in the file; the
+// token is refreshed until a given context is canceled.
+func (cfg *Config) NewStorage(ctx context.Context, azureCfg *azure.Config, logger *log.Logger) (store roadie.Storage, err error) {
+
+	var provider roadie.StorageProvider
+	if cfg.Storage.IsAzure() {
+		var cred roadie.Credential
+		cred, err = cfg.Credential.Credential(azureCfg.TenantID, ClientID)
+		if err != nil {
+			return
+		}
+		var source *roadie.TokenSource
+		source, err = roadie.NewTokenSource(ctx, azureCfg, cred, logger)
+		if err != nil {
+			return
+		}
+		provider = source
+	}
+	return cfg.Storage.Storage(provider)
+
+}
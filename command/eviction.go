@@ -0,0 +1,146 @@
+//
+// command/eviction.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+)
+
+// evictionWatcher watches scheduled evictions of this machine; when one is
+// scheduled, it sends a signal to the running sandbox container so that the
+// program can save its state, and cancels the task in time to upload result
+// files.
+type evictionWatcher struct {
+	// Endpoint is the Scheduled Events endpoint; if empty, evictions aren't
+	// watched.
+	Endpoint string
+	// Instance is the name of this machine in scheduled events; if empty, it
+	// is obtained from the instance metadata service.
+	Instance string
+	// Signal is sent to the sandbox container; if empty,
+	// DefaultEvictionSignal is used.
+	Signal string
+	Logger *log.Logger
+
+	mutex     sync.Mutex
+	deadline  time.Time
+	docker    *roadie.DockerClient
+	container string
+}
+
+// Watch waits for an eviction until a given context is canceled; it calls a
+// given cancel function EvictionUploadTime before the eviction starts.
+func (w *evictionWatcher) Watch(ctx context.Context, cancel context.CancelFunc) {
+
+	if w.Endpoint == "" {
+		return
+	}
+	instance := w.Instance
+	if instance == "" {
+		var err error
+		instance, err = roadie.GetInstanceName(ctx, roadie.DefaultInstanceNameURL)
+		if err != nil {
+			w.Logger.Println("* Cannot get the name of this machine; evictions aren't watched:", err)
+			return
+		}
+	}
+	event, err := roadie.WaitEviction(ctx, w.Endpoint, instance)
+	if err != nil {
+		return
+	}
+	deadline := event.Deadline(time.Now())
+	w.Logger.Printf("* This machine will be evicted at %v by event %v", deadline.Format(time.RFC3339), event.EventID)
+
+	w.mutex.Lock()
+	w.deadline = deadline
+	docker, container := w.docker, w.container
+	w.mutex.Unlock()
+	if container != "" {
+		signal := w.Signal
+		if signal == "" {
+			signal = DefaultEvictionSignal
+		}
+		w.Logger.Printf("Sending %v to the sandbox container", signal)
+		if err = docker.Signal(ctx, container, signal); err != nil {
+			w.Logger.Println("* Cannot send a signal to the sandbox container:", err)
+		}
+	}
+
+	timer := time.NewTimer(time.Until(deadline.Add(-EvictionUploadTime)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+		w.Logger.Println("* Stopping the task to upload result files before the eviction")
+		cancel()
+	}
+
+}
+
+// SetContainer sets the running sandbox container which receives the signal;
+// an empty name means no containers are running.
+func (w *evictionWatcher) SetContainer(docker *roadie.DockerClient, container string) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.docker = docker
+	w.container = container
+
+}
+
+// Evicted returns true if an eviction is scheduled.
+func (w *evictionWatcher) Evicted() bool {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return !w.deadline.IsZero()
+
+}
+
+// Deadline returns when this machine will be evicted; it returns the zero
+// time if no evictions are scheduled.
+func (w *evictionWatcher) Deadline() time.Time {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.deadline
+
+}
+
+// UploadContext returns a context to upload files; it expires after
+// UploadTimeout or at the scheduled eviction.
+func (w *evictionWatcher) UploadContext() (context.Context, context.CancelFunc) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	deadline := time.Now().Add(UploadTimeout)
+	if !w.deadline.IsZero() && w.deadline.Before(deadline) {
+		deadline = w.deadline
+	}
+	return context.WithDeadline(context.Background(), deadline)
+
+}
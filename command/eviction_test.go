@@ -0,0 +1,118 @@
+//
+// command/eviction_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+)
+
+func TestEvictionWatcher(t *testing.T) {
+
+	defer setDuration(&roadie.EventsPollInterval, 10*time.Millisecond)()
+
+	// The eviction starts one second after the time to upload files.
+	notBefore := time.Now().Add(EvictionUploadTime + time.Second).UTC()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(roadie.ScheduledEvents{
+			DocumentIncarnation: 1,
+			Events: []roadie.ScheduledEvent{
+				{
+					EventID:   "preempt",
+					EventType: roadie.EventTypePreempt,
+					Resources: []string{"vm1"},
+					NotBefore: notBefore.Format(time.RFC1123),
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	w := &evictionWatcher{
+		Endpoint: server.URL,
+		Instance: "vm1",
+		Logger:   log.New(ioutil.Discard, "", 0),
+	}
+	if w.Evicted() {
+		t.Error("Evicted returns true before watching")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	taskCtx, cancelTask := context.WithCancel(ctx)
+	defer cancelTask()
+	go w.Watch(ctx, cancelTask)
+
+	select {
+	case <-taskCtx.Done():
+	case <-ctx.Done():
+		t.Fatal("the task isn't canceled before the eviction")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("the task isn't canceled before the eviction")
+	}
+	if !w.Evicted() {
+		t.Error("Evicted returns false")
+	}
+	if time.Now().After(notBefore.Add(-EvictionUploadTime + time.Second)) {
+		t.Error("the task is canceled too late")
+	}
+
+	uploadCtx, cancelUpload := w.UploadContext()
+	defer cancelUpload()
+	if deadline, ok := uploadCtx.Deadline(); !ok || deadline.After(notBefore) {
+		t.Errorf("deadline of uploading is %v, want %v", deadline, notBefore.Truncate(time.Second))
+	}
+
+}
+
+func TestEvictionWatcherDisabled(t *testing.T) {
+
+	w := &evictionWatcher{
+		Logger: log.New(ioutil.Discard, "", 0),
+	}
+	done := make(chan struct{})
+	go func() {
+		w.Watch(context.Background(), func() {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch doesn't return without an endpoint")
+	}
+
+	uploadCtx, cancelUpload := w.UploadContext()
+	defer cancelUpload()
+	if deadline, ok := uploadCtx.Deadline(); !ok || deadline.After(time.Now().Add(UploadTimeout)) {
+		t.Errorf("deadline of uploading is %v", deadline)
+	}
+
+}
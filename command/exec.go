@@ -22,26 +22,48 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
-	"net/url"
 	"os"
-	"path"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/storage"
-	"github.com/Azure/go-autorest/autorest/adal"
-	"github.com/docker/docker/api/types/mount"
 	"github.com/jkawamoto/roadie-azure/roadie"
 	"github.com/jkawamoto/roadie/cloud/azure"
-	"github.com/jkawamoto/roadie/cloud/azure/auth"
 	"github.com/urfave/cli"
 )
 
 const (
 	// DebugFile defines the name of temporal files.
 	DebugFile = "stderr.txt"
+	// DiagnosticsFile defines the name of a local file where a diagnostics
+	// bundle is stored if it cannot be uploaded.
+	DiagnosticsFile = "diagnostics.tar.gz"
+	// CheckpointFile defines the suffix of the name of a local file recording
+	// completed phases so that an interrupted execution can resume.
+	CheckpointFile = "checkpoint.json"
+	// LogFormatText is the format of plain text logs.
+	LogFormatText = "text"
+	// LogFormatJSON is the format of structured logs consisting of JSON lines.
+	LogFormatJSON = "json"
+	// UploadTimeout defines the time limit to upload result files.
+	UploadTimeout = 10 * time.Minute
+	// FlushTimeout defines the time limit to send remaining log messages.
+	FlushTimeout = time.Minute
+	// EvictionUploadTime defines how long before an eviction the task is
+	// canceled to upload result files and the checkpoint.
+	EvictionUploadTime = 15 * time.Second
+	// DefaultEvictionSignal defines the signal sent to the sandbox container
+	// when an eviction is scheduled; the entrypoint forwards it to the running
+	// step, which can save its state and keep running, while SIGTERM stops
+	// the step.
+	DefaultEvictionSignal = "SIGUSR1"
 )
 
 // Exec defines arguments used in exec command.
@@ -49,6 +71,18 @@ type Exec struct {
 	Config string
 	Script string
 	Name   string
+	// Secrets is the name of an optional file defining secrets.
+	Secrets string
+	// LogFormat is either LogFormatText or LogFormatJSON.
+	LogFormat string
+	// EventsURL is the Scheduled Events endpoint watched for evictions; if
+	// empty, DefaultScheduledEventsURL is watched only when the Azure storage
+	// is used since the endpoint exists only in Azure.
+	EventsURL string
+	// Instance is the name of this machine in scheduled events.
+	Instance string
+	// EvictionSignal is sent to the sandbox container before an eviction.
+	EvictionSignal string
 }
 
 // run executes exec command.
@@ -65,174 +99,239 @@ func (e *Exec) run() (err error) {
 		return
 	}
 
+	// The token is refreshed until all files are uploaded even if the
+	// execution is canceled.
+	tokenCtx, cancelToken := context.WithCancel(context.Background())
+	defer cancelToken()
+	var store roadie.Storage
+
 	// Prepare a file to store debugging data.
 	stderr, err := os.Create(DebugFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Cannot create a debugging file")
 		stderr = os.Stderr
 	}
-	defer func() (err error) {
-		stderr.Close()
+	// Upload a diagnostics bundle if the task fails; failures before the task
+	// starts, e.g. creating the storage, are also reported.
+	diag := roadie.NewDiagnostics()
+	var ext *Config
+	var task *Task
+	defer func() {
 		bg := context.Background()
-		if store, err := azure.NewStorageService(bg, cfg, nil); err == nil {
-			if fp, err := os.Open(DebugFile); err != nil {
-				defer fp.Close()
-				store.UploadWithMetadata(bg, azure.LogContainer, fmt.Sprintf("%v-debug.log", e.Name), fp, &storage.BlobProperties{
-					ContentType: "text/plain",
-				}, nil)
+		if store == nil {
+			var serr error
+			store, serr = fallbackStorage(bg, ext, cfg)
+			if serr != nil {
+				fmt.Fprintln(stderr, "Cannot create a storage to upload logs:", serr)
 			}
 		}
-		return
-	}()
-	debugLogger := log.New(stderr, "", log.LstdFlags|log.Lshortfile|log.LUTC)
-
-	fmt.Println("Creating a storage service")
-	storage, err := azure.NewStorageService(ctx, cfg, debugLogger)
-	if err != nil {
-
-		var token *adal.Token
-		authorizer := auth.NewManualAuthorizer(cfg.TenantID, ClientID, nil, "renew")
-		token, err = authorizer.RefreshToken(&cfg.Token)
-		if err != nil {
-			return
+		if err != nil || task != nil && task.Failed() {
+			if task == nil {
+				wd, _ := os.Getwd()
+				new(roadie.SystemStats).Diagnose(diag, wd)
+			}
+			if err != nil {
+				diag.Add("error.txt", []byte(err.Error()+"\n"))
+			}
+			logger := log.New(stderr, "", log.LstdFlags|log.LUTC)
+			uploadDiagnostics(store, fmt.Sprintf("%v-diagnostics.tar.gz", e.Name), diag, logger)
 		}
-
-		cfg.Token = *token
-		storage, err = azure.NewStorageService(ctx, cfg, debugLogger)
-		if err != nil {
-			// If cannot create an interface to storage service, cannot upload
-			// computation results. Thus terminate this computation.
+		stderr.Close()
+		if store == nil {
 			return
 		}
-
-	}
-
-	fmt.Println("Creating a logger")
-	logWriter := roadie.NewLogWriter(ctx, storage, fmt.Sprintf("%v.log", e.Name), stderr)
-	defer logWriter.Close()
-	logger := log.New(logWriter, "", log.LstdFlags|log.LUTC)
-
-	// Delete the config file and script file from the storage.
-	logger.Println("Deleting the config file from the cloud storage")
-	var loc *url.URL
-	loc, err = url.Parse("roadie://" + path.Join(azure.StartupContainer, e.Config))
-	if err != nil {
-		logger.Println("* Cannot parse a URL:", err)
-	} else {
-		err = storage.Delete(ctx, loc)
-		if err != nil {
-			logger.Println("* Cannot delete the config file from the cloud storage:", err)
-		}
-	}
-	logger.Println("Deleting the script file from the cloud storage")
-	loc, err = url.Parse("roadie://" + path.Join(azure.StartupContainer, e.Script))
-	if err != nil {
-		logger.Println("* Cannot parse a URL:", err)
-	} else {
-		err = storage.Delete(ctx, loc)
-		if err != nil {
-			logger.Println("* Cannot delete the script file from the cloud storage:", err)
+		if fp, ferr := os.Open(DebugFile); ferr == nil {
+			defer fp.Close()
+			store.Upload(bg, roadie.LogContainer, fmt.Sprintf("%v-debug.log", e.Name), fp, "text/plain")
 		}
-	}
+	}()
 
-	// Read the script file.
-	script, err := roadie.NewScript(e.Script, logger)
+	// Read secrets so that their values will be masked in any logs.
+	ext, err = NewConfig(e.Config)
 	if err != nil {
-		// If cannot read the script file, cannot execute the task;
-		// terminate this computation.
-		logger.Println("Cannot read any script file:", err)
+		ext = nil
+		fmt.Fprintln(stderr, "Cannot read the config file:", err)
 		return
 	}
-	if script.Name == "" {
-		script.Name = fmt.Sprintf("roadie-%x", time.Now().Unix())
-	}
-
-	// Prepare source code.
-	err = script.PrepareSourceCode(ctx)
+	secrets, err := ext.LoadSecrets(e.Secrets)
 	if err != nil {
-		logger.Println("Cannot prepare source code:", err)
+		fmt.Fprintln(stderr, "Cannot read secrets:", err)
 		return
 	}
+	debugLogger := log.New(roadie.NewMaskedWriter(stderr, secrets.Values()), "", log.LstdFlags|log.Lshortfile|log.LUTC)
 
-	// Prepare data files.
-	err = script.DownloadDataFiles(ctx)
+	fmt.Println("Creating a storage service")
+	// The token is refreshed in background so that it won't expire during
+	// long running tasks.
+	store, err = ext.NewStorage(tokenCtx, cfg, debugLogger)
 	if err != nil {
-		logger.Println("Cannot prepare data files:", err)
+		fmt.Fprintln(stderr, "Cannot create a storage:", err)
 		return
 	}
 
-	// Execute commands.
-	docker, err := roadie.NewDockerClient(logger)
-	if err != nil {
-		logger.Println("Cannot create docker client:", err)
-		return
+	// Scheduled events are provided only for Azure virtual machines.
+	eventsURL := e.EventsURL
+	if _, ok := store.(*roadie.AzureStorage); ok && eventsURL == "" {
+		eventsURL = roadie.DefaultScheduledEventsURL
 	}
-	defer docker.Close()
-	dockerfile, err := script.Dockerfile()
-	if err != nil {
-		logger.Println("Cannot create Dockerfile:", err)
+
+	// Cancel the execution when receiving SIGTERM or SIGINT; the sandbox
+	// container will be stopped and result files will be uploaded.
+	defer cancelOnSignal(cancel, debugLogger)()
+
+	task = &Task{
+		Name:           e.Name,
+		Script:         e.Script,
+		Inputs:         []string{e.Config, e.Script},
+		Secrets:        secrets,
+		LogFormat:      e.LogFormat,
+		Store:          store,
+		Debug:          stderr,
+		Checkpoint:     checkpointPath(e.Name),
+		EventsURL:      eventsURL,
+		Instance:       e.Instance,
+		EvictionSignal: e.EvictionSignal,
+		Diagnostics:    diag,
 	}
-	entrypoint, err := script.Entrypoint()
-	if err != nil {
-		logger.Println("Cannot create entrypoint.sh:", err)
+	return task.Run(ctx)
+}
+
+// checkpointPath returns the path of the checkpoint of a given named task.
+// The checkpoint is stored in the temporary directory where task directories
+// are created; the working directory is mounted to the sandbox container,
+// which could modify the checkpoint, and result files are found there.
+func checkpointPath(name string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("roadie-%v-%v", roadie.SandboxName(name), CheckpointFile))
+}
+
+// exit terminates the process; tests replace it.
+var exit = os.Exit
+
+// cancelOnSignal calls a given cancel function when receiving SIGTERM or
+// SIGINT. Since stopping the task and uploading results take a while,
+// receiving one of them again exits immediately. The returned function stops
+// handling the signals.
+func cancelOnSignal(cancel context.CancelFunc, logger *log.Logger) (stop func()) {
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	done := make(chan struct{})
+	go func() {
+		canceled := false
+		for {
+			select {
+			case s := <-sig:
+				if !canceled {
+					logger.Println("* Received a signal:", s)
+					canceled = true
+					cancel()
+					continue
+				}
+				logger.Println("* Received a signal again, exiting immediately:", s)
+				code := 1
+				if n, ok := s.(syscall.Signal); ok {
+					code = 128 + int(n)
+				}
+				exit(code)
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		close(done)
 	}
 
-	err = docker.Build(ctx, &roadie.DockerBuildOpt{
-		ImageName:  script.Name,
-		Dockerfile: dockerfile,
-		Entrypoint: entrypoint,
-	})
+}
+
+// fallbackStorage creates a storage to upload logs when the storage of a task
+// cannot be created; the storage defined in a given config is used if it
+// doesn't require credentials, and otherwise the Azure storage is used. It
+// returns nil if the config couldn't be read.
+func fallbackStorage(ctx context.Context, ext *Config, cfg *azure.Config) (store roadie.Storage, err error) {
+
+	if ext == nil {
+		return nil, nil
+	}
+	if !ext.Storage.IsAzure() {
+		return ext.Storage.Storage(nil)
+	}
+	svc, err := azure.NewStorageService(ctx, cfg, nil)
 	if err != nil {
-		logger.Println("Failed to prepare a sandbox container:", err)
 		return
 	}
+	return roadie.NewAzureStorage(roadie.StaticStorage(svc)), nil
 
-	wd, err := os.Getwd()
-	if err != nil {
-		logger.Println("Cannot get the working directory:", err)
+}
+
+// uploadDiagnostics uploads a given diagnostics bundle to the log container
+// with a given name. If the storage is nil or the bundle cannot be uploaded,
+// it is stored in DiagnosticsFile.
+func uploadDiagnostics(store roadie.Storage, name string, diag *roadie.Diagnostics, logger *log.Logger) {
+
+	var buf bytes.Buffer
+	if _, err := diag.WriteTo(&buf); err != nil {
+		logger.Println("* Cannot create a diagnostics bundle:", err)
 		return
 	}
-	err = docker.Start(ctx, script.Name, []mount.Mount{
-		mount.Mount{
-			Type:   mount.TypeBind,
-			Source: wd,
-			Target: "/data",
-		},
-		mount.Mount{
-			Type:   mount.TypeBind,
-			Source: "/tmp",
-			Target: "/tmp",
-		},
-	})
-	if err != nil {
-		// Even if some errors occur, result files need to be uploads;
-		// thus not terminate this computation.
-		logger.Println("* Error occurs during execution:", err)
+	if store == nil {
+		storeDiagnostics(buf.Bytes(), logger)
+		return
 	}
 
-	// Upload results.
-	storage, err = azure.NewStorageService(ctx, cfg, debugLogger)
-	if err != nil {
-
-		var token *adal.Token
-		authorizer := auth.NewManualAuthorizer(cfg.TenantID, ClientID, nil, "renew")
-		token, err = authorizer.RefreshToken(&cfg.Token)
-		if err != nil {
-			logger.Println("Failed to refresh a token:", err)
-			return
+	ctx, cancel := context.WithTimeout(context.Background(), UploadTimeout)
+	defer cancel()
+	var err error
+	wait := roadie.LogRetryInterval
+	for i := 0; i != roadie.LogRetry && ctx.Err() == nil; i++ {
+		if i != 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+			wait *= 2
 		}
-
-		cfg.Token = *token
-		storage, err = azure.NewStorageService(ctx, cfg, logger)
-		if err != nil {
-			// If cannot create an interface to storage service, cannot upload
-			// computation results. Thus terminate this computation.
-			logger.Println("Failed to connect cloud storage:", err)
+		err = store.Upload(ctx, roadie.LogContainer, name, bytes.NewReader(buf.Bytes()), "application/gzip")
+		if err == nil {
+			logger.Println("Uploaded a diagnostics bundle:", name)
 			return
 		}
+	}
+
+	logger.Println("* Cannot upload a diagnostics bundle:", err)
+	storeDiagnostics(buf.Bytes(), logger)
+
+}
+
+// storeDiagnostics writes a given diagnostics bundle to DiagnosticsFile.
+func storeDiagnostics(data []byte, logger *log.Logger) {
+
+	if err := ioutil.WriteFile(DiagnosticsFile, data, 0644); err != nil {
+		logger.Println("* Cannot store a diagnostics bundle:", err)
+		return
+	}
+	logger.Println("Stored a diagnostics bundle in", DiagnosticsFile)
+
+}
+
+// closeLogWriter closes a given log writer; if sending remaining messages
+// takes longer than FlushTimeout, it cancels the sending by a given function.
+func closeLogWriter(writer io.Closer, cancel context.CancelFunc) {
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writer.Close()
+	}()
 
+	select {
+	case <-done:
+	case <-time.After(FlushTimeout):
+		cancel()
+		<-done
 	}
-	return script.UploadResults(ctx, storage)
 
 }
 
@@ -245,9 +344,14 @@ func CmdExec(c *cli.Context) (err error) {
 	}
 
 	e := &Exec{
-		Config: c.Args().First(),
-		Script: c.Args().Get(1),
-		Name:   c.Args().Get(2),
+		Config:         c.Args().First(),
+		Script:         c.Args().Get(1),
+		Name:           c.Args().Get(2),
+		Secrets:        c.String("secrets"),
+		LogFormat:      c.String("log-format"),
+		EventsURL:      c.String("events-url"),
+		Instance:       c.String("vm-name"),
+		EvictionSignal: c.String("eviction-signal"),
 	}
 	return e.run()
 
@@ -0,0 +1,143 @@
+//
+// command/exec_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/assets"
+	"github.com/jkawamoto/roadie-azure/roadie"
+)
+
+func TestCancelOnSignal(t *testing.T) {
+
+	codes := make(chan int, 1)
+	defer func(f func(int)) {
+		exit = f
+	}(exit)
+	exit = func(code int) {
+		codes <- code
+	}
+
+	canceled := make(chan struct{})
+	stop := cancelOnSignal(func() {
+		close(canceled)
+	}, log.New(ioutil.Discard, "", 0))
+	defer stop()
+
+	// The first signal cancels the context.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("cannot send a signal: %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first signal doesn't cancel the context")
+	}
+
+	// The second signal exits immediately.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("cannot send a signal: %v", err)
+	}
+	select {
+	case code := <-codes:
+		if code != 130 {
+			t.Errorf("exit status is %v, want %v", code, 130)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second signal doesn't exit")
+	}
+
+}
+
+func TestFallbackStorage(t *testing.T) {
+
+	// No storages are available if the config file cannot be read.
+	store, err := fallbackStorage(context.Background(), nil, nil)
+	if err != nil || store != nil {
+		t.Errorf("fallbackStorage returns %v and %v, want no storages", store, err)
+	}
+
+	// The local storage defined in the config is used instead of Azure.
+	ext := &Config{
+		Storage: roadie.StorageConfig{
+			Type: roadie.StorageLocal,
+			Path: "/tmp",
+		},
+	}
+	store, err = fallbackStorage(context.Background(), ext, nil)
+	if err != nil {
+		t.Fatalf("fallbackStorage returns an error: %v", err)
+	}
+	if _, ok := store.(*roadie.LocalStorage); !ok {
+		t.Errorf("fallbackStorage returns %T, want a local storage", store)
+	}
+
+}
+
+func TestUploadDiagnosticsWithoutStorage(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("cannot get the working directory: %v", err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatalf("cannot change the working directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	diag := roadie.NewDiagnostics()
+	diag.Add("error.txt", []byte("test error\n"))
+	uploadDiagnostics(nil, "test-diagnostics.tar.gz", diag, log.New(ioutil.Discard, "", 0))
+	if _, err = os.Stat(DiagnosticsFile); err != nil {
+		t.Errorf("the diagnostics bundle isn't stored: %v", err)
+	}
+
+}
+
+func TestDefaultEvictionSignal(t *testing.T) {
+
+	// The entrypoint must forward the signal to the running step instead of
+	// stopping it.
+	data, err := assets.Asset("assets/entrypoint.sh")
+	if err != nil {
+		t.Fatalf("cannot read the entrypoint: %v", err)
+	}
+	name := strings.TrimPrefix(DefaultEvictionSignal, "SIG")
+	if trap := fmt.Sprintf("trap \"forward %v\" %v", name, name); !strings.Contains(string(data), trap) {
+		t.Errorf("the entrypoint doesn't forward %v", DefaultEvictionSignal)
+	}
+
+}
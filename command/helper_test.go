@@ -0,0 +1,36 @@
+//
+// command/helper_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import "time"
+
+// setDuration sets a given duration variable, e.g. a polling interval, to a
+// given value and returns a function restoring the original value.
+func setDuration(v *time.Duration, d time.Duration) (restore func()) {
+
+	orig := *v
+	*v = d
+	return func() {
+		*v = orig
+	}
+
+}
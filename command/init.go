@@ -31,11 +31,9 @@ import (
 	"os/exec"
 	"path/filepath"
 
-	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/jkawamoto/roadie-azure/assets"
 	"github.com/jkawamoto/roadie-azure/roadie"
 	"github.com/jkawamoto/roadie/cloud/azure"
-	"github.com/jkawamoto/roadie/cloud/azure/auth"
 	"github.com/urfave/cli"
 )
 
@@ -59,34 +57,15 @@ func (e *Init) run() (err error) {
 	}
 
 	var logWriter io.WriteCloser
-	storage, err := azure.NewStorageService(ctx, cfg, log.New(os.Stderr, "", log.LstdFlags|log.LUTC))
+	store, err := e.storage(ctx, cfg)
 	if err != nil {
-		var token *adal.Token
-		a := auth.NewManualAuthorizer(cfg.TenantID, ClientID, nil, "renew")
-		token, err = a.RefreshToken(&cfg.Token)
-		if err != nil {
-			logWriter = os.Stderr
-			fmt.Fprintln(os.Stderr, "Cannot renew an authentication token")
-
-		} else {
-			cfg.Token = *token
-			storage, err = azure.NewStorageService(ctx, cfg, log.New(os.Stderr, "", log.LstdFlags|log.LUTC))
-			if err != nil {
-				// If cannot create a storage service, all logs will be lost but should
-				// continue executing this script.
-				logWriter = os.Stderr
-				fmt.Fprintln(logWriter, "Cannot connect log writer to the cloud storage:", err.Error())
-
-			} else {
-				logWriter = roadie.NewLogWriter(ctx, storage, fmt.Sprintf("%v-init.log", e.Name), nil)
-				defer logWriter.Close()
-
-			}
-
-		}
+		// If cannot create a storage service, all logs will be lost but should
+		// continue executing this script.
+		logWriter = os.Stderr
+		fmt.Fprintln(logWriter, "Cannot connect log writer to the cloud storage:", err.Error())
 
 	} else {
-		logWriter = roadie.NewLogWriter(ctx, storage, fmt.Sprintf("%v-init.log", e.Name), nil)
+		logWriter = roadie.NewLogWriter(ctx, store, fmt.Sprintf("%v-init.log", e.Name), nil)
 		defer logWriter.Close()
 	}
 	logger := log.New(logWriter, "", log.LstdFlags|log.LUTC)
@@ -101,7 +80,7 @@ func (e *Init) run() (err error) {
 
 	logger.Println("Configurating this job")
 	cmd := exec.CommandContext(ctx, filename)
-	err = roadie.ExecCommand(cmd, logger)
+	err = roadie.ExecCommand(cmd, logger, nil)
 	if err != nil {
 		logger.Println("Cannot finish configurating the job", err.Error())
 	} else {
@@ -111,6 +90,17 @@ func (e *Init) run() (err error) {
 
 }
 
+// storage creates the storage defined in the config file.
+func (e *Init) storage(ctx context.Context, cfg *azure.Config) (store roadie.Storage, err error) {
+
+	ext, err := NewConfig(e.Config)
+	if err != nil {
+		return
+	}
+	return ext.NewStorage(ctx, cfg, log.New(os.Stderr, "", log.LstdFlags|log.LUTC))
+
+}
+
 // CmdInit execute init script to set up an instance for Roadie.
 func CmdInit(c *cli.Context) (err error) {
 
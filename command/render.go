@@ -0,0 +1,100 @@
+//
+// command/render.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+	"github.com/urfave/cli"
+)
+
+// Render defines arguments used in render command.
+type Render struct {
+	Script string
+	// Output is a directory where the build context is written; if empty,
+	// the rendered files are printed.
+	Output string
+}
+
+// run renders the Dockerfile and entrypoint.sh of a script.
+func (e *Render) run() (err error) {
+
+	script, err := roadie.NewScript(e.Script, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		return
+	}
+	dockerfile, err := script.Dockerfile()
+	if err != nil {
+		return
+	}
+	entrypoint, err := script.Entrypoint()
+	if err != nil {
+		return
+	}
+	opt := &roadie.DockerBuildOpt{
+		Dockerfile: dockerfile,
+		Entrypoint: entrypoint,
+	}
+
+	ctx := context.Background()
+	files, err := roadie.BuildContext(ctx, opt)
+	if err != nil {
+		return
+	}
+
+	if e.Output == "" {
+		fmt.Printf("# %v\n%s\n", roadie.ContextDockerfile, dockerfile)
+		fmt.Printf("# %v\n%s\n", roadie.ContextEntrypoint, entrypoint)
+	} else if err = roadie.WriteBuildContext(ctx, opt, e.Output); err != nil {
+		return
+	}
+
+	fmt.Println("# Build context")
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	if e.Output != "" {
+		fmt.Printf("\nBuild the sandbox image with:\n  docker build -f %v/%v %v\n", e.Output, roadie.ContextDockerfile, e.Output)
+	}
+	return
+
+}
+
+// CmdRender defines the action for the render command.
+func CmdRender(c *cli.Context) (err error) {
+
+	if c.NArg() != 1 {
+		fmt.Printf("expected 1 argument but %d given\n", c.NArg())
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	e := &Render{
+		Script: c.Args().First(),
+		Output: c.String("output"),
+	}
+	return e.run()
+
+}
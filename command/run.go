@@ -0,0 +1,153 @@
+//
+// command/run.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+	"github.com/urfave/cli"
+)
+
+const (
+	// DefaultOutputDir defines the default directory where run command stores
+	// result files.
+	DefaultOutputDir = "roadie-results"
+)
+
+// Run defines arguments used in run command.
+type Run struct {
+	Script string
+	// Output is the directory where logs and result files are stored; they
+	// are stored in the same layout as the local storage, i.e. <output>/log
+	// and <output>/result/<name>.
+	Output string
+	// Secrets is the name of an optional file defining secrets.
+	Secrets string
+}
+
+// run executes a script on this machine in a fresh workspace; logs are
+// written to stderr and stored with result files.
+func (e *Run) run() (err error) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	secrets := make(roadie.Secrets)
+	if e.Secrets != "" {
+		secrets, err = roadie.ReadSecrets(e.Secrets)
+		if err != nil {
+			return
+		}
+	}
+	logger := log.New(roadie.NewMaskedWriter(os.Stderr, secrets.Values()), "", log.LstdFlags)
+
+	// Paths given as arguments and in the script are relative to the current
+	// directory but the task runs in the workspace.
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	output, err := filepath.Abs(e.Output)
+	if err != nil {
+		return
+	}
+	filename, err := filepath.Abs(e.Script)
+	if err != nil {
+		return
+	}
+	script, err := roadie.NewScript(filename, logger)
+	if err != nil {
+		return
+	}
+	name := script.Name
+	if name == "" {
+		name = fmt.Sprintf("roadie-%x", time.Now().Unix())
+	}
+
+	workspace, err := ioutil.TempDir("", "roadie-run-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(workspace)
+	logger.Println("Created a workspace", workspace)
+
+	// Cancel the execution when receiving SIGTERM or SIGINT; the sandbox
+	// container will be stopped and result files will be stored.
+	defer cancelOnSignal(cancel, logger)()
+
+	// The task runs as exec does but stores logs and results in the output
+	// directory.
+	task := &Task{
+		Name:      name,
+		Script:    filename,
+		Dir:       workspace,
+		SourceDir: wd,
+		Secrets:   secrets,
+		Store:     roadie.NewLocalStorage(output),
+		Debug:     os.Stderr,
+		Console:   os.Stderr,
+	}
+	err = task.Run(ctx)
+	logger.Println("Result files are stored in", filepath.Join(output, roadie.ResultContainer))
+	return
+
+}
+
+// resolveSource converts a relative file URL of source code to an absolute
+// one based on a given directory; other URLs are returned as they are.
+func resolveSource(source, dir string) string {
+
+	if !strings.HasPrefix(source, "file://") {
+		return source
+	}
+	filename := strings.TrimPrefix(source, "file://")
+	if filepath.IsAbs(filename) {
+		return source
+	}
+	return "file://" + filepath.Join(dir, filename)
+
+}
+
+// CmdRun defines the action for the run command.
+func CmdRun(c *cli.Context) (err error) {
+
+	if c.NArg() != 1 {
+		fmt.Printf("expected 1 argument but %d given\n", c.NArg())
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	e := &Run{
+		Script:  c.Args().First(),
+		Output:  c.String("output"),
+		Secrets: c.String("secrets"),
+	}
+	return e.run()
+
+}
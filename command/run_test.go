@@ -0,0 +1,44 @@
+//
+// command/run_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import "testing"
+
+func TestResolveSource(t *testing.T) {
+
+	cases := []struct {
+		source string
+		expect string
+	}{
+		{"", ""},
+		{"https://example.com/src.tar.gz", "https://example.com/src.tar.gz"},
+		{"file:///abs/src.tar.gz", "file:///abs/src.tar.gz"},
+		{"file://src.tar.gz", "file:///work/src.tar.gz"},
+		{"file://../src.tar.gz", "file:///src.tar.gz"},
+	}
+	for _, c := range cases {
+		if res := resolveSource(c.source, "/work"); res != c.expect {
+			t.Errorf("resolveSource(%q) = %q, want %q", c.source, res, c.expect)
+		}
+	}
+
+}
@@ -0,0 +1,573 @@
+//
+// command/task.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/jkawamoto/roadie-azure/roadie"
+)
+
+// Task defines a task which runs a script in a working directory and uploads
+// logs and results to a storage; exec and worker commands run tasks.
+type Task struct {
+	// Name is the name of the task; logs and results are stored with it, and
+	// the sandbox image and container are named after it.
+	Name string
+	// Script is the path to the script file.
+	Script string
+	// Dir is the working directory mounted to the sandbox container; if empty,
+	// the current directory is used.
+	Dir string
+	// SourceDir is the directory against which a relative file URL of source
+	// code is resolved; if empty, the URL is used as it is.
+	SourceDir string
+	// Resources limits resources the sandbox container uses.
+	Resources roadie.ResourceShare
+	// Inputs are names of files in the startup container which are deleted
+	// once the task starts.
+	Inputs []string
+	// Secrets are given to the sandbox container and masked in logs.
+	Secrets roadie.Secrets
+	// LogFormat is either LogFormatText or LogFormatJSON.
+	LogFormat string
+	// Store is the storage where logs and results are uploaded.
+	Store roadie.Storage
+	// Debug receives debugging messages.
+	Debug io.Writer
+	// Console receives log messages in addition to the log file if not nil.
+	Console io.Writer
+	// Checkpoint is the path to a file recording completed phases so that an
+	// interrupted task can resume; if empty, the task always starts over.
+	Checkpoint string
+	// EventsURL is the Scheduled Events endpoint watched for evictions of this
+	// machine; if empty, evictions aren't watched.
+	EventsURL string
+	// Instance is the name of this machine in scheduled events; if empty, it
+	// is obtained from the instance metadata service.
+	Instance string
+	// EvictionSignal is sent to the sandbox container when an eviction is
+	// scheduled; if empty, DefaultEvictionSignal is used.
+	EvictionSignal string
+	// Docker is the API of the docker daemon running sandbox containers; if
+	// nil, a client of the local daemon is created.
+	Docker roadie.DockerAPI
+	// Diagnostics collects information for a diagnostics bundle if not nil;
+	// the caller uploads the bundle when the task fails. If nil, Run uploads
+	// a bundle by itself.
+	Diagnostics *roadie.Diagnostics
+
+	// failed is set if the sandbox container fails even if the task itself
+	// finishes without errors.
+	failed bool
+}
+
+// Failed returns true if the last run of this task failed; Run may return no
+// errors even if the sandbox container failed.
+func (t *Task) Failed() bool {
+	return t.failed
+}
+
+// Run runs this task; canceling a given context cancels the task, but logs
+// and result files are still uploaded.
+func (t *Task) Run(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The log writer uses its own context so that log messages will be sent
+	// even if the execution is canceled.
+	logCtx, cancelLog := context.WithCancel(context.Background())
+	defer cancelLog()
+	logWriter := roadie.NewLogWriter(logCtx, t.Store, fmt.Sprintf("%v.log", t.Name), t.Debug)
+	defer closeLogWriter(logWriter, cancelLog)
+	// The last log lines are kept for a diagnostics bundle.
+	tail := roadie.NewLogTail(roadie.DiagnosticsLogLines)
+	spool := io.MultiWriter(logWriter, tail)
+	if t.Console != nil {
+		spool = io.MultiWriter(logWriter, tail, t.Console)
+	}
+	output := spool
+	var structured *roadie.JSONLogWriter
+	flags := log.LstdFlags | log.LUTC
+	switch t.LogFormat {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		structured = roadie.NewJSONLogWriter(spool)
+		output = structured
+		flags = 0
+	default:
+		err = fmt.Errorf("Unsupported log format: %v", t.LogFormat)
+		fmt.Fprintln(t.Debug, err)
+		return
+	}
+	masked := roadie.NewMaskedWriter(output, t.Secrets.Values())
+	logger := log.New(masked, "", flags)
+	// Outputs of commands are recorded with their streams and run steps in
+	// structured logs; NewMaskedWriter keeps the recorder of a JSON log writer.
+	var recorder roadie.OutputRecorder
+	if structured != nil {
+		recorder = masked.(roadie.OutputRecorder)
+	}
+
+	// Watch evictions of this machine; the task is canceled before the
+	// eviction starts.
+	eviction := &evictionWatcher{
+		Endpoint: t.EventsURL,
+		Instance: t.Instance,
+		Signal:   t.EvictionSignal,
+		Logger:   logger,
+	}
+	go eviction.Watch(ctx, cancel)
+
+	// Maintain the status of this task in the cloud storage; the status is
+	// updated even if the execution is canceled.
+	statusCtx, cancelStatus := context.WithCancel(context.Background())
+	defer cancelStatus()
+	status := roadie.NewStatusReporter(statusCtx, t.Store, t.Name, t.Debug)
+	var outcome string
+	var exitCode *int
+	defer func() {
+		if outcome == "" {
+			switch {
+			case eviction.Evicted():
+				outcome = roadie.OutcomeEvicted
+			case ctx.Err() == context.Canceled:
+				outcome = roadie.OutcomeCancelled
+			case err != nil || t.failed:
+				outcome = roadie.OutcomeFailed
+			default:
+				outcome = roadie.OutcomeSucceeded
+			}
+		}
+		status.Finish(outcome, exitCode, err)
+		closeLogWriter(status, cancelStatus)
+	}()
+
+	setPhase := func(phase string) {
+		status.SetPhase(phase)
+		if structured != nil {
+			structured.SetPhase(phase)
+		}
+	}
+	redact := func(data []byte) []byte {
+		var buf bytes.Buffer
+		roadie.NewMaskedWriter(&buf, t.Secrets.Values()).Write(data)
+		return buf.Bytes()
+	}
+
+	// Upload a diagnostics bundle if the execution fails.
+	wd := t.Dir
+	diag := t.Diagnostics
+	if diag == nil {
+		diag = roadie.NewDiagnostics()
+	}
+	defer func() {
+		if err == nil && !t.failed {
+			return
+		}
+		new(roadie.SystemStats).Diagnose(diag, wd)
+		diag.Add("log-tail.txt", []byte(strings.Join(tail.Lines(), "\n")+"\n"))
+		if t.Diagnostics == nil {
+			uploadDiagnostics(t.Store, fmt.Sprintf("%v-diagnostics.tar.gz", t.Name), diag, logger)
+		}
+	}()
+
+	if wd == "" {
+		wd, err = os.Getwd()
+		if err != nil {
+			logger.Println("Cannot get the working directory:", err)
+			return
+		}
+	}
+
+	// Cancel the execution when the cancel marker of this task is created;
+	// WaitCancelMarker deletes the marker. The canceled task won't resume
+	// while one interrupted by a signal or an eviction can.
+	var requested int32
+	go func() {
+		if roadie.WaitCancelMarker(ctx, t.Store, t.Name) == nil {
+			logger.Println("* Found a cancel request:", roadie.CancelMarker(t.Name))
+			atomic.StoreInt32(&requested, 1)
+			cancel()
+		}
+	}()
+	interrupted := func() bool {
+		return ctx.Err() == context.Canceled && atomic.LoadInt32(&requested) == 0
+	}
+
+	// Delete input files from the storage.
+	for _, name := range t.Inputs {
+		logger.Println("Deleting", name, "from the cloud storage")
+		err = t.Store.Delete(ctx, roadie.StartupContainer, name)
+		if err != nil {
+			logger.Printf("* Cannot delete %v from the cloud storage: %v", name, err)
+		}
+	}
+
+	// Read the script file.
+	script, err := roadie.NewScript(t.Script, logger)
+	if err != nil {
+		// If cannot read the script file, cannot execute the task;
+		// terminate this computation.
+		logger.Println("Cannot read any script file:", err)
+		return
+	}
+	if script.Name == "" {
+		script.Name = fmt.Sprintf("roadie-%x", time.Now().Unix())
+	}
+	script.Dir = wd
+	if t.SourceDir != "" {
+		script.Source = resolveSource(script.Source, t.SourceDir)
+	}
+	script.Recorder = recorder
+	script.Masks = t.Secrets.Values()
+	raw, err := ioutil.ReadFile(t.Script)
+	if err != nil {
+		logger.Println("Cannot read any script file:", err)
+		return
+	}
+	diag.Add("script.yml", redact(raw))
+
+	// Resume from the checkpoint of an interrupted execution of this task;
+	// the checkpoint is kept only if the task is interrupted again, and it's
+	// uploaded if this machine is evicted.
+	checkpoint, err := roadie.LoadCheckpoint(t.Checkpoint, t.Name, raw)
+	if err != nil {
+		logger.Println("* Cannot read the checkpoint; the task starts over:", err)
+		os.Remove(t.Checkpoint)
+		checkpoint, err = roadie.LoadCheckpoint(t.Checkpoint, t.Name, raw)
+		if err != nil {
+			return
+		}
+	}
+	if checkpoint.Resumed() {
+		logger.Println("Resuming an interrupted execution from", t.Checkpoint)
+	}
+	defer func() {
+		if eviction.Evicted() {
+			uploadCtx, cancelUpload := eviction.UploadContext()
+			defer cancelUpload()
+			name := fmt.Sprintf("%v-checkpoint.json", t.Name)
+			if err := checkpoint.Upload(uploadCtx, t.Store, name); err != nil {
+				logger.Println("* Cannot upload the checkpoint:", err)
+			} else {
+				logger.Println("Uploaded the checkpoint as", name)
+			}
+		} else if !interrupted() {
+			checkpoint.Remove()
+		}
+	}()
+	record := func(err error) {
+		if err != nil {
+			logger.Println("* Cannot update the checkpoint:", err)
+		}
+	}
+
+	// Apply the time limit of the whole task; uploading results isn't limited
+	// so that partial results will be stored.
+	taskCtx := ctx
+	if script.Timeout > 0 {
+		var cancelTask context.CancelFunc
+		taskCtx, cancelTask = context.WithTimeout(ctx, script.Timeout)
+		defer cancelTask()
+	}
+
+	// Prepare source code.
+	setPhase(roadie.PhaseSource)
+	if checkpoint.Completed(roadie.PhaseSource, wd) {
+		logger.Println("Source code was prepared in the interrupted execution")
+	} else {
+		err = script.PrepareSourceCode(taskCtx)
+		if err != nil {
+			logger.Println("Cannot prepare source code:", err)
+			return
+		}
+		record(checkpoint.Complete(roadie.PhaseSource, wd))
+	}
+
+	// Prepare data files.
+	setPhase(roadie.PhaseData)
+	if checkpoint.Completed(roadie.PhaseData, wd) {
+		logger.Println("Data files were prepared in the interrupted execution")
+	} else {
+		err = script.DownloadDataFiles(taskCtx)
+		if err != nil {
+			logger.Println("Cannot prepare data files:", err)
+			return
+		}
+		record(checkpoint.Complete(roadie.PhaseData, wd))
+	}
+
+	// Each combination of parameters in the matrix runs in its own sandbox
+	// container; a script without a matrix runs once.
+	runs, err := script.Expand()
+	if err != nil {
+		logger.Println("Cannot expand the parameter matrix:", err)
+		return
+	}
+
+	// Execute commands.
+	setPhase(roadie.PhaseBuild)
+	var docker *roadie.DockerClient
+	if t.Docker != nil {
+		docker = roadie.NewDockerClientFromAPI(t.Docker, logger)
+	} else if docker, err = roadie.NewDockerClient(logger); err != nil {
+		logger.Println("Cannot create docker client:", err)
+		return
+	}
+	defer docker.Close()
+	docker.Recorder = recorder
+	docker.Diagnose(taskCtx, diag)
+
+	// execute builds a sandbox image for a given script, runs it, and uploads
+	// result files.
+	execute := func(s *roadie.Script) (err error) {
+
+		// Tasks running concurrently can have the same script name; images,
+		// containers, and build logs are named after the task and the
+		// combination.
+		label := t.Name
+		if s.Combination != nil {
+			label = fmt.Sprintf("%v-%v", t.Name, s.Combination.ID)
+			logger.Printf("Running combination %v: %v", s.Combination.ID, s.Combination.Params)
+		}
+		image := fmt.Sprintf("%v:%v", s.Name, roadie.SandboxName(label))
+		progress := checkpoint.Run(label)
+		if progress.Uploaded {
+			logger.Printf("Skipping %v which finished in the interrupted execution", label)
+			if exitCode == nil {
+				exitCode = new(int)
+			}
+			return
+		}
+		if s.Combination != nil {
+			status.SetCombination(s.Combination.ID)
+		}
+		setPhase(roadie.PhaseBuild)
+		status.SetSteps(len(s.Run))
+
+		dockerfile, err := s.Dockerfile()
+		if err != nil {
+			logger.Println("Cannot create Dockerfile:", err)
+		}
+		diag.Add("Dockerfile", redact(dockerfile))
+		entrypoint, err := s.Entrypoint()
+		if err != nil {
+			logger.Println("Cannot create entrypoint.sh:", err)
+		}
+		diag.Add("entrypoint.sh", redact(entrypoint))
+
+		if progress.Image == image && docker.ImageExists(taskCtx, image) {
+			logger.Println("Using the sandbox image built in the interrupted execution:", image)
+		} else {
+			// Messages from building the image are stored in another file so
+			// that outputs of the task can be found easily.
+			buildLogName := fmt.Sprintf("%v-build.log", label)
+			buildLogCtx, cancelBuildLog := context.WithCancel(context.Background())
+			defer cancelBuildLog()
+			buildLog := roadie.NewLogWriter(buildLogCtx, t.Store, buildLogName, t.Debug)
+			err = docker.Build(taskCtx, &roadie.DockerBuildOpt{
+				ImageName:  image,
+				Dockerfile: dockerfile,
+				Entrypoint: entrypoint,
+				Output:     roadie.NewMaskedWriter(buildLog, t.Secrets.Values()),
+			})
+			closeLogWriter(buildLog, cancelBuildLog)
+			if err != nil {
+				logger.Printf("* Failed to build a sandbox image, see %v: %v", buildLogName, err)
+				return
+			}
+			logger.Println("Built a sandbox image, see", buildLogName)
+			record(checkpoint.SetImage(label, image))
+		}
+
+		env, err := s.Environment(t.Secrets)
+		if err != nil {
+			logger.Println("Cannot prepare environment variables:", err)
+			return
+		}
+		scratchSize, err := roadie.ParseSize(s.ScratchSize)
+		if err != nil {
+			logger.Println("Cannot parse the size of the scratch directory:", err)
+			return
+		}
+		var taskDir *roadie.TaskDir
+		if progress.TaskDir != "" {
+			taskDir, err = roadie.OpenTaskDir(progress.TaskDir, scratchSize)
+		} else {
+			taskDir, err = roadie.NewTaskDir(roadie.SandboxName(label), scratchSize)
+		}
+		if err != nil {
+			logger.Println("Cannot create a task directory:", err)
+			return
+		}
+		record(checkpoint.SetTaskDir(label, taskDir.Root))
+		defer func() {
+			// Stdout files of finished steps are kept if the task can resume.
+			if t.Checkpoint == "" || !interrupted() {
+				taskDir.Remove()
+			}
+		}()
+		s.ResultDir = taskDir.ResultDir()
+
+		// Skip run steps which finished in the interrupted execution.
+		first := checkpoint.FirstStep(label, s.ResultDir)
+		if first != 0 {
+			logger.Printf("Skipping %v run steps which finished in the interrupted execution", first)
+			env = append(env, fmt.Sprintf("%v=%v", roadie.FirstStepEnv, first))
+			for i := 0; i != first; i++ {
+				status.BeginStep(i)
+				status.EndStep(i, 0)
+			}
+		}
+		// Combinations share the working directory; files existing before a
+		// combination starts are results of the others. A resumed combination
+		// has its own results there already.
+		if s.Combination != nil && first == 0 {
+			s.SkipExisting()
+		}
+
+		steps := roadie.StepObservers{status, checkpoint.Observer(label)}
+		if structured != nil {
+			steps = append(steps, structured)
+		}
+		opt := &roadie.DockerStartOpt{
+			ImageName:     image,
+			ContainerName: fmt.Sprintf("roadie-%v", roadie.SandboxName(label)),
+			Mounts: append([]mount.Mount{
+				mount.Mount{
+					Type:   mount.TypeBind,
+					Source: wd,
+					Target: "/data",
+				},
+			}, taskDir.Mounts()...),
+			Env:         env,
+			GracePeriod: s.GracePeriod,
+			// The container must stop before the eviction.
+			StopBy:      eviction.Deadline,
+			Diagnostics: diag,
+			Secrets:     t.Secrets.Values(),
+			Steps:       steps,
+			Memory:      t.Resources.Memory,
+			CPUSet:      t.Resources.CPUSet,
+		}
+		err = s.Security.Apply(opt, wd, s.OutputDirs())
+		if err != nil {
+			logger.Println("Cannot apply the security profile:", err)
+			return
+		}
+		if eviction.Evicted() {
+			logger.Printf("* Skipping %v since this machine will be evicted", label)
+			return
+		}
+		setPhase(roadie.PhaseRun)
+		// Result files are uploaded while running if the script asks.
+		syncer := roadie.NewResultSyncer(s, t.Store)
+		syncCtx, cancelSync := context.WithCancel(taskCtx)
+		go syncer.Run(syncCtx)
+		eviction.SetContainer(docker, opt.ContainerName)
+		err = docker.Start(taskCtx, opt)
+		eviction.SetContainer(nil, "")
+		cancelSync()
+		if err != nil || taskCtx.Err() != nil {
+			t.failed = true
+		}
+		// The exit code of a failed run takes precedence.
+		if exitErr, ok := err.(*roadie.ExitError); ok {
+			exitCode = &exitErr.Code
+		} else if err == nil && exitCode == nil {
+			exitCode = new(int)
+		}
+		if eviction.Evicted() {
+			outcome = roadie.OutcomeEvicted
+			logger.Println("* Execution is interrupted by an eviction")
+		} else if ctx.Err() == context.Canceled {
+			outcome = roadie.OutcomeCancelled
+			logger.Println("* Execution is canceled")
+		} else if taskCtx.Err() == context.DeadlineExceeded {
+			outcome = roadie.OutcomeTimeout
+			logger.Println("* Task exceeded the time limit:", script.Timeout)
+		} else if err != nil {
+			if outcome == "" {
+				outcome = roadie.OutcomeFailed
+			}
+			// Even if some errors occur, result files need to be uploads;
+			// thus not terminate this computation.
+			logger.Println("* Error occurs during execution:", err)
+		}
+
+		// Upload results; since ctx might have been canceled, use another
+		// context with a time limit.
+		setPhase(roadie.PhaseUpload)
+		uploadCtx, cancelUpload := eviction.UploadContext()
+		defer cancelUpload()
+		// The error of the run takes precedence over errors of uploading.
+		var uploadErr error
+		if s.Sync.Enabled() {
+			logger.Println("Uploading result files modified since the last sync")
+			_, uploadErr = syncer.Sync(uploadCtx)
+		} else {
+			uploadErr = s.UploadResults(uploadCtx, t.Store)
+		}
+		if uploadErr == nil && ctx.Err() != context.Canceled && !eviction.Evicted() {
+			record(checkpoint.SetUploaded(label))
+		}
+		if err == nil {
+			err = uploadErr
+		}
+		return
+
+	}
+
+	if len(script.Matrix) != 0 {
+		uploadCtx, cancelUpload := eviction.UploadContext()
+		defer cancelUpload()
+		if err = script.UploadIndex(uploadCtx, t.Store, runs); err != nil {
+			logger.Println("* Cannot upload the index of the parameter matrix:", err)
+			return
+		}
+	}
+
+	// Combinations run one by one; a failure of a combination doesn't stop
+	// others but the first error is returned.
+	for _, r := range runs {
+		if taskCtx.Err() != nil || eviction.Evicted() {
+			break
+		}
+		if e := execute(r); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+
+}
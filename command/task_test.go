@@ -0,0 +1,464 @@
+//
+// command/task_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+	"github.com/jkawamoto/roadie-azure/roadie/dockertest"
+)
+
+// testTaskName is the name of tasks run in tests.
+const testTaskName = "test-task"
+
+// entrypoint returns a behavior of a fake container running run steps as the
+// entrypoint does; each step exits with a given code. The step of a given
+// index waits for a signal after closing a given channel.
+func entrypoint(codes []int, wait int, waiting chan<- struct{}) dockertest.Behavior {
+
+	return func(c *dockertest.Container) int {
+		first, _ := strconv.Atoi(c.Env(roadie.FirstStepEnv))
+		dir := c.Mount(roadie.ContainerResultDir)
+		for i := first; i < len(codes); i++ {
+			fmt.Fprintln(c.Stdout, roadie.StepBeginMarker, i)
+			fmt.Fprintln(c.Stdout, "running step", i)
+			stdout := filepath.Join(dir, fmt.Sprintf("stdout%v.txt", i))
+			if err := ioutil.WriteFile(stdout, []byte(fmt.Sprintf("step %v\n", i)), 0644); err != nil {
+				return 1
+			}
+			if i == wait {
+				close(waiting)
+				<-c.Signals
+				return 143
+			}
+			fmt.Fprintln(c.Stdout, roadie.StepEndMarker, i, codes[i])
+			if codes[i] != 0 {
+				return codes[i]
+			}
+		}
+		return 0
+	}
+
+}
+
+// newTestTask creates a task running a script of given steps with a given
+// fake docker API; given lines are appended to the script. The script, the
+// storage, and the working directory are created in a given directory.
+func newTestTask(t *testing.T, dir string, docker *dockertest.Docker, steps int, lines ...string) *Task {
+
+	script := "name: task-test\nrun:\n"
+	for i := 0; i != steps; i++ {
+		script += fmt.Sprintf("  - step%v\n", i)
+	}
+	for _, v := range lines {
+		script += v + "\n"
+	}
+	filename := filepath.Join(dir, "script.yml")
+	if err := ioutil.WriteFile(filename, []byte(script), 0644); err != nil {
+		t.Fatalf("cannot write a script: %v", err)
+	}
+	wd := filepath.Join(dir, "wd")
+	if err := os.MkdirAll(wd, 0755); err != nil {
+		t.Fatalf("cannot create a working directory: %v", err)
+	}
+	return &Task{
+		Name:        testTaskName,
+		Script:      filename,
+		Dir:         wd,
+		Store:       roadie.NewLocalStorage(filepath.Join(dir, "store")),
+		Debug:       ioutil.Discard,
+		Checkpoint:  filepath.Join(dir, "checkpoint.json"),
+		Docker:      docker,
+		Diagnostics: roadie.NewDiagnostics(),
+	}
+
+}
+
+// taskStatus reads the status file of the test task from a storage in a given
+// directory.
+func taskStatus(t *testing.T, dir string) (res roadie.TaskStatus) {
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "store", roadie.LogContainer, testTaskName+"-status.json"))
+	if err != nil {
+		t.Fatalf("cannot read the status file: %v", err)
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		t.Fatalf("cannot parse the status file: %v", err)
+	}
+	return
+
+}
+
+// waitClosed waits until a given channel is closed.
+func waitClosed(t *testing.T, ch <-chan struct{}, msg string) {
+
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatal(msg)
+	}
+
+}
+
+// bundleFiles returns names of files in a given diagnostics bundle.
+func bundleFiles(t *testing.T, diag *roadie.Diagnostics) (names []string) {
+
+	var buf bytes.Buffer
+	if _, err := diag.WriteTo(&buf); err != nil {
+		t.Fatalf("cannot create a diagnostics bundle: %v", err)
+	}
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("cannot read the diagnostics bundle: %v", err)
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("cannot read the diagnostics bundle: %v", err)
+		}
+		names = append(names, h.Name)
+	}
+
+}
+
+func TestTaskDiagnostics(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := roadie.NewLocalStorage(dir)
+	bundle := filepath.Join(dir, roadie.LogContainer, testTaskName+"-diagnostics.tar.gz")
+	for _, c := range []struct {
+		diag   *roadie.Diagnostics
+		upload bool
+	}{
+		{nil, true},
+		{roadie.NewDiagnostics(), false},
+	} {
+		os.Remove(bundle)
+		task := &Task{
+			Name:        testTaskName,
+			Script:      filepath.Join(dir, "not-existing.yml"),
+			Dir:         dir,
+			Store:       store,
+			Debug:       ioutil.Discard,
+			Diagnostics: c.diag,
+		}
+		if err = task.Run(context.Background()); err == nil {
+			t.Fatal("running a task without a script doesn't return any errors")
+		}
+
+		_, err = os.Stat(bundle)
+		if c.upload && err != nil {
+			t.Errorf("the diagnostics bundle isn't uploaded: %v", err)
+		} else if !c.upload && err == nil {
+			t.Error("the diagnostics bundle is uploaded though the caller uploads it")
+		}
+		if c.diag != nil {
+			found := false
+			for _, name := range bundleFiles(t, c.diag) {
+				found = found || name == "log-tail.txt"
+			}
+			if !found {
+				t.Error("the diagnostics bundle doesn't have the log tail")
+			}
+		}
+	}
+
+}
+
+func TestTaskRun(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	docker := dockertest.NewDocker()
+	docker.Behavior = entrypoint([]int{0, 0}, -1, nil)
+	task := newTestTask(t, dir, docker, 2)
+	if err = task.Run(context.Background()); err != nil {
+		t.Fatalf("Run returns an error: %v", err)
+	}
+	if task.Failed() {
+		t.Error("the task failed")
+	}
+
+	for i := 0; i != 2; i++ {
+		name := filepath.Join(dir, "store", roadie.ResultContainer, "test", fmt.Sprintf("stdout%v.txt", i))
+		if _, err = os.Stat(name); err != nil {
+			t.Errorf("stdout file of step %v isn't uploaded: %v", i, err)
+		}
+	}
+	log, err := ioutil.ReadFile(filepath.Join(dir, "store", roadie.LogContainer, testTaskName+".log"))
+	if err != nil {
+		t.Fatalf("cannot read the log file: %v", err)
+	}
+	if !strings.Contains(string(log), "running step 1") {
+		t.Errorf("outputs of the container aren't logged: %q", log)
+	}
+	status := taskStatus(t, dir)
+	if status.Outcome != roadie.OutcomeSucceeded || status.ExitCode == nil || *status.ExitCode != 0 {
+		t.Errorf("status is %+v, want a succeeded task", status)
+	}
+	if _, err = os.Stat(task.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of a finished task remains: %v", err)
+	}
+	for _, c := range docker.Containers() {
+		if docker.Container(c.ID) != nil {
+			t.Errorf("container %v isn't removed", c.Name)
+		}
+	}
+
+}
+
+func TestTaskRunExitStatus(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	docker := dockertest.NewDocker()
+	docker.Behavior = entrypoint([]int{0, 3, 0}, -1, nil)
+	task := newTestTask(t, dir, docker, 3)
+	err = task.Run(context.Background())
+	if exitErr, ok := err.(*roadie.ExitError); !ok || exitErr.Code != 3 {
+		t.Errorf("Run returns %v, want an exit error of code 3", err)
+	}
+
+	status := taskStatus(t, dir)
+	if status.Outcome != roadie.OutcomeFailed || status.ExitCode == nil || *status.ExitCode != 3 {
+		t.Errorf("status is %+v, want a task failed with code 3", status)
+	}
+	if len(status.Steps) != 3 || status.Steps[1].ExitCode == nil || *status.Steps[1].ExitCode != 3 || status.Steps[2].Start != nil {
+		t.Errorf("steps are %+v, want the second step failed", status.Steps)
+	}
+
+}
+
+func TestTaskRunCancelMarker(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer setDuration(&roadie.CancelCheckInterval, 10*time.Millisecond)()
+
+	waiting := make(chan struct{})
+	docker := dockertest.NewDocker()
+	docker.Behavior = entrypoint([]int{0, 0}, 1, waiting)
+	task := newTestTask(t, dir, docker, 2)
+	go func() {
+		<-waiting
+		task.Store.Upload(context.Background(), roadie.StartupContainer, roadie.CancelMarker(testTaskName), strings.NewReader(""), "")
+	}()
+	if err = task.Run(context.Background()); err == nil {
+		t.Error("Run doesn't return any errors though the task is canceled")
+	}
+
+	// A canceled task won't resume; the checkpoint and the task directory
+	// are discarded.
+	if status := taskStatus(t, dir); status.Outcome != roadie.OutcomeCancelled {
+		t.Errorf("outcome is %v, want %v", status.Outcome, roadie.OutcomeCancelled)
+	}
+	if _, err = os.Stat(task.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of a canceled task remains: %v", err)
+	}
+	containers := docker.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("%v containers are created, want 1", len(containers))
+	}
+	if _, err = os.Stat(containers[0].Mount(roadie.ContainerResultDir)); !os.IsNotExist(err) {
+		t.Errorf("task directory of a canceled task remains: %v", err)
+	}
+
+}
+
+func TestTaskRunResume(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The first execution is interrupted while running the second step.
+	waiting := make(chan struct{})
+	docker := dockertest.NewDocker()
+	docker.Behavior = entrypoint([]int{0, 0, 0}, 1, waiting)
+	task := newTestTask(t, dir, docker, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-waiting
+		cancel()
+	}()
+	if err = task.Run(ctx); err == nil {
+		t.Error("Run doesn't return any errors though the task is interrupted")
+	}
+	waitClosed(t, waiting, "the second step doesn't run")
+	if _, err = os.Stat(task.Checkpoint); err != nil {
+		t.Fatalf("checkpoint of an interrupted task doesn't exist: %v", err)
+	}
+
+	// The second execution resumes from the second step.
+	docker.Behavior = entrypoint([]int{0, 0, 0}, -1, nil)
+	task = newTestTask(t, dir, docker, 3)
+	if err = task.Run(context.Background()); err != nil {
+		t.Fatalf("Run returns an error: %v", err)
+	}
+	containers := docker.Containers()
+	if len(containers) != 2 {
+		t.Fatalf("%v containers are created, want 2", len(containers))
+	}
+	if first := containers[1].Env(roadie.FirstStepEnv); first != "1" {
+		t.Errorf("resumed container starts from step %q, want 1", first)
+	}
+	for i := 0; i != 3; i++ {
+		name := filepath.Join(dir, "store", roadie.ResultContainer, "test", fmt.Sprintf("stdout%v.txt", i))
+		if _, err = os.Stat(name); err != nil {
+			t.Errorf("stdout file of step %v isn't uploaded: %v", i, err)
+		}
+	}
+	if status := taskStatus(t, dir); status.Outcome != roadie.OutcomeSucceeded {
+		t.Errorf("outcome is %v, want %v", status.Outcome, roadie.OutcomeSucceeded)
+	}
+	if _, err = os.Stat(task.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of a finished task remains: %v", err)
+	}
+
+}
+
+func TestTaskRunMatrix(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each combination writes its output to the shared working directory.
+	docker := dockertest.NewDocker()
+	run := entrypoint([]int{0}, -1, nil)
+	docker.Behavior = func(c *dockertest.Container) int {
+		id := c.Env(roadie.CombinationEnv)
+		output := filepath.Join(c.Mount("/data"), fmt.Sprintf("out-%v.txt", id))
+		if err := ioutil.WriteFile(output, []byte(id), 0644); err != nil {
+			return 1
+		}
+		return run(c)
+	}
+	task := newTestTask(t, dir, docker, 1, "matrix:", "  p: [a, b]", "upload:", "  - \"*.txt\"")
+	if err = task.Run(context.Background()); err != nil {
+		t.Fatalf("Run returns an error: %v", err)
+	}
+
+	for _, id := range []string{"0", "1"} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, "store", roadie.ResultContainer, "test", id))
+		if err != nil {
+			t.Fatalf("cannot read results of combination %v: %v", id, err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		if expect := []string{fmt.Sprintf("out-%v.txt", id), "stdout0.txt"}; !reflect.DeepEqual(names, expect) {
+			t.Errorf("results of combination %v are %v, want %v", id, names, expect)
+		}
+	}
+
+}
+
+func TestTaskRunCheckpointOutsideWorkspace(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The task is interrupted so that the checkpoint is kept.
+	waiting := make(chan struct{})
+	docker := dockertest.NewDocker()
+	docker.Behavior = entrypoint([]int{0, 0}, 1, waiting)
+	task := newTestTask(t, dir, docker, 2, "upload:", "  - \"*.json\"")
+	task.Checkpoint = checkpointPath(filepath.Base(dir))
+	defer os.Remove(task.Checkpoint)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-waiting
+		cancel()
+	}()
+	task.Run(ctx)
+	if _, err = os.Stat(task.Checkpoint); err != nil {
+		t.Fatalf("checkpoint of an interrupted task doesn't exist: %v", err)
+	}
+
+	// exec runs tasks in the current directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("cannot get the working directory: %v", err)
+	}
+	sources := []string{wd}
+	for _, m := range docker.Containers()[0].Host.Mounts {
+		sources = append(sources, m.Source)
+	}
+	for _, v := range sources {
+		if rel, err := filepath.Rel(v, task.Checkpoint); err == nil && !strings.HasPrefix(rel, "..") {
+			t.Errorf("checkpoint %v is in %v, which is mounted to the sandbox container", task.Checkpoint, v)
+		}
+	}
+	filepath.Walk(filepath.Join(dir, "store", roadie.ResultContainer), func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == ".json" {
+			t.Errorf("checkpoint is uploaded as a result file: %v", path)
+		}
+		return nil
+	})
+
+}
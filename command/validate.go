@@ -0,0 +1,54 @@
+//
+// command/validate.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"fmt"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+	"github.com/urfave/cli"
+)
+
+// CmdValidate defines the action for the validate command; it prints problems
+// found in a given script file and returns an error if any.
+func CmdValidate(c *cli.Context) (err error) {
+
+	if c.NArg() != 1 {
+		fmt.Printf("expected 1 argument but %d given\n", c.NArg())
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	filename := c.Args().First()
+	problems, err := roadie.ValidateScript(filename)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	for _, p := range problems {
+		fmt.Printf("%v: %v\n", filename, p)
+	}
+	if len(problems) != 0 {
+		return cli.NewExitError(fmt.Sprintf("%v problems are found", len(problems)), 1)
+	}
+	fmt.Println(filename, "is valid")
+	return
+
+}
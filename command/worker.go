@@ -0,0 +1,256 @@
+//
+// command/worker.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+	"github.com/jkawamoto/roadie/cloud/azure"
+	"github.com/urfave/cli"
+)
+
+const (
+	// DefaultQueuePrefix defines the default prefix of blobs in the queue.
+	DefaultQueuePrefix = "queue/"
+	// WorkerScriptFile defines the name of a claimed script file in the
+	// workspace of a task.
+	WorkerScriptFile = "script.yml"
+)
+
+var (
+	// WorkerPollInterval defines how often an empty queue is checked.
+	WorkerPollInterval = 30 * time.Second
+)
+
+// Worker defines arguments used in worker command.
+type Worker struct {
+	Config string
+	// Queue is a local directory of script files; if empty, blobs having
+	// Prefix in the startup container are used.
+	Queue  string
+	Prefix string
+	// IdleTimeout defines how long the worker waits for new script files when
+	// the queue is empty; if zero, the worker stops at once.
+	IdleTimeout time.Duration
+	// Concurrency is the number of tasks running at once; CPUs and memory
+	// are split between them.
+	Concurrency int
+	// Secrets is the name of an optional file defining secrets.
+	Secrets string
+	// LogFormat is either LogFormatText or LogFormatJSON.
+	LogFormat string
+}
+
+// run processes script files in the queue one by one.
+func (w *Worker) run() (err error) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg, err := azure.NewConfigFromFile(w.Config)
+	if err != nil {
+		return
+	}
+	ext, err := NewConfig(w.Config)
+	if err != nil {
+		return
+	}
+	secrets, err := ext.LoadSecrets(w.Secrets)
+	if err != nil {
+		return
+	}
+	logger := log.New(roadie.NewMaskedWriter(os.Stderr, secrets.Values()), "", log.LstdFlags|log.LUTC)
+
+	// The token is refreshed until all tasks finish.
+	tokenCtx, cancelToken := context.WithCancel(context.Background())
+	defer cancelToken()
+	store, err := ext.NewStorage(tokenCtx, cfg, logger)
+	if err != nil {
+		return
+	}
+
+	var queue roadie.Queue
+	if w.Queue != "" {
+		queue = roadie.NewDirQueue(w.Queue)
+	} else if azureStore, ok := store.(*roadie.AzureStorage); ok {
+		queue = roadie.NewBlobQueue(azureStore, w.Prefix)
+	} else {
+		return fmt.Errorf("Blob queues require the Azure storage; give a queue directory")
+	}
+
+	// Stop the worker when receiving SIGTERM or SIGINT; the running task is
+	// canceled and its script file is returned to the queue.
+	defer cancelOnSignal(cancel, logger)()
+
+	shares, err := roadie.PartitionResources(w.Concurrency)
+	if err != nil {
+		return
+	}
+	errs := make(chan error, len(shares))
+	for _, share := range shares {
+		share := share
+		if w.Concurrency > 1 {
+			logger.Printf("Starting a runner with CPUs %v and %v bytes of memory", share.CPUSet, share.Memory)
+		}
+		go func() {
+			errs <- serve(ctx, queue, w.IdleTimeout, logger, func(ctx context.Context, item roadie.QueueItem) error {
+				return w.runTask(ctx, item, store, secrets, share)
+			})
+		}()
+	}
+	for range shares {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+
+}
+
+// runTask runs a claimed script file in a fresh workspace with a given share
+// of resources.
+func (w *Worker) runTask(ctx context.Context, item roadie.QueueItem, store roadie.Storage, secrets roadie.Secrets, share roadie.ResourceShare) (err error) {
+
+	workspace, err := ioutil.TempDir("", "roadie-worker-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(workspace)
+
+	filename := filepath.Join(workspace, WorkerScriptFile)
+	if err = copyQueueItem(ctx, item, filename); err != nil {
+		return
+	}
+
+	task := &Task{
+		Name:      item.Name(),
+		Script:    filename,
+		Dir:       workspace,
+		Resources: share,
+		Secrets:   secrets,
+		LogFormat: w.LogFormat,
+		Store:     store,
+		Debug:     os.Stderr,
+	}
+	return task.Run(ctx)
+
+}
+
+// copyQueueItem copies a claimed script file to a given named file.
+func copyQueueItem(ctx context.Context, item roadie.QueueItem, filename string) (err error) {
+
+	r, err := item.Open(ctx)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	fp, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	_, err = io.Copy(fp, r)
+	return
+
+}
+
+// serve claims script files from a given queue and processes them with a given
+// handler one by one. It returns when the queue has been empty for the idle
+// timeout or the context is canceled. Processed script files are removed from
+// the queue even if the handler fails, but they are returned to the queue if
+// the context is canceled.
+func serve(ctx context.Context, queue roadie.Queue, idleTimeout time.Duration, logger *log.Logger, handler func(context.Context, roadie.QueueItem) error) (err error) {
+
+	idle := time.Now()
+	for {
+
+		var item roadie.QueueItem
+		item, err = queue.Claim(ctx)
+		if err != nil {
+			// Errors in claiming can be temporal; treat the queue as empty.
+			logger.Println("Cannot claim a script file:", err)
+		}
+
+		if item == nil {
+			if time.Since(idle) >= idleTimeout {
+				logger.Println("Queue is empty; stopping the worker")
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(WorkerPollInterval):
+			}
+			continue
+		}
+
+		logger.Println("Claimed a script file:", item.Name())
+		if err = handler(ctx, item); err != nil {
+			logger.Printf("Task %v failed: %v", item.Name(), err)
+		} else {
+			logger.Println("Task", item.Name(), "finished")
+		}
+
+		if ctx.Err() != nil {
+			if err = item.Release(context.Background()); err != nil {
+				logger.Println("Cannot release a script file:", err)
+			}
+			return ctx.Err()
+		}
+		if err = item.Done(ctx); err != nil {
+			logger.Println("Cannot remove a script file from the queue:", err)
+		}
+		idle = time.Now()
+
+	}
+
+}
+
+// CmdWorker defines the action for the worker command.
+func CmdWorker(c *cli.Context) (err error) {
+
+	if c.NArg() != 1 {
+		fmt.Printf("expected 1 argument but %d given\n", c.NArg())
+		return cli.ShowSubcommandHelp(c)
+	}
+
+	w := &Worker{
+		Config:      c.Args().First(),
+		Queue:       c.String("queue"),
+		Prefix:      c.String("prefix"),
+		IdleTimeout: c.Duration("idle-timeout"),
+		Concurrency: c.Int("concurrency"),
+		Secrets:     c.String("secrets"),
+		LogFormat:   c.String("log-format"),
+	}
+	return w.run()
+
+}
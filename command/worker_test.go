@@ -0,0 +1,105 @@
+//
+// command/worker_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie-azure/roadie"
+)
+
+func TestServe(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"task-1.yml", "task-2.yml"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("cannot create a file: %v", err)
+		}
+	}
+
+	defer setDuration(&WorkerPollInterval, 10*time.Millisecond)()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	var names []string
+	handler := func(ctx context.Context, item roadie.QueueItem) error {
+		names = append(names, item.Name())
+		if len(names) == 1 {
+			// A script added while the worker is running will be processed.
+			return ioutil.WriteFile(filepath.Join(dir, "task-3.yml"), nil, 0644)
+		}
+		return nil
+	}
+	err = serve(context.Background(), roadie.NewDirQueue(dir), 50*time.Millisecond, logger, handler)
+	if err != nil {
+		t.Fatalf("serve returns an error: %v", err)
+	}
+	if expect := []string{"task-1", "task-2", "task-3"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("processed tasks are %v, want %v", names, expect)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("cannot read the queue: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("processed scripts remain in the queue: %v", files)
+	}
+
+}
+
+func TestServeCancel(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "task.yml")
+	if err = ioutil.WriteFile(filename, nil, 0644); err != nil {
+		t.Fatalf("cannot create a file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = serve(ctx, roadie.NewDirQueue(dir), time.Hour, log.New(ioutil.Discard, "", 0), func(ctx context.Context, item roadie.QueueItem) error {
+		cancel()
+		return ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Errorf("serve returns %v, want %v", err, context.Canceled)
+	}
+	// The canceled script must be returned to the queue.
+	if _, err = os.Stat(filename); err != nil {
+		t.Errorf("canceled script isn't returned to the queue: %v", err)
+	}
+
+}
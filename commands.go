@@ -45,6 +45,100 @@ var Commands = []cli.Command{
 		Usage:     "execute the given script under the given configuration",
 		ArgsUsage: "<config file> <script file> <instance name>",
 		Action:    command.CmdExec,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "secrets",
+				Usage: "YAML file which defines secrets referred from the script",
+			},
+			cli.StringFlag{
+				Name:  "log-format",
+				Usage: "format of logs: text or json",
+				Value: "text",
+			},
+			cli.StringFlag{
+				Name:  "events-url",
+				Usage: "scheduled events endpoint watched for evictions; the Azure endpoint is watched by default if the Azure storage is used",
+			},
+			cli.StringFlag{
+				Name:  "vm-name",
+				Usage: "name of this virtual machine in scheduled events; obtained from the instance metadata service by default",
+			},
+			cli.StringFlag{
+				Name:  "eviction-signal",
+				Usage: "signal sent to the sandbox container when an eviction is scheduled",
+				Value: command.DefaultEvictionSignal,
+			},
+		},
+	},
+	{
+		Name:      "run",
+		Usage:     "execute the given script on this machine without Azure",
+		ArgsUsage: "<script file>",
+		Action:    command.CmdRun,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "directory where result files are stored",
+				Value: command.DefaultOutputDir,
+			},
+			cli.StringFlag{
+				Name:  "secrets",
+				Usage: "YAML file which defines secrets referred from the script",
+			},
+		},
+	},
+	{
+		Name:      "validate",
+		Usage:     "check the given script before submitting it",
+		ArgsUsage: "<script file>",
+		Action:    command.CmdValidate,
+	},
+	{
+		Name:      "render",
+		Usage:     "print the Dockerfile, entrypoint.sh, and build context generated from the given script",
+		ArgsUsage: "<script file>",
+		Action:    command.CmdRender,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "directory where the build context is written",
+			},
+		},
+	},
+	{
+		Name:      "worker",
+		Usage:     "execute scripts in a queue one by one",
+		ArgsUsage: "<config file>",
+		Action:    command.CmdWorker,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "queue",
+				Usage: "local directory of script files; if not given, blobs in the startup container are used",
+			},
+			cli.StringFlag{
+				Name:  "prefix",
+				Usage: "prefix of script blobs in the startup container",
+				Value: command.DefaultQueuePrefix,
+			},
+			cli.DurationFlag{
+				Name:  "idle-timeout",
+				Usage: "how long to wait for new scripts when the queue is empty",
+			},
+			cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "number of scripts executed at once; CPUs and memory are split between them",
+				Value: 1,
+			},
+			cli.StringFlag{
+				Name:  "secrets",
+				Usage: "YAML file which defines secrets referred from scripts",
+			},
+			cli.StringFlag{
+				Name:  "log-format",
+				Usage: "format of logs: text or json",
+				Value: "text",
+			},
+		},
 	},
 }
 
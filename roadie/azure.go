@@ -0,0 +1,246 @@
+//
+// roadie/azure.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+)
+
+const (
+	// MaxAppendBlocks defines the maximum number of blocks in an append blob.
+	MaxAppendBlocks = 50000
+	// appendPositionConditionNotMet is the error code returned when the
+	// append position of a block doesn't match the size of the blob.
+	appendPositionConditionNotMet = "AppendPositionConditionNotMet"
+)
+
+// AzureStorage is a storage using Azure Blob storage; containers are blob
+// containers.
+type AzureStorage struct {
+	provider StorageProvider
+
+	// appends keeps append blobs written by Append; keys are pairs of a
+	// container and a name.
+	mutex   sync.Mutex
+	appends map[string]*appendBlob
+}
+
+// appendBlob is the state of an append blob written by Append.
+type appendBlob struct {
+	// name is the name of the blob, which has a suffix if part isn't 0.
+	name     string
+	part     int
+	position uint
+	blocks   int
+}
+
+// NewAzureStorage creates a new storage; the storage service is taken from a
+// given provider for every operation so that renewed credentials are used.
+func NewAzureStorage(provider StorageProvider) *AzureStorage {
+	return &AzureStorage{
+		provider: provider,
+	}
+}
+
+// Upload stores a file as a block blob.
+func (s *AzureStorage) Upload(ctx context.Context, container, name string, in io.Reader, contentType string) error {
+
+	var props *storage.BlobProperties
+	if contentType != "" {
+		props = &storage.BlobProperties{
+			ContentType: contentType,
+		}
+	}
+	return s.provider.StorageService().UploadWithMetadata(ctx, container, name, in, props, nil)
+
+}
+
+// Append appends given data to an append blob. The blob is created when data
+// are appended to it for the first time in this process; if the blob exists,
+// which an interrupted execution has written, or it reaches MaxAppendBlocks,
+// appending continues to a new blob named with a suffix ".1", ".2", and so on.
+func (s *AzureStorage) Append(ctx context.Context, container, name string, data []byte, contentType string) (err error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.appends == nil {
+		s.appends = make(map[string]*appendBlob)
+	}
+	key := container + "/" + name
+	state := s.appends[key]
+	if state == nil || state.blocks == MaxAppendBlocks {
+		part := 0
+		if state != nil {
+			part = state.part + 1
+		}
+		err = withContext(ctx, func() (err error) {
+			state, err = s.createAppendBlob(container, name, part, contentType)
+			return
+		})
+		if err != nil {
+			return
+		}
+		s.appends[key] = state
+	}
+
+	// The condition on the append position prevents a retried block from
+	// being appended twice.
+	blob := s.blob(container, state.name)
+	position := state.position
+	err = withContext(ctx, func() (err error) {
+		err = blob.AppendBlock(data, &storage.AppendBlockOptions{
+			AppendPosition: &position,
+		})
+		if err != nil {
+			if e, ok := err.(storage.AzureStorageServiceError); !ok || e.Code != appendPositionConditionNotMet {
+				return
+			}
+			// The block has been appended by the previous request if the
+			// size of the blob matches.
+			if err2 := blob.GetProperties(nil); err2 != nil || blob.Properties.ContentLength != int64(position)+int64(len(data)) {
+				return
+			}
+			err = nil
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	state.position += uint(len(data))
+	state.blocks++
+	return
+
+}
+
+// createAppendBlob creates a new append blob of which the name has a suffix
+// given part or larger if the blob exists.
+func (s *AzureStorage) createAppendBlob(container, name string, part int, contentType string) (state *appendBlob, err error) {
+
+	for ; ; part++ {
+		state = &appendBlob{
+			name: name,
+			part: part,
+		}
+		if part != 0 {
+			state.name = fmt.Sprintf("%v.%v", name, part)
+		}
+		blob := s.blob(container, state.name)
+		var exist bool
+		if exist, err = blob.Exists(); err != nil {
+			return
+		} else if exist {
+			continue
+		}
+		blob.Properties.ContentType = contentType
+		err = blob.PutAppendBlob(nil)
+		return
+	}
+
+}
+
+// Open opens a blob.
+func (s *AzureStorage) Open(ctx context.Context, container, name string) (io.ReadCloser, error) {
+
+	// The reader is used only if the function has returned.
+	var r io.ReadCloser
+	err := withContext(ctx, func() (err error) {
+		r, err = s.blob(container, name).Get(nil)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+
+}
+
+// Delete deletes a blob.
+func (s *AzureStorage) Delete(ctx context.Context, container, name string) error {
+	return withContext(ctx, func() error {
+		return s.blob(container, name).Delete(nil)
+	})
+}
+
+// List calls a given handler with names of blobs having a given prefix.
+func (s *AzureStorage) List(ctx context.Context, container, prefix string, handler func(name string) error) (err error) {
+
+	client := s.provider.StorageService().Client
+	params := storage.ListBlobsParameters{
+		Prefix: prefix,
+	}
+	for {
+		var res storage.BlobListResponse
+		err = withContext(ctx, func() (err error) {
+			res, err = client.GetContainerReference(container).ListBlobs(params)
+			return
+		})
+		if err != nil {
+			return
+		}
+		for _, b := range res.Blobs {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			if err = handler(b.Name); err != nil {
+				return
+			}
+		}
+		if res.NextMarker == "" {
+			return
+		}
+		params.Marker = res.NextMarker
+	}
+
+}
+
+// blob returns a reference of a given blob.
+func (s *AzureStorage) blob(container, name string) *storage.Blob {
+	client := s.provider.StorageService().Client
+	return client.GetContainerReference(container).GetBlobReference(name)
+}
+
+// withContext calls a given function, which doesn't take any contexts, and
+// returns its result or the error of a given context if it is canceled first.
+// The function keeps running in background after the context is canceled.
+func withContext(ctx context.Context, f func() error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+}
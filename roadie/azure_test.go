@@ -0,0 +1,53 @@
+//
+// roadie/azure_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWithContext(t *testing.T) {
+
+	expect := fmt.Errorf("error")
+	if err := withContext(context.Background(), func() error { return expect }); err != expect {
+		t.Errorf("withContext returns %v, want %v", err, expect)
+	}
+
+	// A canceled context stops waiting for a blocked function.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	if err := withContext(ctx, func() error { <-block; return nil }); err != context.DeadlineExceeded {
+		t.Errorf("withContext returns %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The function isn't called with a canceled context.
+	called := false
+	if err := withContext(ctx, func() error { called = true; return nil }); err != context.DeadlineExceeded || called {
+		t.Errorf("withContext returns %v and calls the function: %v", err, called)
+	}
+
+}
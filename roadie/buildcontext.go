@@ -0,0 +1,139 @@
+//
+// roadie/buildcontext.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// ContextDockerfile is the path of the Dockerfile in build contexts.
+	ContextDockerfile = ".roadie/Dockerfile"
+	// ContextEntrypoint is the path of entrypoint.sh in build contexts.
+	ContextEntrypoint = ".roadie/entrypoint.sh"
+)
+
+// ContextFile is a file in the build context of a sandbox image.
+type ContextFile struct {
+	// Name is the slash separated path in the build context.
+	Name string
+	Mode os.FileMode
+	Size int64
+	// Path is the local file of this file; if empty, Data is the body.
+	Path string
+	Data []byte
+}
+
+// String returns a line of a listing of a build context.
+func (f ContextFile) String() string {
+	return fmt.Sprintf("%v %10d %v", f.Mode, f.Size, f.Name)
+}
+
+// BuildContext returns files in the build context defined by a given option;
+// it consists of files in the context root, entrypoint.sh, and Dockerfile.
+func BuildContext(ctx context.Context, opt *DockerBuildOpt) (res []ContextFile, err error) {
+
+	if opt.ContextRoot != "" {
+		err = filepath.Walk(opt.ContextRoot, func(path string, info os.FileInfo, err error) error {
+
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(opt.ContextRoot, path)
+			if err != nil {
+				return err
+			}
+			res = append(res, ContextFile{
+				Name: filepath.ToSlash(rel),
+				Mode: info.Mode(),
+				Size: info.Size(),
+				Path: path,
+			})
+			return nil
+
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if opt.Entrypoint != nil {
+		res = append(res, ContextFile{
+			Name: ContextEntrypoint,
+			Mode: 0744,
+			Size: int64(len(opt.Entrypoint)),
+			Data: opt.Entrypoint,
+		})
+	}
+	res = append(res, ContextFile{
+		Name: ContextDockerfile,
+		Mode: 0744,
+		Size: int64(len(opt.Dockerfile)),
+		Data: opt.Dockerfile,
+	})
+	return
+
+}
+
+// WriteBuildContext writes files in the build context defined by a given
+// option to a given directory so that the image can be built by hand.
+func WriteBuildContext(ctx context.Context, opt *DockerBuildOpt, dir string) (err error) {
+
+	files, err := BuildContext(ctx, opt)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+
+		dest := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return
+		}
+		data := f.Data
+		if f.Path != "" {
+			data, err = ioutil.ReadFile(f.Path)
+			if err != nil {
+				return
+			}
+		}
+		if err = ioutil.WriteFile(dest, data, f.Mode.Perm()); err != nil {
+			return
+		}
+
+	}
+	return
+
+}
@@ -0,0 +1,83 @@
+//
+// roadie/buildcontext_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildContext(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "src")
+	if err = os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatalf("cannot create a directory: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(src, "sub", "main.py"), []byte("print(1)"), 0644); err != nil {
+		t.Fatalf("cannot create a file: %v", err)
+	}
+
+	opt := &DockerBuildOpt{
+		Dockerfile:  []byte("FROM ubuntu"),
+		Entrypoint:  []byte("#!/bin/bash"),
+		ContextRoot: src,
+	}
+	files, err := BuildContext(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("BuildContext returns an error: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if expect := []string{"sub/main.py", ContextEntrypoint, ContextDockerfile}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("build context has %v, want %v", names, expect)
+	}
+
+	out := filepath.Join(root, "out")
+	if err = WriteBuildContext(context.Background(), opt, out); err != nil {
+		t.Fatalf("WriteBuildContext returns an error: %v", err)
+	}
+	expects := map[string]string{
+		"sub/main.py":     "print(1)",
+		ContextEntrypoint: "#!/bin/bash",
+		ContextDockerfile: "FROM ubuntu",
+	}
+	for name, body := range expects {
+		data, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("cannot read %v: %v", name, err)
+		} else if string(data) != body {
+			t.Errorf("%v has %q, want %q", name, data, body)
+		}
+	}
+
+}
@@ -0,0 +1,67 @@
+//
+// roadie/cancel.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var (
+	// CancelCheckInterval defines how often the cancel marker is checked.
+	CancelCheckInterval = 30 * time.Second
+)
+
+// CancelMarker returns the name of a file in the startup container which
+// requests cancelling a given named task.
+func CancelMarker(name string) string {
+	return fmt.Sprintf("%v.cancel", name)
+}
+
+// WaitCancelMarker waits until the cancel marker of a given named task is
+// created in the startup container, and then deletes the marker. It returns
+// nil if the marker is found; otherwise it returns an error of the context.
+// Errors in checking the marker are ignored since they can be temporal.
+func WaitCancelMarker(ctx context.Context, store Storage, name string) (err error) {
+
+	ticker := time.NewTicker(CancelCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		r, err := store.Open(ctx, StartupContainer, CancelMarker(name))
+		if err != nil {
+			continue
+		}
+		r.Close()
+		// Task names are unique, and a remaining marker doesn't affect other
+		// tasks; thus errors in deleting it are ignored.
+		store.Delete(ctx, StartupContainer, CancelMarker(name))
+		return nil
+	}
+
+}
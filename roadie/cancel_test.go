@@ -0,0 +1,69 @@
+//
+// roadie/cancel_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie/cloud/azure"
+)
+
+func TestWaitCancelMarker(t *testing.T) {
+
+	store, server := newMockStorage(t)
+	defer server.Close()
+	defer setDuration(&CancelCheckInterval, 10*time.Millisecond)()
+	var err error
+
+	testName := "test-name"
+
+	// It must wait until the context is done if no markers exist.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*CancelCheckInterval)
+	defer cancel()
+	if err = WaitCancelMarker(ctx, NewAzureStorage(StaticStorage(store)), testName); err != context.DeadlineExceeded {
+		t.Errorf("WaitCancelMarker returns %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- WaitCancelMarker(context.Background(), NewAzureStorage(StaticStorage(store)), testName)
+	}()
+	err = store.UploadWithMetadata(context.Background(), azure.StartupContainer, CancelMarker(testName), strings.NewReader(""), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot create a cancel marker: %v", err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("WaitCancelMarker returns an error: %v", err)
+		}
+	case <-time.After(100 * CancelCheckInterval):
+		t.Fatal("WaitCancelMarker doesn't find the cancel marker")
+	}
+	if _, exist := server.Items[azure.StartupContainer][CancelMarker(testName)]; exist {
+		t.Error("the cancel marker isn't deleted")
+	}
+
+}
@@ -0,0 +1,358 @@
+//
+// roadie/checkpoint.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	// FirstStepEnv is the environment variable telling the entrypoint of a
+	// sandbox container the index of the first run step to execute; steps
+	// before it finished in an interrupted execution.
+	FirstStepEnv = "ROADIE_FIRST_STEP"
+)
+
+// RunCheckpoint defines the progress of a run of a script, i.e. the run of
+// the script itself or of a combination of parameters.
+type RunCheckpoint struct {
+	// Image is the name of the built sandbox image.
+	Image string `json:"image,omitempty"`
+	// TaskDir is the path to the task directory which has stdout files.
+	TaskDir string `json:"task_dir,omitempty"`
+	// Steps are indexes of run steps which finished without errors.
+	Steps []int `json:"steps,omitempty"`
+	// Uploaded is true if the result files were uploaded.
+	Uploaded bool `json:"uploaded,omitempty"`
+}
+
+// Checkpoint records completed phases of a task in a local file so that an
+// interrupted task can resume from the last completed phase. Every update is
+// written to the file immediately; if the file name is empty, the checkpoint
+// is kept only in memory.
+type Checkpoint struct {
+	// Name is the name of the task.
+	Name string `json:"name"`
+	// Script is the SHA-256 hash of the script file; a checkpoint of another
+	// script is discarded.
+	Script string `json:"script"`
+	// Phases maps completed phases, i.e. PhaseSource and PhaseData, to
+	// entries in the working directory after the phase completed.
+	Phases map[string][]string `json:"phases,omitempty"`
+	// Runs maps labels of runs to their progress.
+	Runs map[string]*RunCheckpoint `json:"runs,omitempty"`
+
+	filename string
+	mutex    sync.Mutex
+}
+
+// LoadCheckpoint reads a checkpoint of a given named task from a file; if the
+// file doesn't exist or it was written for another task or another script, a
+// new checkpoint is returned.
+func LoadCheckpoint(filename, name string, script []byte) (c *Checkpoint, err error) {
+
+	hash := sha256.Sum256(script)
+	c = &Checkpoint{
+		Name:     name,
+		Script:   hex.EncodeToString(hash[:]),
+		Phases:   make(map[string][]string),
+		Runs:     make(map[string]*RunCheckpoint),
+		filename: filename,
+	}
+	if filename == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var prev Checkpoint
+	if err = json.Unmarshal(data, &prev); err != nil {
+		return nil, err
+	}
+	if prev.Name != c.Name || prev.Script != c.Script {
+		return
+	}
+	if prev.Phases != nil {
+		c.Phases = prev.Phases
+	}
+	if prev.Runs != nil {
+		c.Runs = prev.Runs
+	}
+	return
+
+}
+
+// Resumed returns true if this checkpoint has any completed phases.
+func (c *Checkpoint) Resumed() bool {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.Phases) != 0 || len(c.Runs) != 0
+
+}
+
+// Complete records a phase is completed with entries in a given directory.
+func (c *Checkpoint) Complete(phase, dir string) (err error) {
+
+	entries, err := dirEntries(dir)
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Phases[phase] = entries
+	return c.save()
+
+}
+
+// Completed returns true if a given phase was completed and all entries the
+// phase left in a given directory still exist.
+func (c *Checkpoint) Completed(phase, dir string) bool {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entries, ok := c.Phases[phase]
+	if !ok {
+		return false
+	}
+	for _, name := range entries {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+
+}
+
+// Run returns a copy of the progress of a given labeled run.
+func (c *Checkpoint) Run(label string) (res RunCheckpoint) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if r, ok := c.Runs[label]; ok {
+		res = *r
+		res.Steps = append([]int(nil), r.Steps...)
+	}
+	return
+
+}
+
+// SetImage records the sandbox image of a given labeled run was built.
+func (c *Checkpoint) SetImage(label, image string) error {
+	return c.update(label, func(r *RunCheckpoint) {
+		r.Image = image
+	})
+}
+
+// SetTaskDir records the task directory of a given labeled run.
+func (c *Checkpoint) SetTaskDir(label, dir string) error {
+	return c.update(label, func(r *RunCheckpoint) {
+		r.TaskDir = dir
+	})
+}
+
+// FinishStep records a run step of a given labeled run finished without
+// errors.
+func (c *Checkpoint) FinishStep(label string, index int) error {
+	return c.update(label, func(r *RunCheckpoint) {
+		for _, v := range r.Steps {
+			if v == index {
+				return
+			}
+		}
+		r.Steps = append(r.Steps, index)
+		sort.Ints(r.Steps)
+	})
+}
+
+// SetUploaded records result files of a given labeled run were uploaded.
+func (c *Checkpoint) SetUploaded(label string) error {
+	return c.update(label, func(r *RunCheckpoint) {
+		r.Uploaded = true
+	})
+}
+
+// FirstStep returns the index of the first run step of a given labeled run
+// which needs to be executed; steps before it finished and their stdout files
+// still exist in a given result directory.
+func (c *Checkpoint) FirstStep(label, resultDir string) (index int) {
+
+	r := c.Run(label)
+	for _, v := range r.Steps {
+		if v != index {
+			break
+		}
+		if _, err := os.Stat(filepath.Join(resultDir, fmt.Sprintf("stdout%v.txt", v))); err != nil {
+			break
+		}
+		index++
+	}
+	return
+
+}
+
+// Observer returns a step observer which records finished run steps of a
+// given labeled run.
+func (c *Checkpoint) Observer(label string) StepObserver {
+	return &checkpointObserver{
+		checkpoint: c,
+		label:      label,
+	}
+}
+
+// Upload stores this checkpoint as a given named file in the log container
+// so that it's kept after this machine is evicted.
+func (c *Checkpoint) Upload(ctx context.Context, store Storage, name string) (err error) {
+
+	c.mutex.Lock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mutex.Unlock()
+	if err != nil {
+		return
+	}
+	return store.Upload(ctx, LogContainer, name, bytes.NewReader(data), "application/json")
+
+}
+
+// Remove deletes the checkpoint file.
+func (c *Checkpoint) Remove() (err error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.filename == "" {
+		return
+	}
+	err = os.Remove(c.filename)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+
+}
+
+// update modifies the progress of a given labeled run and saves it.
+func (c *Checkpoint) update(label string, f func(r *RunCheckpoint)) error {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.Runs[label]
+	if !ok {
+		r = new(RunCheckpoint)
+		c.Runs[label] = r
+	}
+	f(r)
+	return c.save()
+
+}
+
+// save writes this checkpoint to the file; the caller must hold the mutex.
+func (c *Checkpoint) save() (err error) {
+
+	if c.filename == "" {
+		return
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// Write to a temporary file and rename it so that a crash never leaves
+	// a broken checkpoint.
+	fp, err := ioutil.TempFile(filepath.Dir(c.filename), ".checkpoint-")
+	if err != nil {
+		return
+	}
+	_, err = fp.Write(data)
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), c.filename)
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+	}
+	return
+
+}
+
+// checkpointObserver records run steps finished without errors.
+type checkpointObserver struct {
+	checkpoint *Checkpoint
+	label      string
+}
+
+// BeginStep does nothing.
+func (o *checkpointObserver) BeginStep(index int) {}
+
+// EndStep records the step if it finished without errors.
+func (o *checkpointObserver) EndStep(index, code int) {
+	if code == 0 {
+		o.checkpoint.FinishStep(o.label, index)
+	}
+}
+
+// StepObservers notifies all observers in it.
+type StepObservers []StepObserver
+
+// BeginStep notifies the beginning of a step.
+func (s StepObservers) BeginStep(index int) {
+	for _, o := range s {
+		o.BeginStep(index)
+	}
+}
+
+// EndStep notifies the end of a step.
+func (s StepObservers) EndStep(index, code int) {
+	for _, o := range s {
+		o.EndStep(index, code)
+	}
+}
+
+// dirEntries returns sorted names of entries in a given directory.
+func dirEntries(dir string) (names []string, err error) {
+
+	fp, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	names, err = fp.Readdirnames(-1)
+	sort.Strings(names)
+	return
+
+}
@@ -0,0 +1,184 @@
+//
+// roadie/checkpoint_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir returns an error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "checkpoint.json")
+	script := []byte("run:\n  - echo abc\n")
+
+	c, err := LoadCheckpoint(filename, "task", script)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint returns an error: %v", err)
+	}
+	if c.Resumed() {
+		t.Error("a new checkpoint is resumed")
+	}
+	if c.Completed(PhaseSource, dir) {
+		t.Error("source phase is completed in a new checkpoint")
+	}
+
+	wd := filepath.Join(dir, "wd")
+	if err = os.Mkdir(wd, 0755); err != nil {
+		t.Fatalf("Mkdir returns an error: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(wd, "main.py"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile returns an error: %v", err)
+	}
+	if err = c.Complete(PhaseSource, wd); err != nil {
+		t.Fatalf("Complete returns an error: %v", err)
+	}
+	if err = c.SetImage("task", "image:task"); err != nil {
+		t.Fatalf("SetImage returns an error: %v", err)
+	}
+	results := filepath.Join(dir, "results")
+	if err = c.SetTaskDir("task", results); err != nil {
+		t.Fatalf("SetTaskDir returns an error: %v", err)
+	}
+	observer := StepObservers{c.Observer("task")}
+	for i, code := range []int{0, 0, 1} {
+		observer.BeginStep(i)
+		observer.EndStep(i, code)
+	}
+
+	// Load the saved checkpoint.
+	c, err = LoadCheckpoint(filename, "task", script)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint returns an error: %v", err)
+	}
+	if !c.Resumed() {
+		t.Error("a saved checkpoint isn't resumed")
+	}
+	if !c.Completed(PhaseSource, wd) {
+		t.Error("source phase isn't completed")
+	}
+	if c.Completed(PhaseData, wd) {
+		t.Error("data phase is completed")
+	}
+	run := c.Run("task")
+	if run.Image != "image:task" || run.TaskDir != results || run.Uploaded {
+		t.Errorf("progress of the run is %+v", run)
+	}
+	if len(run.Steps) != 2 || run.Steps[0] != 0 || run.Steps[1] != 1 {
+		t.Errorf("finished steps are %v, want [0 1]", run.Steps)
+	}
+
+	// Steps whose stdout files don't exist need to run again.
+	if first := c.FirstStep("task", results); first != 0 {
+		t.Errorf("first step is %v, want 0", first)
+	}
+	if err = os.Mkdir(results, 0755); err != nil {
+		t.Fatalf("Mkdir returns an error: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(results, "stdout0.txt"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile returns an error: %v", err)
+	}
+	if first := c.FirstStep("task", results); first != 1 {
+		t.Errorf("first step is %v, want 1", first)
+	}
+	if err = ioutil.WriteFile(filepath.Join(results, "stdout1.txt"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile returns an error: %v", err)
+	}
+	if first := c.FirstStep("task", results); first != 2 {
+		t.Errorf("first step is %v, want 2", first)
+	}
+
+	// The phase needs to run again if its outputs were removed.
+	if err = os.Remove(filepath.Join(wd, "main.py")); err != nil {
+		t.Fatalf("Remove returns an error: %v", err)
+	}
+	if c.Completed(PhaseSource, wd) {
+		t.Error("source phase is completed though its outputs were removed")
+	}
+
+	// A checkpoint of another script is discarded.
+	c, err = LoadCheckpoint(filename, "task", []byte("run:\n  - echo def\n"))
+	if err != nil {
+		t.Fatalf("LoadCheckpoint returns an error: %v", err)
+	}
+	if c.Resumed() {
+		t.Error("a checkpoint of another script is resumed")
+	}
+
+	if err = c.Remove(); err != nil {
+		t.Fatalf("Remove returns an error: %v", err)
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file %v still exists", filename)
+	}
+	if err = c.Remove(); err != nil {
+		t.Errorf("Remove returns an error if the file doesn't exist: %v", err)
+	}
+
+}
+
+func TestCheckpointInMemory(t *testing.T) {
+
+	c, err := LoadCheckpoint("", "task", nil)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint returns an error: %v", err)
+	}
+	if err = c.SetUploaded("task"); err != nil {
+		t.Fatalf("SetUploaded returns an error: %v", err)
+	}
+	if !c.Run("task").Uploaded {
+		t.Error("uploaded run isn't recorded")
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir returns an error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = c.Upload(context.Background(), NewLocalStorage(dir), "task-checkpoint.json"); err != nil {
+		t.Fatalf("Upload returns an error: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, LogContainer, "task-checkpoint.json"))
+	if err != nil {
+		t.Fatalf("checkpoint isn't uploaded: %v", err)
+	}
+	var res Checkpoint
+	if err = json.Unmarshal(data, &res); err != nil {
+		t.Fatalf("uploaded checkpoint is broken: %v", err)
+	}
+	if res.Name != "task" || res.Runs["task"] == nil || !res.Runs["task"].Uploaded {
+		t.Errorf("uploaded checkpoint is %s", data)
+	}
+	if err = c.Remove(); err != nil {
+		t.Errorf("Remove returns an error: %v", err)
+	}
+
+}
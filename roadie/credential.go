@@ -0,0 +1,311 @@
+//
+// roadie/credential.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/jkawamoto/roadie/cloud/azure"
+)
+
+const (
+	// CredentialRefreshToken uses the refresh token in the config file.
+	CredentialRefreshToken = "refresh_token"
+	// CredentialServicePrincipal uses a service principal with a client
+	// secret or a certificate.
+	CredentialServicePrincipal = "service_principal"
+	// CredentialManagedIdentity uses the managed identity of the virtual
+	// machine.
+	CredentialManagedIdentity = "managed_identity"
+	// CredentialSAS uses a shared access signature of the storage account.
+	CredentialSAS = "sas"
+
+	// DefaultActiveDirectoryEndpoint is the endpoint of Azure Active Directory.
+	DefaultActiveDirectoryEndpoint = "https://login.microsoftonline.com/"
+	// DefaultIMDSEndpoint is the token endpoint of the instance metadata
+	// service.
+	DefaultIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// TokenResource is the resource tokens are requested for.
+	TokenResource = "https://management.azure.com/"
+)
+
+// Credential authorizes accesses to the cloud storage.
+type Credential interface {
+	// Authorize creates a storage service; a given config has the current
+	// token. It also returns the token used to create the service so that
+	// the service can be renewed before the token expires; the token is nil
+	// if the service doesn't expire.
+	Authorize(ctx context.Context, cfg *azure.Config, logger *log.Logger) (*azure.StorageService, *adal.Token, error)
+}
+
+// CredentialConfig defines the credential section of a config file.
+type CredentialConfig struct {
+	// Type is one of CredentialRefreshToken, CredentialServicePrincipal,
+	// CredentialManagedIdentity, and CredentialSAS; CredentialRefreshToken is
+	// used if empty.
+	Type     string `yaml:"type,omitempty"`
+	TenantID string `yaml:"tenant_id,omitempty"`
+	ClientID string `yaml:"client_id,omitempty"`
+	// ClientSecret and Certificate authenticate a service principal;
+	// Certificate is the path to a PEM file having a certificate and its
+	// private key.
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	Certificate  string `yaml:"certificate,omitempty"`
+	// Endpoint overwrites the endpoint of Azure Active Directory or the
+	// instance metadata service.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Account and SAS are the storage account name and a shared access
+	// signature of it.
+	Account string `yaml:"account,omitempty"`
+	SAS     string `yaml:"sas,omitempty"`
+}
+
+// Credential creates a credential defined in this section; given tenant and
+// client IDs are used if this section doesn't specify them.
+func (c *CredentialConfig) Credential(tenantID, clientID string) (cred Credential, err error) {
+
+	if c.TenantID != "" {
+		tenantID = c.TenantID
+	}
+	if c.ClientID != "" {
+		clientID = c.ClientID
+	}
+
+	switch c.Type {
+	case "", CredentialRefreshToken:
+		return NewRefreshTokenCredential(c.Endpoint, tenantID, clientID), nil
+
+	case CredentialServicePrincipal:
+		if c.Certificate != "" {
+			return NewCertificateCredential(c.Endpoint, tenantID, clientID, c.Certificate)
+		} else if c.ClientSecret == "" {
+			return nil, fmt.Errorf("Service principal requires a client secret or a certificate")
+		}
+		return NewSecretCredential(c.Endpoint, tenantID, clientID, c.ClientSecret), nil
+
+	case CredentialManagedIdentity:
+		// The managed identity uses a user assigned identity only if the
+		// client ID is given explicitly.
+		return NewManagedIdentityCredential(c.Endpoint, c.ClientID), nil
+
+	case CredentialSAS:
+		if c.Account == "" || c.SAS == "" {
+			return nil, fmt.Errorf("SAS credential requires an account name and a token")
+		}
+		return NewSASCredential(c.Account, c.SAS), nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported credential type: %v", c.Type)
+	}
+
+}
+
+// tokenCredential is a credential which obtains tokens of Azure Active
+// Directory with a service principal token of adal.
+type tokenCredential struct {
+	// spt creates a service principal token from the current token.
+	spt func(current *adal.Token) (*adal.ServicePrincipalToken, error)
+}
+
+// Authorize obtains a new token and creates a storage service with it.
+func (c *tokenCredential) Authorize(ctx context.Context, cfg *azure.Config, logger *log.Logger) (store *azure.StorageService, token *adal.Token, err error) {
+
+	spt, err := c.spt(&cfg.Token)
+	if err != nil {
+		return
+	}
+	if err = spt.RefreshWithContext(ctx); err != nil {
+		return
+	}
+	refreshed := spt.Token()
+	token = &refreshed
+
+	authorized := *cfg
+	authorized.Token = refreshed
+	store, err = newStorageService(ctx, &authorized, logger)
+	return
+
+}
+
+// NewRefreshTokenCredential creates a credential which refreshes the token in
+// the config; if the endpoint is empty, DefaultActiveDirectoryEndpoint is
+// used.
+func NewRefreshTokenCredential(endpoint, tenantID, clientID string) Credential {
+	return &tokenCredential{
+		spt: func(current *adal.Token) (*adal.ServicePrincipalToken, error) {
+			cfg, err := oauthConfig(endpoint, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			resource := current.Resource
+			if resource == "" {
+				resource = TokenResource
+			}
+			return adal.NewServicePrincipalTokenFromRefreshToken(*cfg, clientID, current.RefreshToken, resource)
+		},
+	}
+}
+
+// NewSecretCredential creates a credential of a service principal with a
+// client secret; if the endpoint is empty, DefaultActiveDirectoryEndpoint is
+// used.
+func NewSecretCredential(endpoint, tenantID, clientID, secret string) Credential {
+	return &tokenCredential{
+		spt: func(*adal.Token) (*adal.ServicePrincipalToken, error) {
+			cfg, err := oauthConfig(endpoint, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			return adal.NewServicePrincipalToken(*cfg, clientID, secret, TokenResource)
+		},
+	}
+}
+
+// NewCertificateCredential creates a credential of a service principal with
+// a certificate; the given file must have a PEM encoded certificate and its
+// private key. If the endpoint is empty, DefaultActiveDirectoryEndpoint is
+// used.
+func NewCertificateCredential(endpoint, tenantID, clientID, filename string) (cred Credential, err error) {
+
+	cert, key, err := readCertificate(filename)
+	if err != nil {
+		return
+	}
+	return &tokenCredential{
+		spt: func(*adal.Token) (*adal.ServicePrincipalToken, error) {
+			cfg, err := oauthConfig(endpoint, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			return adal.NewServicePrincipalTokenFromCertificate(*cfg, clientID, cert, key, TokenResource)
+		},
+	}, nil
+
+}
+
+// NewManagedIdentityCredential creates a credential of the managed identity
+// of the virtual machine; if the endpoint is empty, DefaultIMDSEndpoint is
+// used. If the client ID isn't empty, the user assigned identity having the
+// ID is used.
+func NewManagedIdentityCredential(endpoint, clientID string) Credential {
+
+	if endpoint == "" {
+		endpoint = DefaultIMDSEndpoint
+	}
+	return &tokenCredential{
+		spt: func(*adal.Token) (*adal.ServicePrincipalToken, error) {
+			if clientID != "" {
+				return adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, TokenResource, clientID)
+			}
+			return adal.NewServicePrincipalTokenFromMSI(endpoint, TokenResource)
+		},
+	}
+
+}
+
+// sasCredential is a credential with a shared access signature.
+type sasCredential struct {
+	account string
+	sas     string
+}
+
+// NewSASCredential creates a credential with a shared access signature of a
+// given storage account.
+func NewSASCredential(account, sas string) Credential {
+	return &sasCredential{
+		account: account,
+		sas:     strings.TrimPrefix(sas, "?"),
+	}
+}
+
+// Authorize creates a storage service with the shared access signature; the
+// returned token is always nil.
+func (c *sasCredential) Authorize(ctx context.Context, cfg *azure.Config, logger *log.Logger) (store *azure.StorageService, token *adal.Token, err error) {
+
+	cli, err := storage.NewAccountSASClientFromEndpointToken(fmt.Sprintf("https://%v.blob.core.windows.net", c.account), c.sas)
+	if err != nil {
+		return
+	}
+	store = &azure.StorageService{
+		Client: cli.GetBlobService(),
+		Logger: logger,
+	}
+	return
+
+}
+
+// oauthConfig returns the OAuth configuration of a given tenant; if the
+// endpoint is empty, DefaultActiveDirectoryEndpoint is used.
+func oauthConfig(endpoint, tenantID string) (*adal.OAuthConfig, error) {
+	if endpoint == "" {
+		endpoint = DefaultActiveDirectoryEndpoint
+	}
+	return adal.NewOAuthConfig(endpoint, tenantID)
+}
+
+// readCertificate reads a PEM file having a certificate and its RSA private
+// key.
+func readCertificate(filename string) (cert *x509.Certificate, key *rsa.PrivateKey, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert == nil {
+				cert, err = x509.ParseCertificate(block.Bytes)
+			}
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			var parsed interface{}
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err == nil {
+				var ok bool
+				if key, ok = parsed.(*rsa.PrivateKey); !ok {
+					err = fmt.Errorf("Private key in %v isn't an RSA key", filename)
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if cert == nil || key == nil {
+		err = fmt.Errorf("%v must have a certificate and its private key", filename)
+	}
+	return
+
+}
@@ -0,0 +1,305 @@
+//
+// roadie/credential_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie/cloud/azure"
+)
+
+// authorizedToken returns the access token a given credential uses to create
+// a storage service.
+func authorizedToken(t *testing.T, cred Credential) (token string, err error) {
+
+	factory := newStorageService
+	defer func() {
+		newStorageService = factory
+	}()
+	newStorageService = func(ctx context.Context, cfg *azure.Config, logger *log.Logger) (*azure.StorageService, error) {
+		token = cfg.Token.AccessToken
+		return new(azure.StorageService), nil
+	}
+
+	_, res, err := cred.Authorize(context.Background(), new(azure.Config), nil)
+	if err != nil {
+		return
+	}
+	if res.AccessToken != token {
+		t.Errorf("returned token is %q, want %q", res.AccessToken, token)
+	}
+	return
+
+}
+
+// writeToken writes a token response.
+func writeToken(w http.ResponseWriter, token string) {
+	fmt.Fprintf(w, `{"access_token":"%v","expires_on":"%v","resource":"%v","token_type":"Bearer"}`,
+		token, time.Now().Add(time.Hour).Unix(), TokenResource)
+}
+
+func TestManagedIdentityCredential(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		switch {
+		case req.Header.Get("Metadata") != "true":
+			w.WriteHeader(http.StatusBadRequest)
+		case query.Get("api-version") == "" || query.Get("resource") != TokenResource:
+			w.WriteHeader(http.StatusBadRequest)
+		case query.Get("client_id") == "unknown":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			writeToken(w, "identity"+query.Get("client_id"))
+		}
+	}))
+	defer server.Close()
+
+	token, err := authorizedToken(t, NewManagedIdentityCredential(server.URL, ""))
+	if err != nil {
+		t.Fatalf("Authorize returns an error: %v", err)
+	}
+	if token != "identity" {
+		t.Errorf("access token is %q, want %q", token, "identity")
+	}
+
+	token, err = authorizedToken(t, NewManagedIdentityCredential(server.URL, "-user"))
+	if err != nil {
+		t.Fatalf("Authorize returns an error: %v", err)
+	}
+	if token != "identity-user" {
+		t.Errorf("access token is %q, want %q", token, "identity-user")
+	}
+
+	if _, err = authorizedToken(t, NewManagedIdentityCredential(server.URL, "unknown")); err == nil {
+		t.Error("Authorize doesn't return any errors for an unknown identity")
+	}
+
+}
+
+func TestSecretCredential(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/tenant/oauth2/token" || req.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.FormValue("client_id") != "client" || req.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeToken(w, "principal")
+	}))
+	defer server.Close()
+
+	token, err := authorizedToken(t, NewSecretCredential(server.URL, "tenant", "client", "secret"))
+	if err != nil {
+		t.Fatalf("Authorize returns an error: %v", err)
+	}
+	if token != "principal" {
+		t.Errorf("access token is %q, want %q", token, "principal")
+	}
+
+	if _, err = authorizedToken(t, NewSecretCredential(server.URL, "tenant", "client", "wrong")); err == nil {
+		t.Error("Authorize doesn't return any errors for a wrong secret")
+	}
+
+}
+
+func TestRefreshTokenCredential(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/tenant/oauth2/token" || req.FormValue("grant_type") != "refresh_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.FormValue("client_id") != "client" || req.FormValue("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeToken(w, "refreshed")
+	}))
+	defer server.Close()
+
+	factory := newStorageService
+	defer func() {
+		newStorageService = factory
+	}()
+	newStorageService = func(ctx context.Context, cfg *azure.Config, logger *log.Logger) (*azure.StorageService, error) {
+		return new(azure.StorageService), nil
+	}
+
+	cred := NewRefreshTokenCredential(server.URL, "tenant", "client")
+	cfg := new(azure.Config)
+	cfg.Token.RefreshToken = "refresh"
+	_, token, err := cred.Authorize(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("Authorize returns an error: %v", err)
+	}
+	if token.AccessToken != "refreshed" {
+		t.Errorf("access token is %q, want %q", token.AccessToken, "refreshed")
+	}
+
+	cfg.Token.RefreshToken = "expired"
+	if _, _, err = cred.Authorize(context.Background(), cfg, nil); err == nil {
+		t.Error("Authorize doesn't return any errors for an expired refresh token")
+	}
+
+}
+
+func TestCertificateCredential(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate a key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "roadie"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create a certificate: %v", err)
+	}
+
+	fp, err := ioutil.TempFile("", "roadie-cert-")
+	if err != nil {
+		t.Fatalf("cannot create a temporary file: %v", err)
+	}
+	defer os.Remove(fp.Name())
+	pem.Encode(fp, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(fp, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	fp.Close()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+
+		parts := strings.Split(req.FormValue("client_assertion"), ".")
+		if len(parts) != 3 || req.FormValue("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var claims struct {
+			Aud string
+			Sub string
+		}
+		data, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err == nil {
+			err = json.Unmarshal(data, &claims)
+		}
+		if err != nil || !strings.HasPrefix(claims.Aud, server.URL+req.URL.Path) || claims.Sub != "client" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeToken(w, "certificate")
+
+	}))
+	defer server.Close()
+
+	cred, err := NewCertificateCredential(server.URL, "tenant", "client", fp.Name())
+	if err != nil {
+		t.Fatalf("NewCertificateCredential returns an error: %v", err)
+	}
+	token, err := authorizedToken(t, cred)
+	if err != nil {
+		t.Fatalf("Authorize returns an error: %v", err)
+	}
+	if token != "certificate" {
+		t.Errorf("access token is %q, want %q", token, "certificate")
+	}
+
+}
+
+func TestCredentialConfig(t *testing.T) {
+
+	cases := []struct {
+		config CredentialConfig
+		err    bool
+	}{
+		{CredentialConfig{}, false},
+		{CredentialConfig{Type: CredentialRefreshToken}, false},
+		{CredentialConfig{Type: CredentialServicePrincipal, ClientSecret: "secret"}, false},
+		{CredentialConfig{Type: CredentialServicePrincipal}, true},
+		{CredentialConfig{Type: CredentialServicePrincipal, Certificate: "not-exist.pem"}, true},
+		{CredentialConfig{Type: CredentialManagedIdentity}, false},
+		{CredentialConfig{Type: CredentialSAS, Account: "account", SAS: "?sv=2017"}, false},
+		{CredentialConfig{Type: CredentialSAS, Account: "account"}, true},
+		{CredentialConfig{Type: "unknown"}, true},
+	}
+	for _, c := range cases {
+		_, err := c.config.Credential("tenant", "client")
+		if c.err && err == nil {
+			t.Errorf("Credential(%+v) doesn't return any errors", c.config)
+		} else if !c.err && err != nil {
+			t.Errorf("Credential(%+v) returns an error: %v", c.config, err)
+		}
+	}
+
+}
+
+func TestSASCredential(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewTokenSource(ctx, new(azure.Config), NewSASCredential("account", "?sv=2017"), nil)
+	if err != nil {
+		t.Fatalf("NewTokenSource returns an error: %v", err)
+	}
+	if s.StorageService() == nil {
+		t.Error("SAS credential doesn't create a storage service")
+	}
+	cancel()
+	s.Wait()
+
+}
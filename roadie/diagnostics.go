@@ -0,0 +1,247 @@
+//
+// roadie/diagnostics.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/mem"
+)
+
+const (
+	// DiagnosticsLogLines defines how many recent log lines are stored in a
+	// diagnostics bundle.
+	DiagnosticsLogLines = 200
+	// diagnosticsErrors is the name of a file in a bundle listing errors
+	// occurred while collecting information.
+	diagnosticsErrors = "errors.txt"
+)
+
+// Diagnostics collects files which help to find why a task failed and
+// archives them into a tar.gz bundle. It is safe for concurrent use.
+type Diagnostics struct {
+	mutex sync.Mutex
+	names []string
+	files map[string][]byte
+}
+
+// NewDiagnostics creates a new empty diagnostics bundle.
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{
+		files: make(map[string][]byte),
+	}
+}
+
+// Add adds a named file to the bundle; if the name exists already, the file
+// is replaced.
+func (d *Diagnostics) Add(name string, data []byte) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exist := d.files[name]; !exist {
+		d.names = append(d.names, name)
+	}
+	d.files[name] = data
+
+}
+
+// AddJSON adds a named file which has a given value encoded in JSON.
+func (d *Diagnostics) AddJSON(name string, v interface{}) {
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		d.Errorf("Cannot encode %v: %v", name, err)
+		return
+	}
+	d.Add(name, data)
+
+}
+
+// Errorf records an error occurred while collecting information.
+func (d *Diagnostics) Errorf(format string, args ...interface{}) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exist := d.files[diagnosticsErrors]; !exist {
+		d.names = append(d.names, diagnosticsErrors)
+	}
+	d.files[diagnosticsErrors] = append(d.files[diagnosticsErrors], fmt.Sprintf(format+"\n", args...)...)
+
+}
+
+// WriteTo writes the bundle as a tar.gz archive to a given writer.
+func (d *Diagnostics) WriteTo(w io.Writer) (n int64, err error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	counter := &countingWriter{Writer: w}
+	zipWriter := gzip.NewWriter(counter)
+	tarWriter := tar.NewWriter(zipWriter)
+
+	now := time.Now()
+	for _, name := range d.names {
+		data := d.files[name]
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		})
+		if err != nil {
+			return counter.n, err
+		}
+		if _, err = tarWriter.Write(data); err != nil {
+			return counter.n, err
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return counter.n, err
+	}
+	err = zipWriter.Close()
+	return counter.n, err
+
+}
+
+// SystemStats defines disk and memory usages recorded in a diagnostics
+// bundle.
+type SystemStats struct {
+	Disk struct {
+		Path      string `json:"path"`
+		Total     uint64 `json:"total"`
+		Available uint64 `json:"available"`
+	} `json:"disk"`
+	Memory *mem.VirtualMemoryStat `json:"memory"`
+}
+
+// Diagnose records disk and memory usages; the disk usage is of the file
+// system having a given path.
+func (s *SystemStats) Diagnose(diag *Diagnostics, path string) {
+
+	s.Disk.Path = path
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		diag.Errorf("Cannot get the disk usage of %v: %v", path, err)
+	} else {
+		s.Disk.Total = stat.Blocks * uint64(stat.Bsize)
+		s.Disk.Available = stat.Bavail * uint64(stat.Bsize)
+	}
+
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		diag.Errorf("Cannot get the memory usage: %v", err)
+	}
+	s.Memory = v
+	diag.AddJSON("system.json", s)
+
+}
+
+// Diagnose records information about the docker daemon, i.e. outputs of
+// docker info and docker version.
+func (d *DockerClient) Diagnose(ctx context.Context, diag *Diagnostics) {
+
+	if info, err := d.client.Info(ctx); err != nil {
+		diag.Errorf("Cannot get information of the docker daemon: %v", err)
+	} else {
+		diag.AddJSON("docker-info.json", info)
+	}
+
+	if version, err := d.client.ServerVersion(ctx); err != nil {
+		diag.Errorf("Cannot get the version of the docker daemon: %v", err)
+	} else {
+		diag.AddJSON("docker-version.json", version)
+	}
+
+}
+
+// LogTail is a writer which keeps the last lines written to it.
+type LogTail struct {
+	mutex sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// NewLogTail creates a new writer keeping a given number of lines.
+func NewLogTail(size int) *LogTail {
+	return &LogTail{
+		lines: make([]string, size),
+	}
+}
+
+// Write stores each line in a given message.
+func (t *LogTail) Write(p []byte) (int, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.lines) == 0 {
+		return len(p), nil
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.lines[t.next] = line
+		t.next = (t.next + 1) % len(t.lines)
+		if t.next == 0 {
+			t.full = true
+		}
+	}
+	return len(p), nil
+
+}
+
+// Lines returns the stored lines from the oldest one.
+func (t *LogTail) Lines() (res []string) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.full {
+		res = append(res, t.lines[t.next:]...)
+	}
+	return append(res, t.lines[:t.next]...)
+
+}
+
+// countingWriter counts written bytes.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+// Write writes given data and counts its length.
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	w.n += int64(n)
+	return
+}
@@ -0,0 +1,94 @@
+//
+// roadie/diagnostics_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+
+	diag := NewDiagnostics()
+	diag.Add("Dockerfile", []byte("FROM ubuntu"))
+	diag.AddJSON("info.json", map[string]int{"a": 1})
+	diag.Errorf("error %v", 1)
+	diag.Add("Dockerfile", []byte("FROM alpine"))
+	diag.Errorf("error %v", 2)
+
+	var buf bytes.Buffer
+	if _, err := diag.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo returns an error: %v", err)
+	}
+	zipReader, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("cannot read the bundle: %v", err)
+	}
+	tarReader := tar.NewReader(zipReader)
+
+	expects := []struct {
+		name string
+		body string
+	}{
+		{"Dockerfile", "FROM alpine"},
+		{"info.json", "{\n  \"a\": 1\n}"},
+		{diagnosticsErrors, "error 1\nerror 2\n"},
+	}
+	for _, e := range expects {
+		header, err := tarReader.Next()
+		if err != nil {
+			t.Fatalf("cannot find %v: %v", e.name, err)
+		}
+		body, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("cannot read %v: %v", e.name, err)
+		}
+		if header.Name != e.name || string(body) != e.body {
+			t.Errorf("file %v has %q, want %v having %q", header.Name, body, e.name, e.body)
+		}
+	}
+	if _, err = tarReader.Next(); err != io.EOF {
+		t.Error("the bundle has unexpected files")
+	}
+
+}
+
+func TestLogTail(t *testing.T) {
+
+	tail := NewLogTail(3)
+	if res := tail.Lines(); len(res) != 0 {
+		t.Errorf("Lines returns %v, want no lines", res)
+	}
+	for i := 0; i != 5; i++ {
+		fmt.Fprintf(tail, "line %v\n", i)
+	}
+	if res := strings.Join(tail.Lines(), ","); res != "line 2,line 3,line 4" {
+		t.Errorf("Lines returns %v, want the last 3 lines", res)
+	}
+
+}
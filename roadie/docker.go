@@ -33,21 +33,44 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/shirou/gopsutil/mem"
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// DefaultGracePeriod defines the default time to wait for a sandbox
+	// container stops after sending SIGTERM.
+	DefaultGracePeriod = 30 * time.Second
+	// OutputFlushTimeout defines how long to wait for outputs of a sandbox
+	// container to be forwarded after it stops.
+	OutputFlushTimeout = 10 * time.Second
+
+	// StepBeginMarker is printed to stdout by the entrypoint with the index
+	// of a run step when the step begins.
+	StepBeginMarker = "##roadie-step-begin"
+	// StepEndMarker is printed to stdout by the entrypoint with the index and
+	// the exit status of a run step when the step ends.
+	StepEndMarker = "##roadie-step-end"
+)
+
 // DockerClient is a simple interface for docker.
 type DockerClient struct {
-	client *client.Client
+	client DockerAPI
 	Logger *log.Logger
+	// Recorder records outputs of sandbox containers with their streams and
+	// run steps if not nil; otherwise they are written to Logger.
+	Recorder OutputRecorder
 }
 
 // DockerBuildOpt defines arguments for Build function.
@@ -56,6 +79,84 @@ type DockerBuildOpt struct {
 	Dockerfile  []byte
 	Entrypoint  []byte
 	ContextRoot string
+	// Output receives messages from building the image; if nil, they are
+	// written to the logger.
+	Output io.Writer
+}
+
+// BuildError is returned from Build when the docker daemon fails to build an
+// image.
+type BuildError struct {
+	// Code is the error code reported by the docker daemon.
+	Code int
+	// Message is the error message.
+	Message string
+	// Step is the Dockerfile step which was running, e.g.
+	// "Step 3/7 : RUN apt-get update"; it is empty if no steps have started.
+	Step string
+}
+
+// DockerStartOpt defines arguments for Start function.
+type DockerStartOpt struct {
+	ImageName string
+	// ContainerName is the name of the container; docker generates a name if
+	// empty.
+	ContainerName string
+	Mounts        []mount.Mount
+	// Env defines environment variables in the form of KEY=VALUE; the sandbox
+	// container doesn't inherit the host environment.
+	Env []string
+	// GracePeriod defines how long to wait after sending SIGTERM before
+	// killing the container when the given context is canceled;
+	// DefaultGracePeriod is used if zero.
+	GracePeriod time.Duration
+	// StopBy returns the time by which the container must stop when the
+	// context is canceled, if not nil; the grace period is shortened to meet
+	// it. A zero time means no limits.
+	StopBy func() time.Time
+	// Network is one of NetworkDefault, NetworkNone, and NetworkRestricted.
+	Network string
+	// AllowedHosts lists hosts the container can connect to when Network is
+	// NetworkRestricted.
+	AllowedHosts []string
+	// User runs the container as a given user, e.g. uid:gid.
+	User string
+	// ReadOnly makes the root file system of the container read-only.
+	ReadOnly bool
+	// Tmpfs lists paths where writable temporary file systems are mounted.
+	Tmpfs []string
+	// CapDrop and CapAdd list kernel capabilities to be dropped and added.
+	CapDrop []string
+	CapAdd  []string
+	// SecurityOpt lists security options such as no-new-privileges.
+	SecurityOpt []string
+	// Memory limits the memory of the container in bytes; if zero,
+	// DefaultMemoryRatio of the total memory is used.
+	Memory int64
+	// CPUSet lists CPUs the container can use, e.g. 0-3; all CPUs are used if
+	// empty.
+	CPUSet string
+	// Diagnostics receives the inspection of the container before it is
+	// removed, if not nil.
+	Diagnostics *Diagnostics
+	// Secrets are values replaced with SecretMask in the inspection of the
+	// container since environment variables have them.
+	Secrets []string
+	// Steps is notified when run steps begin and end, if not nil.
+	Steps StepObserver
+}
+
+// StepObserver is notified when run steps in a sandbox container begin and
+// end.
+type StepObserver interface {
+	BeginStep(index int)
+	EndStep(index, code int)
+}
+
+// ExitError is returned from Start when a sandbox container exits with a
+// non-zero status.
+type ExitError struct {
+	Code int
 }
 
 // buildLog defines the JSON format of logs from building docker images.
@@ -68,6 +169,27 @@ type buildLog struct {
 	}
 }
 
+// DockerAPI defines methods of the docker client which DockerClient uses;
+// package dockertest provides a fake implementation for tests.
+type DockerAPI interface {
+	Close() error
+	Info(ctx context.Context) (types.Info, error)
+	ServerVersion(ctx context.Context) (types.Version, error)
+	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (container.ContainerCreateCreatedBody, error)
+	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
+	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error)
+	ContainerKill(ctx context.Context, containerID, signal string) error
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+	NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error)
+	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+}
+
 // NewDockerClient creates a new docker client.
 func NewDockerClient(logger *log.Logger) (*DockerClient, error) {
 
@@ -81,10 +203,20 @@ func NewDockerClient(logger *log.Logger) (*DockerClient, error) {
 		return nil, err
 	}
 
+	return NewDockerClientFromAPI(c, logger), nil
+
+}
+
+// NewDockerClientFromAPI creates a new docker client using a given API.
+func NewDockerClientFromAPI(api DockerAPI, logger *log.Logger) *DockerClient {
+
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", log.LstdFlags)
+	}
 	return &DockerClient{
-		client: c,
+		client: api,
 		Logger: logger,
-	}, nil
+	}
 
 }
 
@@ -93,6 +225,17 @@ func (d *DockerClient) Close() error {
 	return d.client.Close()
 }
 
+// Signal sends a given signal, e.g. SIGUSR1, to a given named container.
+func (d *DockerClient) Signal(ctx context.Context, container, signal string) error {
+	return d.client.ContainerKill(ctx, container, signal)
+}
+
+// ImageExists returns true if a given named image exists.
+func (d *DockerClient) ImageExists(ctx context.Context, name string) bool {
+	_, _, err := d.client.ImageInspectWithRaw(ctx, name)
+	return err == nil
+}
+
 // Build builds a docker image to run this script.
 func (d *DockerClient) Build(ctx context.Context, opt *DockerBuildOpt) (err error) {
 
@@ -115,7 +258,7 @@ func (d *DockerClient) Build(ctx context.Context, opt *DockerBuildOpt) (err erro
 	res, err := d.client.ImageBuild(ctx, reader, types.ImageBuildOptions{
 		Tags:       []string{opt.ImageName},
 		Remove:     true,
-		Dockerfile: ".roadie/Dockerfile",
+		Dockerfile: ContextDockerfile,
 	})
 	if err != nil {
 		return
@@ -126,8 +269,11 @@ func (d *DockerClient) Build(ctx context.Context, opt *DockerBuildOpt) (err erro
 	eg.Go(func() error {
 		defer os.Stdout.Sync()
 
-		scanner := bufio.NewScanner(res.Body)
-		for scanner.Scan() {
+		// Messages are decoded as a JSON stream since they can be longer than
+		// the limit of bufio.Scanner.
+		decoder := json.NewDecoder(res.Body)
+		var step string
+		for {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -135,18 +281,34 @@ func (d *DockerClient) Build(ctx context.Context, opt *DockerBuildOpt) (err erro
 			}
 
 			var output buildLog
-			if json.Unmarshal(scanner.Bytes(), &output) == nil {
-				switch {
-				case output.Error != "":
-					return fmt.Errorf(output.Error)
-				case output.Stream != "":
-					for _, v := range formatOutput(output.Stream) {
+			if err := decoder.Decode(&output); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			switch {
+			case output.Error != "":
+				if opt.Output != nil {
+					fmt.Fprintln(opt.Output, output.Error)
+				}
+				return &BuildError{
+					Code:    output.ErrorDetail.Code,
+					Message: output.Error,
+					Step:    step,
+				}
+			case output.Stream != "":
+				for _, v := range formatOutput(output.Stream) {
+					if strings.HasPrefix(v, "Step ") {
+						step = v
+					}
+					if opt.Output != nil {
+						fmt.Fprintln(opt.Output, v)
+					} else {
 						d.Logger.Println(v)
 					}
 				}
 			}
 		}
-		return nil
 	})
 
 	err = eg.Wait()
@@ -159,75 +321,139 @@ func (d *DockerClient) Build(ctx context.Context, opt *DockerBuildOpt) (err erro
 }
 
 // Start starts a docker container and executes run section of this script.
-func (d *DockerClient) Start(ctx context.Context, image string, mounts []mount.Mount) (err error) {
+func (d *DockerClient) Start(ctx context.Context, opt *DockerStartOpt) (err error) {
 
 	d.Logger.Println("Start a sandbox container")
 
 	// Create a docker container.
 	config := container.Config{
-		Image: image,
-		Env:   os.Environ(),
+		Image: opt.ImageName,
+		Env:   opt.Env,
+		User:  opt.User,
 	}
 
-	var cap int64
-	if v, err2 := mem.VirtualMemory(); err2 != nil {
-		cap = 0
-	} else {
-		cap = int64(float64(v.Total) * 0.95)
+	cap := opt.Memory
+	if cap == 0 {
+		if v, err2 := mem.VirtualMemory(); err2 == nil {
+			cap = int64(float64(v.Total) * DefaultMemoryRatio)
+		}
 	}
 	host := container.HostConfig{
-		Mounts: mounts,
+		Mounts: opt.Mounts,
 		Resources: container.Resources{
-			Memory: cap,
+			Memory:     cap,
+			CpusetCpus: opt.CPUSet,
 		},
+		ReadonlyRootfs: opt.ReadOnly,
+		CapDrop:        opt.CapDrop,
+		CapAdd:         opt.CapAdd,
+		SecurityOpt:    opt.SecurityOpt,
+	}
+	if len(opt.Tmpfs) != 0 {
+		host.Tmpfs = make(map[string]string)
+		for _, v := range opt.Tmpfs {
+			if !hasMountPoint(opt.Mounts, v) {
+				host.Tmpfs[v] = ""
+			}
+		}
 	}
 
-	c, err := d.client.ContainerCreate(ctx, &config, &host, nil, "")
+	// An interrupted execution can leave a container and a network of the
+	// same name, which may be still running.
+	if opt.ContainerName != "" {
+		if err = d.removeStaleSandbox(ctx, opt.ContainerName, opt.gracePeriod()); err != nil {
+			return
+		}
+	}
+
+	switch opt.Network {
+	case NetworkDefault:
+	case NetworkNone:
+		host.NetworkMode = container.NetworkMode(NetworkNone)
+		config.NetworkDisabled = true
+	case NetworkRestricted:
+		var network *restrictedNetwork
+		// Networks are named after containers if given since several
+		// containers can run the same image.
+		name := opt.ImageName
+		if opt.ContainerName != "" {
+			name = opt.ContainerName
+		}
+		network, err = d.createRestrictedNetwork(ctx, name, opt.AllowedHosts)
+		if err != nil {
+			return
+		}
+		defer d.removeRestrictedNetwork(network)
+		host.NetworkMode = container.NetworkMode(network.ID)
+	default:
+		return fmt.Errorf("Unsupported network mode: %v", opt.Network)
+	}
+
+	c, err := d.client.ContainerCreate(ctx, &config, &host, nil, opt.ContainerName)
 	if err != nil {
 		return
 	}
 	// Context ctx may be canceled before removing the container,
 	// and use another context here.
 	defer d.client.ContainerRemove(context.Background(), c.ID, types.ContainerRemoveOptions{})
+	if opt.Diagnostics != nil {
+		defer func() {
+			info, err := d.client.ContainerInspect(context.Background(), c.ID)
+			if err != nil {
+				opt.Diagnostics.Errorf("Cannot inspect the sandbox container: %v", err)
+				return
+			}
+			if info.Config != nil {
+				config := *info.Config
+				config.Env = maskStrings(config.Env, opt.Secrets)
+				info.Config = &config
+			}
+			opt.Diagnostics.AddJSON("container.json", info)
+		}()
+	}
+
+	// Start the container.
+	options := types.ContainerStartOptions{}
+	if err = d.client.ContainerStart(ctx, c.ID, options); err != nil {
+		return
+	}
 
-	// Attach stdout and stderr of the container.
-	stream, err := d.client.ContainerAttach(ctx, c.ID, types.ContainerAttachOptions{
-		Stream: true,
-		Stdout: true,
-		Stderr: true,
+	// Read outputs with timestamps given by docker so that lines keep their
+	// order even if forwarding them is delayed. Reading them continues after
+	// ctx is canceled to forward outputs while stopping the container.
+	logCtx, cancelLogs := context.WithCancel(context.Background())
+	defer cancelLogs()
+	logs, err := d.client.ContainerLogs(logCtx, c.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
 	})
 	if err != nil {
 		return
 	}
-	defer stream.Close()
+	defer logs.Close()
 
-	pipeReader, pipeWeiter := io.Pipe()
+	forwarded := make(chan struct{})
 	go func() {
-		defer pipeReader.Close()
-		scanner := bufio.NewScanner(pipeReader)
-		for scanner.Scan() {
-			for _, line := range strings.Split(scanner.Text(), "\r") {
-				d.Logger.Println(line)
-			}
+		defer close(forwarded)
+		if err := d.forwardOutputs(logs, opt.Steps); err != nil && logCtx.Err() == nil {
+			d.Logger.Println("* Cannot read outputs of the sandbox container:", err)
 		}
 	}()
-	go func() {
-		defer pipeWeiter.Close()
-		stdcopy.StdCopy(pipeWeiter, pipeWeiter, stream.Reader)
+	defer func() {
+		select {
+		case <-forwarded:
+		case <-time.After(OutputFlushTimeout):
+			d.Logger.Println("* Some outputs of the sandbox container may be lost")
+		}
 	}()
 
-	// Start the container.
-	options := types.ContainerStartOptions{}
-	if err = d.client.ContainerStart(ctx, c.ID, options); err != nil {
-		return
-	}
-
 	exit, errCh := d.client.ContainerWait(ctx, c.ID, container.WaitConditionNotRunning)
 	select {
 	case <-ctx.Done():
-		// Kill the running container when the context is canceled.
-		// The context ctx has been canceled already, use another context here.
-		d.client.ContainerKill(context.Background(), c.ID, "")
+		// Stop the running container when the context is canceled.
+		d.stop(c.ID, opt.gracePeriod())
 		return ctx.Err()
 	case err = <-errCh:
 		// Kill the running container when the context is canceled.
@@ -236,7 +462,9 @@ func (d *DockerClient) Start(ctx context.Context, image string, mounts []mount.M
 		return
 	case status := <-exit:
 		if status.StatusCode != 0 {
-			err = fmt.Errorf("Sandbox container returns an error: %v", status.StatusCode)
+			err = &ExitError{
+				Code: int(status.StatusCode),
+			}
 		} else {
 			d.Logger.Println("Sandbox container ends")
 		}
@@ -245,6 +473,194 @@ func (d *DockerClient) Start(ctx context.Context, image string, mounts []mount.M
 
 }
 
+// forwardOutputs reads a multiplexed output stream of a sandbox container and
+// writes each line to the logger with its stream, its timestamp, and the run
+// step printing it. Step markers in stdout are consumed to track the current
+// step and aren't forwarded; a given observer is notified of them if not nil.
+func (d *DockerClient) forwardOutputs(r io.Reader, observer StepObserver) (err error) {
+
+	// Both handlers are called from StdCopy in one goroutine.
+	step := NoStep
+	stdout := newLineWriter(true, func(t time.Time, line string) {
+		if marker, index, code, ok := parseStepMarker(line); ok {
+			if marker == StepBeginMarker {
+				step = index
+				if observer != nil {
+					observer.BeginStep(index)
+				}
+			} else {
+				step = NoStep
+				if observer != nil {
+					observer.EndStep(index, code)
+				}
+			}
+			return
+		}
+		logOutput(d.Logger, d.Recorder, t, StreamStdout, step, line)
+	})
+	stderr := newLineWriter(true, func(t time.Time, line string) {
+		logOutput(d.Logger, d.Recorder, t, StreamStderr, step, line)
+	})
+
+	_, err = stdcopy.StdCopy(stdout, stderr, r)
+	stdout.Close()
+	stderr.Close()
+	return
+
+}
+
+// parseStepMarker parses a line printed by the entrypoint when a run step
+// begins or ends; it returns the marker, the index of the step, and the exit
+// code if the step ends.
+func parseStepMarker(line string) (marker string, index, code int, ok bool) {
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || (fields[0] != StepBeginMarker && fields[0] != StepEndMarker) {
+		return
+	}
+	index, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return
+	}
+	if fields[0] == StepEndMarker {
+		if len(fields) < 3 {
+			return
+		}
+		if code, err = strconv.Atoi(fields[2]); err != nil {
+			return
+		}
+	}
+	return fields[0], index, code, true
+
+}
+
+// Error returns a message including the exit code.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Sandbox container returns an error: %v", e.Code)
+}
+
+// Error returns a message including the failed step and the error code.
+func (e *BuildError) Error() string {
+
+	msg := e.Message
+	if e.Code != 0 {
+		msg = fmt.Sprintf("%v (code %v)", msg, e.Code)
+	}
+	if e.Step != "" {
+		msg = fmt.Sprintf("%v: %v", e.Step, msg)
+	}
+	return msg
+
+}
+
+// gracePeriod returns how long to wait for the container to stop after
+// sending SIGTERM; it is zero or negative if no time is left.
+func (opt *DockerStartOpt) gracePeriod() time.Duration {
+
+	grace := opt.GracePeriod
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	if opt.StopBy != nil {
+		if by := opt.StopBy(); !by.IsZero() {
+			if rest := time.Until(by); rest < grace {
+				grace = rest
+			}
+		}
+	}
+	return grace
+
+}
+
+// stop sends SIGTERM to a given container and kills it if it doesn't stop
+// in a given grace period; it kills the container at once if the grace
+// period isn't positive.
+func (d *DockerClient) stop(id string, grace time.Duration) {
+
+	if grace <= 0 {
+		d.Logger.Println("Killing the sandbox container since no time is left to stop it")
+		d.client.ContainerKill(context.Background(), id, "SIGKILL")
+		return
+	}
+
+	// The given context might have been canceled already, use another context
+	// here.
+	d.Logger.Println("Sending SIGTERM to the sandbox container")
+	err := d.client.ContainerKill(context.Background(), id, "SIGTERM")
+	if err != nil {
+		d.Logger.Println("* Cannot send SIGTERM to the sandbox container:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	exit, errCh := d.client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case <-exit:
+		d.Logger.Println("Sandbox container stopped")
+		return
+	case err = <-errCh:
+		if err == context.DeadlineExceeded {
+			d.Logger.Printf("Sandbox container didn't stop in %v, killing it", grace)
+		}
+	}
+	d.client.ContainerKill(context.Background(), id, "SIGKILL")
+
+}
+
+// removeStaleSandbox stops and removes a given named container and its
+// restricted network left by an interrupted execution.
+func (d *DockerClient) removeStaleSandbox(ctx context.Context, name string, grace time.Duration) (err error) {
+
+	args := filters.NewArgs()
+	args.Add("name", name)
+	containers, err := d.client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return
+	}
+	for _, c := range containers {
+		// The filter matches names which contain the given name.
+		if !hasName(c.Names, name) {
+			continue
+		}
+		d.Logger.Println("Removing a stale sandbox container", name)
+		if c.State == "running" {
+			d.stop(c.ID, grace)
+		}
+		err = d.client.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{
+			Force: true,
+		})
+		if err != nil {
+			return
+		}
+	}
+	return d.removeStaleNetwork(ctx, name)
+
+}
+
+// hasName returns true if given container names, which start with a slash,
+// have a given name.
+func hasName(names []string, name string) bool {
+	for _, v := range names {
+		if strings.TrimPrefix(v, "/") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMountPoint returns true if one of given mounts targets a given path.
+func hasMountPoint(mounts []mount.Mount, target string) bool {
+	for _, m := range mounts {
+		if filepath.Clean(m.Target) == filepath.Clean(target) {
+			return true
+		}
+	}
+	return false
+}
+
 // archiveContext makes a tar.gz stream consists of files.
 // The generated context stream includes dockerfile entrypoint.sh.
 func archiveContext(ctx context.Context, writer io.Writer, opt *DockerBuildOpt) (err error) {
@@ -264,59 +680,47 @@ func archiveContext(ctx context.Context, writer io.Writer, opt *DockerBuildOpt)
 	tarWriter := tar.NewWriter(zipWriter)
 	defer tarWriter.Close()
 
-	// Create a tarball.
-	if opt.ContextRoot != "" {
-		err = filepath.Walk(opt.ContextRoot, func(path string, info os.FileInfo, err error) error {
-
-			if err != nil {
-				return err
-			}
-
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+	files, err := BuildContext(ctx, opt)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
 
-			if info.IsDir() {
-				return nil
-			}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
 
-			// Write a file header.
-			rel, err := filepath.Rel(opt.ContextRoot, path)
+		if f.Path == "" {
+			err = addFile(tarWriter, f.Name, f.Data)
 			if err != nil {
-				return err
+				return
 			}
-			header, err := tar.FileInfoHeader(info, rel)
-			if err != nil {
-				return err
-			}
-			header.Name = rel
-			tarWriter.WriteHeader(header)
-
-			// Write the body.
-			return copyFile(path, tarWriter)
+			continue
+		}
 
-		})
+		// Write a file header.
+		var info os.FileInfo
+		info, err = os.Stat(f.Path)
 		if err != nil {
 			return
 		}
-	}
+		var header *tar.Header
+		header, err = tar.FileInfoHeader(info, f.Name)
+		if err != nil {
+			return
+		}
+		header.Name = f.Name
+		tarWriter.WriteHeader(header)
 
-	// Append entrypoint.sh to the context stream.
-	if opt.Entrypoint != nil {
-		err = addFile(tarWriter, ".roadie/entrypoint.sh", opt.Entrypoint)
+		// Write the body.
+		err = copyFile(f.Path, tarWriter)
 		if err != nil {
 			return
 		}
-	}
 
-	// Append Dockerfile to the context stream.
-	err = addFile(tarWriter, ".roadie/Dockerfile", opt.Dockerfile)
-	if err != nil {
-		return
 	}
-
 	return
 
 }
@@ -353,16 +757,14 @@ func addFile(writer *tar.Writer, name string, data []byte) (err error) {
 
 }
 
-// formatOutput parse multi line messages.
+// formatOutput parse multi line messages; empty lines are omitted.
 func formatOutput(str string) (res []string) {
 
-	for _, v := range strings.Split(str, "\r") {
-		for _, u := range strings.Split(v, "\n") {
-			if u != "" {
-				res = append(res, u)
-			}
+	scanLines(strings.NewReader(str), func(line string) {
+		if line != "" {
+			res = append(res, line)
 		}
-	}
+	})
 	return
 
 }
@@ -58,6 +58,7 @@ ENTRYPOINT /root/entrypoint.sh`),
 		Entrypoint: []byte(`#!/bin/bash
 /root/cmd.sh
 echo "test output"
+echo "$TEST_VALUE"
 `),
 		ContextRoot: "../data",
 	}
@@ -66,7 +67,10 @@ echo "test output"
 	if err != nil {
 		t.Fatal(err.Error())
 	}
-	err = cli.Start(ctx, "test-image")
+	err = cli.Start(ctx, &DockerStartOpt{
+		ImageName: "test-image",
+		Env:       []string{"TEST_VALUE=test env"},
+	})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -78,10 +82,47 @@ echo "test output"
 	if !strings.Contains(output, "test output") {
 		t.Error("Outputs doesn't have a message from entrypoint.sh")
 	}
+	if !strings.Contains(output, "test env") {
+		t.Error("Outputs doesn't have the given environment variable")
+	}
 	t.Log(output)
 
 }
 
+func TestBuildError(t *testing.T) {
+
+	var logs, output bytes.Buffer
+	cli, err := NewDockerClient(log.New(&logs, "", 0))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer cli.Close()
+
+	err = cli.Build(context.Background(), &DockerBuildOpt{
+		ImageName: "test-image-error",
+		Dockerfile: []byte(`FROM ubuntu:latest
+RUN exit 3`),
+		Output: &output,
+	})
+	buildErr, ok := err.(*BuildError)
+	if !ok {
+		t.Fatalf("Build returns %v, want a BuildError", err)
+	}
+	if buildErr.Code != 3 {
+		t.Errorf("error code is %v, want 3", buildErr.Code)
+	}
+	if !strings.Contains(buildErr.Step, "RUN exit 3") {
+		t.Errorf("failed step is %q, want the RUN step", buildErr.Step)
+	}
+	if !strings.Contains(output.String(), "RUN exit 3") {
+		t.Error("Build messages aren't written to the given output:", output.String())
+	}
+	if strings.Contains(logs.String(), "RUN exit 3") {
+		t.Error("Build messages are written to the logger:", logs.String())
+	}
+
+}
+
 func TestArchiveContext(t *testing.T) {
 
 	var err error
@@ -0,0 +1,651 @@
+//
+// roadie/dockertest/docker.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package dockertest provides a fake docker API for testing, which runs
+// containers as goroutines.
+package dockertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Behavior is a function run in a container; it returns an exit code.
+type Behavior func(c *Container) int
+
+// Docker is a fake docker API.
+type Docker struct {
+	// Behavior defines what containers run; they exit with 0 if nil.
+	Behavior Behavior
+
+	mutex      sync.Mutex
+	counter    int
+	images     map[string]bool
+	containers map[string]*Container
+	networks   map[string]types.NetworkResource
+	history    []*Container
+}
+
+// Container is a fake container.
+type Container struct {
+	ID     string
+	Name   string
+	Config *container.Config
+	Host   *container.HostConfig
+	// Signals receives signals sent to this container except SIGKILL.
+	Signals chan string
+	// Stdout and Stderr write outputs of this container.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	mutex    sync.Mutex
+	logs     *logBuffer
+	status   string
+	exitCode int
+	done     chan struct{}
+}
+
+// NewDocker creates a new fake docker API which has given images.
+func NewDocker(images ...string) *Docker {
+
+	d := &Docker{
+		images:     make(map[string]bool),
+		containers: make(map[string]*Container),
+		networks:   make(map[string]types.NetworkResource),
+	}
+	for _, v := range images {
+		d.images[v] = true
+	}
+	return d
+
+}
+
+// Seed creates a container which has a given name and keeps running until
+// it is killed if running is true, as an interrupted execution leaves.
+func (d *Docker) Seed(name string, running bool) *Container {
+
+	d.mutex.Lock()
+	c := d.newContainer(name, &container.Config{}, &container.HostConfig{})
+	d.mutex.Unlock()
+	if running {
+		c.start(func(c *Container) int {
+			<-c.done
+			return 0
+		})
+	}
+	return c
+
+}
+
+// Container returns a container which has a given name or ID; it returns nil
+// if the container doesn't exist or has been removed.
+func (d *Docker) Container(name string) *Container {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.lookup(name)
+
+}
+
+// Containers returns all containers created so far including removed ones.
+func (d *Docker) Containers() []*Container {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]*Container(nil), d.history...)
+
+}
+
+// Networks returns names of existing networks.
+func (d *Docker) Networks() (names []string) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, v := range d.networks {
+		names = append(names, v.Name)
+	}
+	return
+
+}
+
+// Close does nothing.
+func (d *Docker) Close() error {
+	return nil
+}
+
+// Info returns empty information.
+func (d *Docker) Info(ctx context.Context) (types.Info, error) {
+	return types.Info{}, nil
+}
+
+// ServerVersion returns an empty version.
+func (d *Docker) ServerVersion(ctx context.Context) (types.Version, error) {
+	return types.Version{}, nil
+}
+
+// ImageBuild reads a given build context and registers the image.
+func (d *Docker) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (res types.ImageBuildResponse, err error) {
+
+	if _, err = io.Copy(ioutil.Discard, buildContext); err != nil {
+		return
+	}
+	d.mutex.Lock()
+	for _, v := range options.Tags {
+		d.images[v] = true
+	}
+	d.mutex.Unlock()
+	res.Body = ioutil.NopCloser(strings.NewReader(`{"stream":"Successfully built\n"}`))
+	return
+
+}
+
+// ImageInspectWithRaw returns an error if a given image doesn't exist.
+func (d *Docker) ImageInspectWithRaw(ctx context.Context, imageID string) (info types.ImageInspect, raw []byte, err error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.images[imageID] {
+		err = fmt.Errorf("No such image: %v", imageID)
+		return
+	}
+	info.ID = imageID
+	return
+
+}
+
+// ContainerCreate creates a container.
+func (d *Docker) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (res container.ContainerCreateCreatedBody, err error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.images[config.Image] {
+		err = fmt.Errorf("No such image: %v", config.Image)
+		return
+	}
+	if containerName != "" && d.lookup(containerName) != nil {
+		err = fmt.Errorf("Conflict. The container name \"/%v\" is already in use", containerName)
+		return
+	}
+	res.ID = d.newContainer(containerName, config, hostConfig).ID
+	return
+
+}
+
+// ContainerStart runs the behavior in a given container.
+func (d *Docker) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+
+	c := d.Container(containerID)
+	if c == nil {
+		return fmt.Errorf("No such container: %v", containerID)
+	}
+	behavior := d.Behavior
+	if behavior == nil {
+		behavior = func(*Container) int { return 0 }
+	}
+	c.start(behavior)
+	return nil
+
+}
+
+// ContainerLogs returns a stream of outputs of a given container; it is
+// multiplexed and each line has a timestamp.
+func (d *Docker) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+
+	c := d.Container(containerID)
+	if c == nil {
+		return nil, fmt.Errorf("No such container: %v", containerID)
+	}
+	return &logReader{buffer: c.logs}, nil
+
+}
+
+// ContainerWait waits until a given container stops.
+func (d *Docker) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error) {
+
+	exit := make(chan container.ContainerWaitOKBody, 1)
+	errCh := make(chan error, 1)
+	c := d.Container(containerID)
+	if c == nil {
+		errCh <- fmt.Errorf("No such container: %v", containerID)
+		return exit, errCh
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			errCh <- ctx.Err()
+		case <-c.done:
+			exit <- container.ContainerWaitOKBody{
+				StatusCode: int64(c.ExitCode()),
+			}
+		}
+	}()
+	return exit, errCh
+
+}
+
+// ContainerKill sends a signal to a given container; SIGKILL stops it
+// immediately and the others are sent to Signals.
+func (d *Docker) ContainerKill(ctx context.Context, containerID, signal string) error {
+
+	c := d.Container(containerID)
+	if c == nil {
+		return fmt.Errorf("No such container: %v", containerID)
+	}
+	if !c.Running() {
+		return fmt.Errorf("Container %v is not running", containerID)
+	}
+	if signal == "" || signal == "SIGKILL" || signal == "KILL" {
+		c.finish(137)
+		return nil
+	}
+	select {
+	case c.Signals <- signal:
+	default:
+	}
+	return nil
+
+}
+
+// ContainerInspect returns information of a given container.
+func (d *Docker) ContainerInspect(ctx context.Context, containerID string) (info types.ContainerJSON, err error) {
+
+	c := d.Container(containerID)
+	if c == nil {
+		err = fmt.Errorf("No such container: %v", containerID)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	info.ContainerJSONBase = &types.ContainerJSONBase{
+		ID:   c.ID,
+		Name: "/" + c.Name,
+		State: &types.ContainerState{
+			Status:   c.status,
+			Running:  c.status == "running",
+			ExitCode: c.exitCode,
+		},
+	}
+	info.Config = c.Config
+	return
+
+}
+
+// ContainerList returns containers which contain given names in theirs.
+func (d *Docker) ContainerList(ctx context.Context, options types.ContainerListOptions) (res []types.Container, err error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	names := options.Filters.Get("name")
+	for _, c := range d.containers {
+		if !matchNames(c.Name, names) {
+			continue
+		}
+		state := c.State()
+		if !options.All && state != "running" {
+			continue
+		}
+		res = append(res, types.Container{
+			ID:    c.ID,
+			Names: []string{"/" + c.Name},
+			Image: c.Config.Image,
+			State: state,
+		})
+	}
+	return
+
+}
+
+// ContainerRemove removes a given container; it must be stopped unless the
+// removal is forced.
+func (d *Docker) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	c := d.lookup(containerID)
+	if c == nil {
+		return fmt.Errorf("No such container: %v", containerID)
+	}
+	if c.Running() {
+		if !options.Force {
+			return fmt.Errorf("You cannot remove a running container %v", containerID)
+		}
+		c.finish(137)
+	}
+	delete(d.containers, c.ID)
+	return nil
+
+}
+
+// NetworkCreate creates a network.
+func (d *Docker) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (res types.NetworkCreateResponse, err error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if options.CheckDuplicate {
+		for _, v := range d.networks {
+			if v.Name == name {
+				err = fmt.Errorf("network with name %v already exists", name)
+				return
+			}
+		}
+	}
+	d.counter++
+	res.ID = fmt.Sprintf("network%04d", d.counter)
+	d.networks[res.ID] = types.NetworkResource{
+		Name:    name,
+		ID:      res.ID,
+		Driver:  options.Driver,
+		Options: options.Options,
+	}
+	return
+
+}
+
+// NetworkList returns networks which contain given names in theirs.
+func (d *Docker) NetworkList(ctx context.Context, options types.NetworkListOptions) (res []types.NetworkResource, err error) {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	names := options.Filters.Get("name")
+	for _, v := range d.networks {
+		if matchNames(v.Name, names) {
+			res = append(res, v)
+		}
+	}
+	return
+
+}
+
+// NetworkRemove removes a given network.
+func (d *Docker) NetworkRemove(ctx context.Context, networkID string) error {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, exist := d.networks[networkID]; !exist {
+		return fmt.Errorf("No such network: %v", networkID)
+	}
+	delete(d.networks, networkID)
+	return nil
+
+}
+
+// newContainer creates a container; the caller must hold the lock.
+func (d *Docker) newContainer(name string, config *container.Config, host *container.HostConfig) *Container {
+
+	d.counter++
+	id := fmt.Sprintf("container%04d", d.counter)
+	if name == "" {
+		name = id
+	}
+	logs := newLogBuffer()
+	c := &Container{
+		ID:      id,
+		Name:    name,
+		Config:  config,
+		Host:    host,
+		Signals: make(chan string, 16),
+		Stdout:  &logWriter{buffer: logs, stream: stdcopy.Stdout, head: true},
+		Stderr:  &logWriter{buffer: logs, stream: stdcopy.Stderr, head: true},
+		logs:    logs,
+		status:  "created",
+		done:    make(chan struct{}),
+	}
+	d.containers[id] = c
+	d.history = append(d.history, c)
+	return c
+
+}
+
+// lookup finds a container by a name or an ID; the caller must hold the lock.
+func (d *Docker) lookup(name string) *Container {
+
+	name = strings.TrimPrefix(name, "/")
+	if c, exist := d.containers[name]; exist {
+		return c
+	}
+	for _, c := range d.containers {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+
+}
+
+// matchNames returns true if a given name contains any of given names or
+// there are no names, as the name filter of docker does.
+func matchNames(name string, names []string) bool {
+
+	if len(names) == 0 {
+		return true
+	}
+	for _, v := range names {
+		if strings.Contains(name, v) {
+			return true
+		}
+	}
+	return false
+
+}
+
+// Env returns the value of a given environment variable of this container.
+func (c *Container) Env(key string) string {
+
+	for _, v := range c.Config.Env {
+		if strings.HasPrefix(v, key+"=") {
+			return strings.TrimPrefix(v, key+"=")
+		}
+	}
+	return ""
+
+}
+
+// Mount returns the host path mounted on a given target in this container;
+// it returns an empty string if no directories are mounted there.
+func (c *Container) Mount(target string) string {
+
+	for _, v := range c.Host.Mounts {
+		if v.Target == target {
+			return v.Source
+		}
+	}
+	return ""
+
+}
+
+// State returns the status of this container.
+func (c *Container) State() string {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.status
+
+}
+
+// Running returns true if this container is running.
+func (c *Container) Running() bool {
+	return c.State() == "running"
+}
+
+// ExitCode returns the exit code of this container.
+func (c *Container) ExitCode() int {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.exitCode
+
+}
+
+// Done returns a channel which is closed when this container stops.
+func (c *Container) Done() <-chan struct{} {
+	return c.done
+}
+
+// start runs a given behavior in a goroutine.
+func (c *Container) start(behavior Behavior) {
+
+	c.mutex.Lock()
+	c.status = "running"
+	c.mutex.Unlock()
+	go func() {
+		c.finish(behavior(c))
+	}()
+
+}
+
+// finish stops this container with a given exit code unless it has stopped.
+func (c *Container) finish(code int) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.status != "running" {
+		return
+	}
+	c.status = "exited"
+	c.exitCode = code
+	close(c.done)
+	c.logs.Close()
+
+}
+
+// logBuffer stores outputs of a container.
+type logBuffer struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	data   []byte
+	closed bool
+}
+
+func newLogBuffer() *logBuffer {
+
+	b := new(logBuffer)
+	b.cond = sync.NewCond(&b.mutex)
+	return b
+
+}
+
+// Write appends given data unless the buffer is closed.
+func (b *logBuffer) Write(p []byte) (int, error) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	b.data = append(b.data, p...)
+	b.cond.Broadcast()
+	return len(p), nil
+
+}
+
+// Close closes the buffer; readers get io.EOF after reading all data.
+func (b *logBuffer) Close() error {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+	return nil
+
+}
+
+// logReader reads a logBuffer from the beginning.
+type logReader struct {
+	buffer *logBuffer
+	offset int
+	closed bool
+}
+
+// Read blocks until new data are written or the buffer is closed.
+func (r *logReader) Read(p []byte) (n int, err error) {
+
+	b := r.buffer
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for r.offset == len(b.data) && !b.closed && !r.closed {
+		b.cond.Wait()
+	}
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if r.offset == len(b.data) {
+		return 0, io.EOF
+	}
+	n = copy(p, b.data[r.offset:])
+	r.offset += n
+	return
+
+}
+
+// Close stops reading.
+func (r *logReader) Close() error {
+
+	b := r.buffer
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	r.closed = true
+	b.cond.Broadcast()
+	return nil
+
+}
+
+// logWriter writes outputs of a container to a logBuffer as docker does; it
+// multiplexes them and puts timestamps at heads of lines.
+type logWriter struct {
+	mutex  sync.Mutex
+	buffer *logBuffer
+	stream stdcopy.StdType
+	head   bool
+}
+
+// Write writes given data.
+func (w *logWriter) Write(p []byte) (n int, err error) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var data []byte
+	for _, c := range p {
+		if w.head {
+			data = append(data, time.Now().UTC().Format(time.RFC3339Nano)+" "...)
+			w.head = false
+		}
+		data = append(data, c)
+		if c == '\n' {
+			w.head = true
+		}
+	}
+	if _, err = stdcopy.NewStdWriter(w.buffer, w.stream).Write(data); err != nil {
+		return
+	}
+	return len(p), nil
+
+}
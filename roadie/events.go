@@ -0,0 +1,199 @@
+//
+// roadie/events.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultScheduledEventsURL defines the Scheduled Events endpoint of the
+	// Azure instance metadata service.
+	DefaultScheduledEventsURL = "http://169.254.169.254/metadata/scheduledevents?api-version=2017-11-01"
+	// DefaultInstanceNameURL defines the endpoint of the Azure instance
+	// metadata service which returns the name of this virtual machine.
+	DefaultInstanceNameURL = "http://169.254.169.254/metadata/instance/compute/name?api-version=2017-08-01&format=text"
+	// MetadataTimeout defines how long a request to the instance metadata
+	// service takes at most; the service is local and answers quickly.
+	MetadataTimeout = 10 * time.Second
+	// EventTypePreempt is the type of events evicting low-priority and spot
+	// virtual machines.
+	EventTypePreempt = "Preempt"
+	// EventTypeTerminate is the type of events deleting virtual machines.
+	EventTypeTerminate = "Terminate"
+	// DefaultEvictionNotice defines how long an eviction takes to start if
+	// the event doesn't have its start time.
+	DefaultEvictionNotice = 30 * time.Second
+)
+
+var (
+	// EventsPollInterval defines how often scheduled events are checked.
+	EventsPollInterval = 5 * time.Second
+
+	// metadataClient requests the instance metadata service.
+	metadataClient = &http.Client{
+		Timeout: MetadataTimeout,
+	}
+)
+
+// ScheduledEvent defines an event scheduled for virtual machines.
+type ScheduledEvent struct {
+	EventID      string   `json:"EventId"`
+	EventType    string   `json:"EventType"`
+	ResourceType string   `json:"ResourceType"`
+	Resources    []string `json:"Resources"`
+	EventStatus  string   `json:"EventStatus"`
+	// NotBefore is the time after which the event can start in RFC1123; it is
+	// empty if the event has started.
+	NotBefore string `json:"NotBefore"`
+}
+
+// ScheduledEvents defines the response of the Scheduled Events endpoint.
+type ScheduledEvents struct {
+	DocumentIncarnation int              `json:"DocumentIncarnation"`
+	Events              []ScheduledEvent `json:"Events"`
+}
+
+// IsEviction returns true if this event stops virtual machines without
+// bringing them back.
+func (e *ScheduledEvent) IsEviction() bool {
+	return e.EventType == EventTypePreempt || e.EventType == EventTypeTerminate
+}
+
+// Affects returns true if this event targets a given named virtual machine.
+func (e *ScheduledEvent) Affects(name string) bool {
+
+	for _, v := range e.Resources {
+		// Names of Azure resources are case-insensitive.
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+
+}
+
+// Deadline returns when this event starts; if the start time isn't given,
+// DefaultEvictionNotice after a given time is returned.
+func (e *ScheduledEvent) Deadline(now time.Time) time.Time {
+
+	t, err := time.Parse(time.RFC1123, e.NotBefore)
+	if err != nil {
+		return now.Add(DefaultEvictionNotice)
+	}
+	return t
+
+}
+
+// GetInstanceName fetches the name of this virtual machine from a given
+// endpoint of the instance metadata service.
+func GetInstanceName(ctx context.Context, endpoint string) (name string, err error) {
+
+	data, err := getMetadata(ctx, endpoint)
+	if err != nil {
+		return
+	}
+	name = strings.TrimSpace(string(data))
+	if name == "" {
+		err = fmt.Errorf("The instance metadata service returns an empty name")
+	}
+	return
+
+}
+
+// GetScheduledEvents fetches events scheduled for this machine from a given
+// Scheduled Events endpoint.
+func GetScheduledEvents(ctx context.Context, endpoint string) (res *ScheduledEvents, err error) {
+
+	data, err := getMetadata(ctx, endpoint)
+	if err != nil {
+		return
+	}
+	res = new(ScheduledEvents)
+	if err = json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	return
+
+}
+
+// getMetadata requests a given endpoint of the instance metadata service and
+// returns the body.
+func getMetadata(ctx context.Context, endpoint string) (data []byte, err error) {
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := metadataClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Cannot get %v (%v): %s", endpoint, resp.Status, data)
+	}
+	return
+
+}
+
+// WaitEviction polls a given Scheduled Events endpoint until an eviction of
+// a given named machine is scheduled and returns the event; events for other
+// machines in the same availability set or scale set are ignored. It returns
+// an error only if the context is canceled; errors in fetching events are
+// ignored since they can be temporal.
+func WaitEviction(ctx context.Context, endpoint, instance string) (event *ScheduledEvent, err error) {
+
+	ticker := time.NewTicker(EventsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		events, err := GetScheduledEvents(ctx, endpoint)
+		if err != nil {
+			continue
+		}
+		for i := range events.Events {
+			if events.Events[i].IsEviction() && events.Events[i].Affects(instance) {
+				return &events.Events[i], nil
+			}
+		}
+	}
+
+}
@@ -0,0 +1,191 @@
+//
+// roadie/events_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newEventsServer creates a stand-in of the Scheduled Events endpoint which
+// returns given documents in order; the last one is repeated.
+func newEventsServer(t *testing.T, docs ...ScheduledEvents) *httptest.Server {
+
+	var count int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		i := int(atomic.AddInt32(&count, 1)) - 1
+		if i >= len(docs) {
+			i = len(docs) - 1
+		}
+		if err := json.NewEncoder(w).Encode(docs[i]); err != nil {
+			t.Errorf("cannot encode scheduled events: %v", err)
+		}
+	}))
+
+}
+
+func TestGetScheduledEvents(t *testing.T) {
+
+	server := newEventsServer(t, ScheduledEvents{
+		DocumentIncarnation: 1,
+		Events: []ScheduledEvent{
+			{
+				EventID:      "602d9444-d2cd-49c7-8624-8643e7171297",
+				EventType:    EventTypePreempt,
+				ResourceType: "VirtualMachine",
+				Resources:    []string{"vm1"},
+				EventStatus:  "Scheduled",
+				NotBefore:    "Mon, 19 Sep 2016 18:29:47 GMT",
+			},
+		},
+	})
+	defer server.Close()
+
+	res, err := GetScheduledEvents(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("GetScheduledEvents returns an error: %v", err)
+	}
+	if res.DocumentIncarnation != 1 || len(res.Events) != 1 {
+		t.Fatalf("GetScheduledEvents returns %+v", res)
+	}
+	event := res.Events[0]
+	if !event.IsEviction() {
+		t.Errorf("event %+v isn't an eviction", event)
+	}
+	expect := time.Date(2016, 9, 19, 18, 29, 47, 0, time.UTC)
+	if deadline := event.Deadline(time.Now()); !deadline.Equal(expect) {
+		t.Errorf("deadline is %v, want %v", deadline, expect)
+	}
+
+	// Events which have started don't have NotBefore.
+	now := time.Now()
+	event.NotBefore = ""
+	if deadline := event.Deadline(now); !deadline.Equal(now.Add(DefaultEvictionNotice)) {
+		t.Errorf("deadline is %v, want %v", deadline, now.Add(DefaultEvictionNotice))
+	}
+
+	event.EventType = "Reboot"
+	if event.IsEviction() {
+		t.Errorf("event %+v is an eviction", event)
+	}
+
+	if !event.Affects("VM1") {
+		t.Errorf("event %+v doesn't affect vm1", event)
+	}
+	if event.Affects("vm2") {
+		t.Errorf("event %+v affects vm2", event)
+	}
+
+	server = httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	if _, err = GetScheduledEvents(context.Background(), server.URL); err == nil {
+		t.Error("GetScheduledEvents doesn't return any errors")
+	}
+
+}
+
+func TestWaitEviction(t *testing.T) {
+
+	defer setDuration(&EventsPollInterval, 10*time.Millisecond)()
+
+	server := newEventsServer(t,
+		ScheduledEvents{DocumentIncarnation: 1},
+		ScheduledEvents{
+			DocumentIncarnation: 2,
+			Events: []ScheduledEvent{
+				{EventID: "reboot", EventType: "Reboot"},
+			},
+		},
+		ScheduledEvents{
+			DocumentIncarnation: 3,
+			Events: []ScheduledEvent{
+				{EventID: "reboot", EventType: "Reboot", Resources: []string{"vm1"}},
+				{EventID: "other", EventType: EventTypePreempt, Resources: []string{"vm2"}},
+			},
+		},
+		ScheduledEvents{
+			DocumentIncarnation: 4,
+			Events: []ScheduledEvent{
+				{EventID: "other", EventType: EventTypePreempt, Resources: []string{"vm2"}},
+				{EventID: "preempt", EventType: EventTypePreempt, Resources: []string{"vm2", "vm1"}},
+			},
+		},
+	)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	event, err := WaitEviction(ctx, server.URL, "vm1")
+	if err != nil {
+		t.Fatalf("WaitEviction returns an error: %v", err)
+	}
+	if event.EventID != "preempt" {
+		t.Errorf("WaitEviction returns %+v", event)
+	}
+
+	// Canceling the context stops waiting.
+	server = newEventsServer(t, ScheduledEvents{DocumentIncarnation: 1})
+	defer server.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = WaitEviction(ctx, server.URL, "vm1"); err != context.DeadlineExceeded {
+		t.Errorf("WaitEviction returns %v, want %v", err, context.DeadlineExceeded)
+	}
+
+}
+
+func TestGetInstanceName(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "vm1\n")
+	}))
+	defer server.Close()
+
+	name, err := GetInstanceName(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("GetInstanceName returns an error: %v", err)
+	}
+	if name != "vm1" {
+		t.Errorf("GetInstanceName returns %q, want %q", name, "vm1")
+	}
+
+	server = httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	if _, err = GetInstanceName(context.Background(), server.URL); err == nil {
+		t.Error("GetInstanceName doesn't return any errors")
+	}
+
+}
@@ -0,0 +1,208 @@
+//
+// roadie/jsonlog.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PhaseSource is the phase preparing source code.
+	PhaseSource = "source"
+	// PhaseData is the phase downloading data files.
+	PhaseData = "data"
+	// PhaseBuild is the phase building a sandbox image.
+	PhaseBuild = "build"
+	// PhaseRun is the phase running the sandbox container.
+	PhaseRun = "run"
+	// PhaseUpload is the phase uploading result files.
+	PhaseUpload = "upload"
+
+	// LevelInfo is the level of ordinary messages.
+	LevelInfo = "info"
+	// LevelError is the level of error messages.
+	LevelError = "error"
+
+	// StreamStdout is the name of the standard output.
+	StreamStdout = "stdout"
+	// StreamStderr is the name of the standard error.
+	StreamStderr = "stderr"
+
+	// NoStep is a step index meaning no run steps are executing.
+	NoStep = -1
+
+	// errorPrefix is the prefix of error messages in plain text logs.
+	errorPrefix = "* "
+)
+
+// OutputRecorder is implemented by log writers which record which stream and
+// run step an output line comes from; if the given time is zero, the current
+// time is used.
+type OutputRecorder interface {
+	RecordOutput(t time.Time, stream string, step int, line string) error
+}
+
+// LogRecord defines a line of structured logs.
+type LogRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Phase   string    `json:"phase,omitempty"`
+	Step    *int      `json:"step,omitempty"`
+	Stream  string    `json:"stream,omitempty"`
+	Message string    `json:"message"`
+}
+
+// JSONLogWriter is a writer which converts written messages to JSON lines.
+// Each written line becomes one record; lines starting with "* " are recorded
+// as errors.
+type JSONLogWriter struct {
+	writer io.Writer
+	mutex  sync.Mutex
+	phase  string
+	step   int
+}
+
+// NewJSONLogWriter creates a new JSON log writer which writes records to a
+// given writer. Loggers using the returned writer shouldn't add any
+// prefixes, i.e. flags should be 0.
+func NewJSONLogWriter(writer io.Writer) *JSONLogWriter {
+	return &JSONLogWriter{
+		writer: writer,
+		step:   NoStep,
+	}
+}
+
+// SetPhase sets the current phase; the current step is reset.
+func (w *JSONLogWriter) SetPhase(phase string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.phase = phase
+	w.step = NoStep
+}
+
+// SetStep sets the index of the current run step.
+func (w *JSONLogWriter) SetStep(step int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.step = step
+}
+
+// BeginStep sets the current run step so that JSONLogWriter can observe step
+// markers of a sandbox container.
+func (w *JSONLogWriter) BeginStep(index int) {
+	w.SetStep(index)
+}
+
+// EndStep resets the current run step.
+func (w *JSONLogWriter) EndStep(index, code int) {
+	w.SetStep(NoStep)
+}
+
+// Write records each line in a given message.
+func (w *JSONLogWriter) Write(p []byte) (n int, err error) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		level := LevelInfo
+		if strings.HasPrefix(line, errorPrefix) {
+			level = LevelError
+			line = strings.TrimPrefix(line, errorPrefix)
+		}
+		err = w.write(time.Now(), level, "", w.step, line)
+		if err != nil {
+			return
+		}
+	}
+	return len(p), nil
+
+}
+
+// RecordOutput records a line of a given output stream of a given run step;
+// if the step is NoStep, the current step is used.
+func (w *JSONLogWriter) RecordOutput(t time.Time, stream string, step int, line string) error {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if t.IsZero() {
+		t = time.Now()
+	}
+	if step == NoStep {
+		step = w.step
+	}
+	return w.write(t, LevelInfo, stream, step, line)
+
+}
+
+// write writes a record; the mutex must be locked.
+func (w *JSONLogWriter) write(t time.Time, level, stream string, step int, msg string) error {
+
+	record := LogRecord{
+		Time:    t.UTC(),
+		Level:   level,
+		Phase:   w.phase,
+		Stream:  stream,
+		Message: msg,
+	}
+	if step != NoStep {
+		record.Step = &step
+	}
+
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.Write(append(data, '\n'))
+	return err
+
+}
+
+// logOutput writes a line of a given output stream to a given recorder; if
+// the recorder is nil, the line is written to a given logger and, if the time
+// isn't zero, it is tagged with the time, stream, and step.
+func logOutput(logger *log.Logger, recorder OutputRecorder, t time.Time, stream string, step int, line string) {
+
+	if recorder != nil {
+		if recorder.RecordOutput(t, stream, step, line) == nil {
+			return
+		}
+	}
+
+	if t.IsZero() {
+		logger.Println(line)
+		return
+	}
+	label := "-"
+	if step != NoStep {
+		label = fmt.Sprint(step)
+	}
+	logger.Printf("%v %v[%v] %v", t.UTC().Format(time.RFC3339Nano), stream, label, line)
+
+}
@@ -0,0 +1,174 @@
+//
+// roadie/jsonlog_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestJSONLogWriter(t *testing.T) {
+
+	var buf bytes.Buffer
+	writer := NewJSONLogWriter(&buf)
+	logger := log.New(writer, "", 0)
+
+	writer.SetPhase(PhaseBuild)
+	logger.Println("building")
+	logger.Println("* failed")
+	writer.SetPhase(PhaseRun)
+	writer.BeginStep(2)
+	logOutput(logger, writer, time.Time{}, StreamStderr, NoStep, "output")
+	writer.EndStep(2, 0)
+	logger.Println("finished")
+
+	var records []LogRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("cannot parse a record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 4 {
+		t.Fatalf("%v records are written, want 4", len(records))
+	}
+
+	if r := records[0]; r.Level != LevelInfo || r.Phase != PhaseBuild || r.Step != nil || r.Message != "building" {
+		t.Errorf("first record is %+v", r)
+	}
+	if r := records[1]; r.Level != LevelError || r.Message != "failed" {
+		t.Errorf("second record is %+v", r)
+	}
+	if r := records[2]; r.Phase != PhaseRun || r.Step == nil || *r.Step != 2 || r.Stream != StreamStderr || r.Message != "output" {
+		t.Errorf("third record is %+v", r)
+	}
+	if r := records[3]; r.Phase != PhaseRun || r.Step != nil || r.Stream != "" || r.Message != "finished" {
+		t.Errorf("fourth record is %+v", r)
+	}
+
+}
+
+func TestExecCommandStreams(t *testing.T) {
+
+	var buf bytes.Buffer
+	writer := NewJSONLogWriter(&buf)
+	logger := log.New(writer, "", 0)
+
+	err := ExecCommand(exec.Command("sh", "-c", "echo out; echo err >&2"), logger, writer)
+	if err != nil {
+		t.Fatalf("ExecCommand returns an error: %v", err)
+	}
+
+	streams := make(map[string]string)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r LogRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("cannot parse a record %q: %v", scanner.Text(), err)
+		}
+		streams[r.Message] = r.Stream
+	}
+	if streams["out"] != StreamStdout {
+		t.Errorf("stream of %q is %q, want %q", "out", streams["out"], StreamStdout)
+	}
+	if streams["err"] != StreamStderr {
+		t.Errorf("stream of %q is %q, want %q", "err", streams["err"], StreamStderr)
+	}
+
+}
+
+func TestForwardOutputs(t *testing.T) {
+
+	var stream bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(&stream, stdcopy.Stderr)
+	stdout.Write([]byte("2017-10-06T12:00:00.5Z ##roadie-step-begin 1\n"))
+	stdout.Write([]byte("2017-10-06T12:00:01Z hello\n"))
+	stderr.Write([]byte("2017-10-06T12:00:02Z warn"))
+	stderr.Write([]byte("ing\n"))
+	stdout.Write([]byte("2017-10-06T12:00:03Z ##roadie-step-end 1 0\n"))
+	stdout.Write([]byte("2017-10-06T12:00:04Z bye\n"))
+
+	var buf bytes.Buffer
+	writer := NewJSONLogWriter(&buf)
+	d := &DockerClient{
+		Logger:   log.New(writer, "", 0),
+		Recorder: writer,
+	}
+	var steps stepRecorder
+	if err := d.forwardOutputs(&stream, &steps); err != nil {
+		t.Fatalf("forwardOutputs returns an error: %v", err)
+	}
+	if len(steps) != 2 || steps[0] != "begin 1" || steps[1] != "end 1 0" {
+		t.Errorf("observed steps are %v", steps)
+	}
+
+	one := 1
+	expects := []LogRecord{
+		{Time: time.Date(2017, 10, 6, 12, 0, 1, 0, time.UTC), Stream: StreamStdout, Step: &one, Message: "hello"},
+		{Time: time.Date(2017, 10, 6, 12, 0, 2, 0, time.UTC), Stream: StreamStderr, Step: &one, Message: "warning"},
+		{Time: time.Date(2017, 10, 6, 12, 0, 4, 0, time.UTC), Stream: StreamStdout, Message: "bye"},
+	}
+	scanner := bufio.NewScanner(&buf)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var r LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("cannot parse a record %q: %v", scanner.Text(), err)
+		}
+		if i >= len(expects) {
+			continue
+		}
+		e := expects[i]
+		if !r.Time.Equal(e.Time) || r.Stream != e.Stream || r.Message != e.Message {
+			t.Errorf("record %v is %+v, want %+v", i, r, e)
+		}
+		if (r.Step == nil) != (e.Step == nil) || (r.Step != nil && *r.Step != *e.Step) {
+			t.Errorf("record %v has step %v, want %v", i, r.Step, e.Step)
+		}
+	}
+	if i != len(expects) {
+		t.Errorf("%v records are written, want %v", i, len(expects))
+	}
+
+}
+
+// stepRecorder records notified steps.
+type stepRecorder []string
+
+func (r *stepRecorder) BeginStep(index int) {
+	*r = append(*r, fmt.Sprintf("begin %v", index))
+}
+
+func (r *stepRecorder) EndStep(index, code int) {
+	*r = append(*r, fmt.Sprintf("end %v %v", index, code))
+}
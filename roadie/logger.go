@@ -25,47 +25,221 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
 
-	"github.com/Azure/azure-sdk-for-go/storage"
-	"github.com/jkawamoto/roadie/cloud/azure"
+const (
+	// MaxLogBlockSize defines the maximum size of a chunk of log messages
+	// appended at once.
+	MaxLogBlockSize = 4 * 1024 * 1024
+	// LogRetry defines how many times sending a block is retried.
+	LogRetry = 3
 )
 
-// pipedWriter is a WriterClose which uploads written messages to a cloud storage.
-type pipedWriter struct {
-	io.WriteCloser
-	done chan struct{}
-}
+var (
+	// LogFlushInterval defines how often spooled log messages are sent to the
+	// storage.
+	LogFlushInterval = 10 * time.Second
+	// LogUploadInterval defines how often spooled log messages are sent to
+	// storages which aren't Appenders; it is longer than LogFlushInterval
+	// since the whole spool is uploaded every time.
+	LogUploadInterval = time.Minute
+	// LogRetryInterval defines the first interval between retries; it doubles
+	// every retry.
+	LogRetryInterval = time.Second
+)
 
-// Close this writer.
-func (w *pipedWriter) Close() (err error) {
-	err = w.WriteCloser.Close()
-	<-w.done
-	return
+// logWriter is a WriteCloser which spools written messages to a local file
+// and periodically sends them to a file in the log container of a storage.
+// If the storage is an Appender, each chunk of messages is appended to the
+// file so that the file can be read while it is written; otherwise the whole
+// spool is uploaded every time.
+type logWriter struct {
+	ctx   context.Context
+	store Storage
+	name  string
+	debug io.Writer
+
+	// mutex protects spool, size, and closed.
+	mutex  sync.Mutex
+	spool  *os.File
+	size   int64
+	closed bool
+
+	// sent is accessed only from flush.
+	sent int64
+
+	stop chan struct{}
+	done chan struct{}
 }
 
 // NewLogWriter creates a new writer which writes messages to a given named
-// file in the cloud storage.
-func NewLogWriter(ctx context.Context, store *azure.StorageService, name string, debug io.Writer) (writer io.WriteCloser) {
+// file in the log container of a given storage. Written messages are spooled
+// to a local file so that writing never blocks even if the storage isn't
+// available;
+// errors are written to a given debug writer if it isn't nil.
+func NewLogWriter(ctx context.Context, store Storage, name string, debug io.Writer) io.WriteCloser {
+
+	if debug == nil {
+		debug = ioutil.Discard
+	}
 
-	reader, writer := io.Pipe()
-	done := make(chan struct{}, 1)
+	w := &logWriter{
+		ctx:   ctx,
+		store: store,
+		name:  name,
+		debug: debug,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	spool, err := ioutil.TempFile("", "roadie-log-")
+	if err != nil {
+		// Messages will be lost but writing them shouldn't fail.
+		fmt.Fprintln(debug, "Cannot create a spool file:", err)
+		close(w.done)
+		return w
+	}
+	w.spool = spool
 
 	go func() {
-		defer reader.Close()
-		err := store.UploadWithMetadata(ctx, azure.LogContainer, name, reader, &storage.BlobProperties{
-			ContentType: "text/plain",
-		}, nil)
-		if err != nil {
-			if debug != nil {
-				fmt.Fprintln(debug, err.Error())
+		defer close(w.done)
+		interval := LogFlushInterval
+		if _, ok := store.(Appender); !ok {
+			interval = LogUploadInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.flush()
+			case <-w.stop:
+				return
+			case <-ctx.Done():
+				return
 			}
 		}
-		close(done)
 	}()
+	return w
+
+}
+
+// Write spools a given message.
+func (w *logWriter) Write(p []byte) (n int, err error) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("Log writer has been closed")
+	} else if w.spool == nil {
+		return len(p), nil
+	}
+
+	n, err = w.spool.Write(p)
+	w.size += int64(n)
+	return
+
+}
+
+// Close sends remaining messages and closes this writer. If all messages are
+// sent, the spool file is removed; otherwise it is kept and its path is
+// written to the debug writer.
+func (w *logWriter) Close() (err error) {
+
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return
+	}
+	w.closed = true
+	w.mutex.Unlock()
 
-	return &pipedWriter{
-		WriteCloser: writer,
-		done:        done,
+	if w.spool == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+
+	err = w.flush()
+	w.spool.Close()
+	if err != nil {
+		fmt.Fprintln(w.debug, "Log messages are kept in", w.spool.Name())
+		return
+	}
+	return os.Remove(w.spool.Name())
+
+}
+
+// flush sends spooled messages which haven't been sent yet.
+func (w *logWriter) flush() (err error) {
+
+	w.mutex.Lock()
+	size := w.size
+	w.mutex.Unlock()
+	if w.sent >= size {
+		return
+	}
+
+	appender, ok := w.store.(Appender)
+	if !ok {
+		err = w.retry(func() error {
+			return w.store.Upload(w.ctx, LogContainer, w.name, io.NewSectionReader(w.spool, 0, size), "text/plain")
+		})
+		if err != nil {
+			fmt.Fprintln(w.debug, "Cannot send log messages:", err)
+			return
+		}
+		w.sent = size
+		return
+	}
+
+	for w.sent < size {
+
+		length := size - w.sent
+		if length > MaxLogBlockSize {
+			length = MaxLogBlockSize
+		}
+		chunk := make([]byte, length)
+		_, err = w.spool.ReadAt(chunk, w.sent)
+		if err != nil {
+			fmt.Fprintln(w.debug, "Cannot read the spool file:", err)
+			return
+		}
+
+		err = w.retry(func() error {
+			return appender.Append(w.ctx, LogContainer, w.name, chunk, "text/plain")
+		})
+		if err != nil {
+			fmt.Fprintln(w.debug, "Cannot send log messages:", err)
+			return
+		}
+		w.sent += length
+
+	}
+	return
+
+}
+
+// retry calls a given function until it succeeds at most LogRetry times; it
+// waits only between attempts.
+func (w *logWriter) retry(f func() error) (err error) {
+
+	wait := LogRetryInterval
+	for i := 1; ; i++ {
+		if err = f(); err == nil || i >= LogRetry {
+			return
+		}
+		select {
+		case <-time.After(wait):
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		}
+		wait *= 2
 	}
 
 }
@@ -25,37 +25,26 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"os"
+	"path/filepath"
 	"testing"
-
-	"github.com/jkawamoto/roadie/cloud/azure"
-	"github.com/jkawamoto/roadie/cloud/azure/mock"
+	"time"
 )
 
 func TestLogWriter(t *testing.T) {
 
-	server := mock.NewStorageServer()
+	store, server := newMockStorage(t)
 	defer server.Close()
 
-	cli, err := server.GetClient()
-	if err != nil {
-		t.Fatalf("cannot get a client: %v", err)
-	}
-
-	store := azure.StorageService{
-		Client: cli.GetBlobService(),
-		Logger: log.New(ioutil.Discard, "", log.LstdFlags),
-	}
-
 	testName := "test-name"
 	var expected string
-	log := NewLogWriter(context.Background(), &store, testName, nil)
+	log := NewLogWriter(context.Background(), NewAzureStorage(StaticStorage(store)), testName, nil)
 	for i := 0; i != 10; i++ {
 		msg := fmt.Sprintf("msg,%v\n", i)
 		fmt.Fprint(log, msg)
 		expected += msg
 	}
-	err = log.Close()
+	err := log.Close()
 	if err != nil {
 		t.Fatalf("cannot close a log writer: %v", err)
 	}
@@ -68,7 +57,104 @@ func TestLogWriter(t *testing.T) {
 		t.Fatalf("log file doesn't exist")
 	}
 	if f.Body != expected {
-		t.Errorf("stored log file os %q, want %q", f.Body, expected)
+		t.Errorf("stored log file is %q, want %q", f.Body, expected)
+	}
+
+}
+
+func TestLogWriterFlush(t *testing.T) {
+
+	store, server := newMockStorage(t)
+	defer server.Close()
+
+	defer setDuration(&LogFlushInterval, 10*time.Millisecond)()
+
+	testName := "test-name"
+	log := NewLogWriter(context.Background(), NewAzureStorage(StaticStorage(store)), testName, nil)
+	defer log.Close()
+
+	expected := "msg,0\n"
+	fmt.Fprint(log, expected)
+	time.Sleep(10 * LogFlushInterval)
+
+	// The message must be readable before the writer is closed.
+	c, ok := server.Items["log"]
+	if !ok {
+		t.Fatal("container logged files are stored doesn't found")
+	}
+	f, ok := c[testName]
+	if !ok {
+		t.Fatalf("log file doesn't exist")
+	}
+	if f.Body != expected {
+		t.Errorf("stored log file is %q, want %q", f.Body, expected)
+	}
+
+}
+
+func TestLogWriterUpload(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	defer setDuration(&LogFlushInterval, 10*time.Millisecond)()
+	defer setDuration(&LogUploadInterval, time.Hour)()
+
+	// Embedding the interface hides Append of the local storage.
+	store := struct{ Storage }{NewLocalStorage(tmp)}
+	testName := "test-name"
+	log := NewLogWriter(context.Background(), store, testName, nil)
+
+	expected := "msg,0\n"
+	fmt.Fprint(log, expected)
+	time.Sleep(10 * LogFlushInterval)
+
+	// Storages which cannot append data don't receive the log so often.
+	filename := filepath.Join(tmp, LogContainer, testName)
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("log file is uploaded before the upload interval: %v", err)
+	}
+
+	if err = log.Close(); err != nil {
+		t.Fatalf("cannot close a log writer: %v", err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("cannot read the log file: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("stored log file is %q, want %q", data, expected)
+	}
+
+}
+
+func TestLogWriterRetry(t *testing.T) {
+
+	defer setDuration(&LogRetryInterval, 100*time.Millisecond)()
+	w := &logWriter{
+		ctx: context.Background(),
+	}
+
+	var calls int
+	start := time.Now()
+	err := w.retry(func() error {
+		calls++
+		return fmt.Errorf("error %v", calls)
+	})
+	elapsed := time.Since(start)
+	if err == nil || err.Error() != fmt.Sprint("error ", LogRetry) {
+		t.Errorf("retry returns %v, want the last error", err)
+	}
+	if calls != LogRetry {
+		t.Errorf("the function is called %v times, want %v", calls, LogRetry)
+	}
+	// It waits 1, 2, ..., 2^(LogRetry-2) intervals between attempts but not
+	// after the last one.
+	if expect := time.Duration(1<<uint(LogRetry-1)) * LogRetryInterval; elapsed >= expect {
+		t.Errorf("retry takes %v, want less than %v", elapsed, expect)
 	}
 
 }
@@ -0,0 +1,188 @@
+//
+// roadie/matrix.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// MatrixIndexFile is the name of the file mapping IDs of combinations to
+	// their parameters; it is uploaded with result files.
+	MatrixIndexFile = "matrix.json"
+	// CombinationEnv is the name of an environment variable which has the ID
+	// of the combination given to the sandbox container.
+	CombinationEnv = "ROADIE_COMBINATION"
+)
+
+var (
+	// RegexpParamName is a regular expression which names of parameters must
+	// match so that they can be used as environment variables.
+	RegexpParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Matrix maps names of parameters to their values; every combination of
+// the values runs separately.
+type Matrix map[string][]string
+
+// Combination is a combination of parameters in a matrix.
+type Combination struct {
+	// ID identifies this combination; results are stored under it.
+	ID     string
+	Params map[string]string
+}
+
+// Validate returns an error if names of parameters are invalid or some
+// parameters have no values.
+func (m Matrix) Validate() error {
+
+	for _, name := range m.names() {
+		if !RegexpParamName.MatchString(name) {
+			return fmt.Errorf("Invalid parameter name %q", name)
+		} else if len(m[name]) == 0 {
+			return fmt.Errorf("Parameter %v has no values", name)
+		}
+	}
+	return nil
+
+}
+
+// Combinations returns every combination of parameters; parameters are
+// ordered by their names and the last one varies fastest.
+func (m Matrix) Combinations() (res []Combination) {
+
+	if len(m) == 0 {
+		return
+	}
+	names := m.names()
+	total := 1
+	for _, name := range names {
+		total *= len(m[name])
+	}
+	width := len(fmt.Sprint(total - 1))
+
+	for i := 0; i != total; i++ {
+		params := make(map[string]string)
+		rest := i
+		for j := len(names) - 1; j >= 0; j-- {
+			values := m[names[j]]
+			params[names[j]] = values[rest%len(values)]
+			rest /= len(values)
+		}
+		res = append(res, Combination{
+			ID:     fmt.Sprintf("%0*d", width, i),
+			Params: params,
+		})
+	}
+	return
+
+}
+
+// names returns the sorted names of parameters.
+func (m Matrix) names() (res []string) {
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return
+}
+
+// Expand returns a script for each combination of parameters in the matrix;
+// references {{name}} in run steps are replaced with parameter values, and
+// parameters are given to the sandbox container as environment variables.
+// If the matrix is empty, this script is returned.
+func (s *Script) Expand() (res []*Script, err error) {
+
+	if len(s.Matrix) == 0 {
+		return []*Script{s}, nil
+	}
+	if err = s.Matrix.Validate(); err != nil {
+		return
+	}
+
+	for _, c := range s.Matrix.Combinations() {
+
+		var pairs []string
+		env := make(map[string]string)
+		for k, v := range s.Env {
+			env[k] = v
+		}
+		for k, v := range c.Params {
+			pairs = append(pairs, fmt.Sprintf("{{%v}}", k), v)
+			env[k] = v
+		}
+		env[CombinationEnv] = c.ID
+		replacer := strings.NewReplacer(pairs...)
+
+		inner := *s.Script
+		inner.Run = make([]string, len(s.Run))
+		for i, step := range s.Run {
+			inner.Run[i] = replacer.Replace(step)
+		}
+
+		expanded := *s
+		expanded.Script = &inner
+		expanded.Env = env
+		combination := c
+		expanded.Combination = &combination
+		res = append(res, &expanded)
+
+	}
+	return
+
+}
+
+// UploadIndex uploads a file mapping IDs of given expanded scripts'
+// combinations to their parameters.
+func (s *Script) UploadIndex(ctx context.Context, store Storage, runs []*Script) (err error) {
+
+	index := make(map[string]map[string]string)
+	for _, r := range runs {
+		if r.Combination != nil {
+			index[r.Combination.ID] = r.Combination.Params
+		}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return
+	}
+	return store.Upload(ctx, ResultContainer, path.Join(s.resultPrefix(), MatrixIndexFile), bytes.NewReader(data), "application/json")
+
+}
+
+// resultPrefix returns the prefix of result files of this script.
+func (s *Script) resultPrefix() string {
+
+	prefix := strings.TrimPrefix(s.Name, "task-")
+	if s.Combination != nil {
+		prefix = path.Join(prefix, s.Combination.ID)
+	}
+	return prefix
+
+}
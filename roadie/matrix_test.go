@@ -0,0 +1,174 @@
+//
+// roadie/matrix_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+
+	m := Matrix{
+		"lr":    {"0.1", "0.01"},
+		"batch": {"32", "64", "128"},
+	}
+	res := m.Combinations()
+	expect := []Combination{
+		{"0", map[string]string{"batch": "32", "lr": "0.1"}},
+		{"1", map[string]string{"batch": "32", "lr": "0.01"}},
+		{"2", map[string]string{"batch": "64", "lr": "0.1"}},
+		{"3", map[string]string{"batch": "64", "lr": "0.01"}},
+		{"4", map[string]string{"batch": "128", "lr": "0.1"}},
+		{"5", map[string]string{"batch": "128", "lr": "0.01"}},
+	}
+	if !reflect.DeepEqual(res, expect) {
+		t.Errorf("Combinations returns %v, want %v", res, expect)
+	}
+
+	// IDs have the same width.
+	m["seed"] = []string{"1", "2"}
+	res = m.Combinations()
+	if len(res) != 12 || res[0].ID != "00" || res[11].ID != "11" {
+		t.Errorf("Combinations returns %v", res)
+	}
+
+	if res = (Matrix{}).Combinations(); len(res) != 0 {
+		t.Errorf("empty matrix has combinations: %v", res)
+	}
+
+}
+
+func TestMatrixValidate(t *testing.T) {
+
+	cases := []struct {
+		matrix Matrix
+		valid  bool
+	}{
+		{Matrix{"lr": {"0.1"}, "_batch2": {"1"}}, true},
+		{Matrix{"learning-rate": {"0.1"}}, false},
+		{Matrix{"2lr": {"0.1"}}, false},
+		{Matrix{"lr": {}}, false},
+	}
+	for _, c := range cases {
+		if err := c.matrix.Validate(); c.valid && err != nil {
+			t.Errorf("Validate returns an error for %v: %v", c.matrix, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("Validate returns no errors for %v", c.matrix)
+		}
+	}
+
+}
+
+func TestExpand(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "script.yml")
+	err = ioutil.WriteFile(filename, []byte(`name: task-sweep
+run:
+  - python train.py --lr {{lr}} --batch {{batch}}
+env:
+  MODE: train
+matrix:
+  lr: [0.1, 0.01]
+  batch: [32]
+`), 0644)
+	if err != nil {
+		t.Fatalf("cannot write a script file: %v", err)
+	}
+	s, err := NewScript(filename, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewScript returns an error: %v", err)
+	}
+
+	runs, err := s.Expand()
+	if err != nil {
+		t.Fatalf("Expand returns an error: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Expand returns %v scripts, want 2", len(runs))
+	}
+	r := runs[1]
+	if expect := []string{"python train.py --lr 0.01 --batch 32"}; !reflect.DeepEqual(r.Run, expect) {
+		t.Errorf("run steps are %v, want %v", r.Run, expect)
+	}
+	if expect := map[string]string{"MODE": "train", "lr": "0.01", "batch": "32", CombinationEnv: "1"}; !reflect.DeepEqual(r.Env, expect) {
+		t.Errorf("environment variables are %v, want %v", r.Env, expect)
+	}
+	if prefix := r.resultPrefix(); prefix != "sweep/1" {
+		t.Errorf("result prefix is %q, want %q", prefix, "sweep/1")
+	}
+
+	// The original script must not be modified.
+	if expect := []string{"python train.py --lr {{lr}} --batch {{batch}}"}; !reflect.DeepEqual(s.Run, expect) {
+		t.Errorf("original run steps are modified: %v", s.Run)
+	}
+	if len(s.Env) != 1 || s.Combination != nil {
+		t.Errorf("original script is modified: %v, %v", s.Env, s.Combination)
+	}
+
+	// Upload the index.
+	store := NewLocalStorage(tmp)
+	if err = s.UploadIndex(context.Background(), store, runs); err != nil {
+		t.Fatalf("UploadIndex returns an error: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(tmp, ResultContainer, "sweep", MatrixIndexFile))
+	if err != nil {
+		t.Fatalf("cannot read the index: %v", err)
+	}
+	var index map[string]map[string]string
+	if err = json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("cannot parse the index: %v", err)
+	}
+	expect := map[string]map[string]string{
+		"0": {"batch": "32", "lr": "0.1"},
+		"1": {"batch": "32", "lr": "0.01"},
+	}
+	if !reflect.DeepEqual(index, expect) {
+		t.Errorf("index is %v, want %v", index, expect)
+	}
+
+}
+
+func TestExpandWithoutMatrix(t *testing.T) {
+
+	s := &Script{}
+	runs, err := s.Expand()
+	if err != nil {
+		t.Fatalf("Expand returns an error: %v", err)
+	}
+	if len(runs) != 1 || runs[0] != s {
+		t.Errorf("Expand returns %v, want the script itself", runs)
+	}
+
+}
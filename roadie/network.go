@@ -0,0 +1,288 @@
+//
+// roadie/network.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+const (
+	// NetworkDefault connects sandbox containers to the default bridge network.
+	NetworkDefault = ""
+	// NetworkNone disables networking of sandbox containers.
+	NetworkNone = "none"
+	// NetworkRestricted allows sandbox containers to connect only to given
+	// hosts.
+	NetworkRestricted = "restricted"
+
+	// firewallChain is the iptables chain docker provides for user rules.
+	firewallChain = "DOCKER-USER"
+	// bridgeNameOption is the network option which names the bridge.
+	bridgeNameOption = "com.docker.network.bridge.name"
+	// resolvConf is the resolver configuration of the host.
+	resolvConf = "/etc/resolv.conf"
+	// resolvedConf is the resolver configuration of systemd-resolved listing
+	// upstream name servers; docker uses it if resolvConf has only the local
+	// stub resolver.
+	resolvedConf = "/run/systemd/resolve/resolv.conf"
+)
+
+// defaultNameservers are used by docker if the host has no name servers
+// reachable from containers.
+var defaultNameservers = []string{"8.8.8.8", "8.8.4.4"}
+
+// restrictedNetwork is a bridge network of which outgoing connections are
+// allowed only to given hosts.
+type restrictedNetwork struct {
+	ID     string
+	Bridge string
+	rules  [][]string
+}
+
+// createRestrictedNetwork creates a bridge network for a given named container
+// and installs firewall rules which allow outgoing connections only to given
+// hosts and DNS servers. Host names are resolved when the network is created.
+func (d *DockerClient) createRestrictedNetwork(ctx context.Context, name string, allow []string) (n *restrictedNetwork, err error) {
+
+	// The embedded DNS server of docker forwards queries from containers to
+	// the name servers of the host.
+	resolvers, err := nameservers(resolvConf, resolvedConf)
+	if err != nil {
+		return
+	}
+
+	var addrs []string
+	for _, host := range allow {
+		var res []string
+		res, err = resolveHost(host)
+		if err != nil {
+			return
+		}
+		addrs = append(addrs, res...)
+	}
+
+	// Name of a network interface must be shorter than 16 characters.
+	bridge := fmt.Sprintf("roadie%08x", crc32.ChecksumIEEE([]byte(name)))
+	d.Logger.Println("Creating a restricted network", bridge)
+	res, err := d.client.NetworkCreate(ctx, restrictedNetworkName(name), types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Options: map[string]string{
+			bridgeNameOption: bridge,
+		},
+	})
+	if err != nil {
+		return
+	}
+	n = &restrictedNetwork{
+		ID:     res.ID,
+		Bridge: bridge,
+	}
+
+	n.rules = restrictedRules(bridge, addrs, resolvers)
+
+	// Insert the rules at the top of the chain keeping their order.
+	for i, rule := range n.rules {
+		args := append([]string{"-I", firewallChain, fmt.Sprint(i + 1)}, rule...)
+		err = ExecCommand(exec.CommandContext(ctx, "iptables", args...), d.Logger, d.Recorder)
+		if err != nil {
+			n.rules = n.rules[:i]
+			d.removeRestrictedNetwork(n)
+			return nil, err
+		}
+	}
+	return
+
+}
+
+// restrictedRules returns firewall rules which allow connections from a given
+// bridge only to given addresses and DNS queries only to given name servers.
+func restrictedRules(bridge string, addrs, resolvers []string) (rules [][]string) {
+
+	for _, addr := range addrs {
+		rules = append(rules, []string{"-i", bridge, "-d", addr, "-j", "ACCEPT"})
+	}
+	for _, addr := range resolvers {
+		for _, proto := range []string{"udp", "tcp"} {
+			rules = append(rules, []string{"-i", bridge, "-d", addr, "-p", proto, "--dport", "53", "-j", "ACCEPT"})
+		}
+	}
+	return append(rules, []string{"-i", bridge, "!", "-o", bridge, "-j", "DROP"})
+
+}
+
+// removeRestrictedNetwork deletes firewall rules and a given network.
+func (d *DockerClient) removeRestrictedNetwork(n *restrictedNetwork) {
+
+	// The context given to Start might have been canceled, use another context
+	// here.
+	ctx := context.Background()
+	for _, rule := range n.rules {
+		args := append([]string{"-D", firewallChain}, rule...)
+		if err := ExecCommand(exec.CommandContext(ctx, "iptables", args...), d.Logger, d.Recorder); err != nil {
+			d.Logger.Println("* Cannot delete a firewall rule:", err)
+		}
+	}
+	if err := d.client.NetworkRemove(ctx, n.ID); err != nil {
+		d.Logger.Println("* Cannot remove network", n.Bridge, ":", err)
+	}
+
+}
+
+// removeStaleNetwork removes the restricted network for a given named
+// container and its firewall rules left by an interrupted execution.
+func (d *DockerClient) removeStaleNetwork(ctx context.Context, name string) (err error) {
+
+	args := filters.NewArgs()
+	args.Add("name", restrictedNetworkName(name))
+	networks, err := d.client.NetworkList(ctx, types.NetworkListOptions{
+		Filters: args,
+	})
+	if err != nil {
+		return
+	}
+	for _, v := range networks {
+		if v.Name != restrictedNetworkName(name) {
+			continue
+		}
+		d.Logger.Println("Removing a stale restricted network", v.Name)
+		n := &restrictedNetwork{
+			ID:     v.ID,
+			Bridge: v.Options[bridgeNameOption],
+		}
+		if n.Bridge != "" {
+			n.rules, err = firewallRules(ctx, n.Bridge)
+			if err != nil {
+				d.Logger.Println("* Cannot list firewall rules:", err)
+			}
+		}
+		d.removeRestrictedNetwork(n)
+	}
+	return nil
+
+}
+
+// restrictedNetworkName returns the name of the restricted network for a given
+// named container.
+func restrictedNetworkName(name string) string {
+	return fmt.Sprintf("roadie-%v", name)
+}
+
+// firewallRules returns rules in firewallChain for a given bridge.
+func firewallRules(ctx context.Context, bridge string) (rules [][]string, err error) {
+
+	output, err := exec.CommandContext(ctx, "iptables", "-S", firewallChain).Output()
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "-A" || fields[1] != firewallChain {
+			continue
+		}
+		rule := fields[2:]
+		for i := 0; i+1 < len(rule); i++ {
+			if rule[i] == "-i" && rule[i+1] == bridge {
+				rules = append(rules, rule)
+				break
+			}
+		}
+	}
+	return
+
+}
+
+// nameservers returns IPv4 name servers in the first of given resolver
+// configurations which has any; loopback addresses aren't reachable from
+// containers and are ignored. If no name servers are found,
+// defaultNameservers are returned as docker does.
+func nameservers(filenames ...string) (res []string, err error) {
+
+	for _, filename := range filenames {
+		res, err = readNameservers(filename)
+		if err != nil || len(res) != 0 {
+			return
+		}
+	}
+	return defaultNameservers, nil
+
+}
+
+// readNameservers returns IPv4 name servers other than loopback addresses in
+// a given resolver configuration; a missing file has no name servers.
+func readNameservers(filename string) (res []string, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]); ip != nil && ip.To4() != nil && !ip.IsLoopback() {
+			res = append(res, ip.String())
+		}
+	}
+	return
+
+}
+
+// resolveHost returns IP addresses of a given host; host can be an IP address,
+// a CIDR block, or a host name.
+func resolveHost(host string) (res []string, err error) {
+
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+	if _, cidr, err := net.ParseCIDR(host); err == nil {
+		return []string{cidr.String()}, nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return
+	}
+	for _, ip := range ips {
+		// iptables rules are installed only for IPv4.
+		if ip.To4() != nil {
+			res = append(res, ip.String())
+		}
+	}
+	if len(res) == 0 {
+		err = fmt.Errorf("Cannot find any IPv4 addresses of %v", host)
+	}
+	return
+
+}
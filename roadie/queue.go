@@ -0,0 +1,327 @@
+//
+// roadie/queue.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+)
+
+const (
+	// QueueSuffix is the suffix of script files in queues.
+	QueueSuffix = ".yml"
+	// claimedSuffix is appended to names of script files claimed from
+	// directory queues.
+	claimedSuffix = ".claimed"
+)
+
+var (
+	// QueueLeaseDuration defines the duration of leases on blobs claimed from
+	// blob queues; it must be between 15 and 60 seconds. Leases are renewed
+	// while the claimed scripts are processed. Claims on script files in
+	// directory queues expire in the same duration.
+	QueueLeaseDuration = 60 * time.Second
+)
+
+// Queue is a queue of script files processed by workers.
+type Queue interface {
+	// Claim claims the next script file so that other workers won't process
+	// it; it returns nil if the queue is empty.
+	Claim(ctx context.Context) (QueueItem, error)
+}
+
+// QueueItem is a script file claimed from a queue.
+type QueueItem interface {
+	// Name returns the name of the script file without the suffix.
+	Name() string
+	// Open opens the script file.
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// Done removes the script file from the queue.
+	Done(ctx context.Context) error
+	// Release returns the script file to the queue so that it will be
+	// claimed again.
+	Release(ctx context.Context) error
+}
+
+// DirQueue is a queue of script files in a local directory; a script file is
+// claimed by renaming it so that several workers can share the directory.
+//
+// As leases on blobs in BlobQueue, a claim expires unless it is renewed; the
+// modification time of a claimed file is updated while the script is
+// processed, and a claimed file not updated for QueueLeaseDuration, e.g. one
+// left by a crashed worker, is returned to the queue and claimed again.
+type DirQueue struct {
+	Dir string
+}
+
+// NewDirQueue creates a queue of script files in a given directory.
+func NewDirQueue(dir string) *DirQueue {
+	return &DirQueue{
+		Dir: dir,
+	}
+}
+
+// Claim claims the first script file in the directory in the name order;
+// script files of expired claims are claimed again.
+func (q *DirQueue) Claim(ctx context.Context) (item QueueItem, err error) {
+
+	files, err := ioutil.ReadDir(q.Dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		} else if strings.HasSuffix(name, QueueSuffix+claimedSuffix) {
+			name = strings.TrimSuffix(name, claimedSuffix)
+			var expired bool
+			expired, err = q.recover(filepath.Join(q.Dir, name))
+			if os.IsNotExist(err) || err == nil && !expired {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		} else if !strings.HasSuffix(name, QueueSuffix) {
+			continue
+		}
+
+		// Update the modification time before renaming the file so that the
+		// claim won't be regarded as expired.
+		filename := filepath.Join(q.Dir, name)
+		now := time.Now()
+		err = os.Chtimes(filename, now, now)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		// Renaming is atomic; if another worker has claimed the file, it fails.
+		err = os.Rename(filename, filename+claimedSuffix)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		res := &dirQueueItem{
+			filename: filename,
+			interval: QueueLeaseDuration / 2,
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+		go res.renew()
+		return res, nil
+	}
+	return nil, nil
+
+}
+
+// recover returns a given script file to the queue if its claim has expired.
+func (q *DirQueue) recover(filename string) (expired bool, err error) {
+
+	// The modification time is checked again since the claim may have been
+	// renewed after the directory was read.
+	info, err := os.Stat(filename + claimedSuffix)
+	if err != nil {
+		return
+	}
+	if time.Since(info.ModTime()) < QueueLeaseDuration {
+		return false, nil
+	}
+	return true, os.Rename(filename+claimedSuffix, filename)
+
+}
+
+// dirQueueItem is a script file claimed from a directory queue.
+type dirQueueItem struct {
+	filename string
+	interval time.Duration
+	once     sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Name returns the name of the script file without the suffix.
+func (i *dirQueueItem) Name() string {
+	return strings.TrimSuffix(filepath.Base(i.filename), QueueSuffix)
+}
+
+// Open opens the script file.
+func (i *dirQueueItem) Open(ctx context.Context) (io.ReadCloser, error) {
+	return os.Open(i.filename + claimedSuffix)
+}
+
+// Done removes the script file from the queue.
+func (i *dirQueueItem) Done(ctx context.Context) error {
+	i.finish()
+	return os.Remove(i.filename + claimedSuffix)
+}
+
+// Release returns the script file to the queue.
+func (i *dirQueueItem) Release(ctx context.Context) error {
+	i.finish()
+	return os.Rename(i.filename+claimedSuffix, i.filename)
+}
+
+// renew updates the modification time of the claimed file until finish is
+// called; errors are ignored as renewing leases of blob queues.
+func (i *dirQueueItem) renew() {
+
+	defer close(i.done)
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			os.Chtimes(i.filename+claimedSuffix, now, now)
+		case <-i.stop:
+			return
+		}
+	}
+
+}
+
+// finish stops renewing the claim.
+func (i *dirQueueItem) finish() {
+	i.once.Do(func() {
+		close(i.stop)
+		<-i.done
+	})
+}
+
+// BlobQueue is a queue of script files stored in the startup container of an
+// Azure storage; a script file is claimed by acquiring a lease on its blob.
+type BlobQueue struct {
+	store *AzureStorage
+	// Prefix is the prefix of blobs in the queue.
+	Prefix string
+}
+
+// NewBlobQueue creates a queue of blobs having a given prefix in the startup
+// container of a given storage.
+func NewBlobQueue(store *AzureStorage, prefix string) *BlobQueue {
+	return &BlobQueue{
+		store:  store,
+		Prefix: prefix,
+	}
+}
+
+// Claim claims the first blob which other workers haven't leased.
+func (q *BlobQueue) Claim(ctx context.Context) (item QueueItem, err error) {
+
+	var res *blobQueueItem
+	err = q.store.List(ctx, StartupContainer, q.Prefix, func(name string) error {
+
+		if !strings.HasSuffix(name, QueueSuffix) {
+			return nil
+		}
+		// Blobs leased by other workers cannot be leased.
+		lease, err := q.store.blob(StartupContainer, name).AcquireLease(int(QueueLeaseDuration/time.Second), "", nil)
+		if err != nil {
+			return nil
+		}
+		res = &blobQueueItem{
+			store: q.store,
+			name:  name,
+			lease: lease,
+			stop:  make(chan struct{}),
+			done:  make(chan struct{}),
+		}
+		go res.renew()
+		return io.EOF
+
+	})
+	if res == nil {
+		return nil, err
+	}
+	return res, nil
+
+}
+
+// blobQueueItem is a blob claimed from a blob queue.
+type blobQueueItem struct {
+	store *AzureStorage
+	name  string
+	lease string
+	once  sync.Once
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Name returns the name of the script file without the suffix.
+func (i *blobQueueItem) Name() string {
+	return strings.TrimSuffix(path.Base(i.name), QueueSuffix)
+}
+
+// Open opens the script file.
+func (i *blobQueueItem) Open(ctx context.Context) (io.ReadCloser, error) {
+	return i.store.Open(ctx, StartupContainer, i.name)
+}
+
+// Done removes the script file from the queue.
+func (i *blobQueueItem) Done(ctx context.Context) error {
+	i.finish()
+	return i.store.blob(StartupContainer, i.name).Delete(&storage.DeleteBlobOptions{
+		LeaseID: i.lease,
+	})
+}
+
+// Release returns the script file to the queue.
+func (i *blobQueueItem) Release(ctx context.Context) error {
+	i.finish()
+	return i.store.blob(StartupContainer, i.name).ReleaseLease(i.lease, nil)
+}
+
+// renew renews the lease until finish is called; errors are ignored since
+// they can be temporal.
+func (i *blobQueueItem) renew() {
+
+	defer close(i.done)
+	ticker := time.NewTicker(QueueLeaseDuration / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			i.store.blob(StartupContainer, i.name).RenewLease(i.lease, nil)
+		case <-i.stop:
+			return
+		}
+	}
+
+}
+
+// finish stops renewing the lease.
+func (i *blobQueueItem) finish() {
+	i.once.Do(func() {
+		close(i.stop)
+		<-i.done
+	})
+}
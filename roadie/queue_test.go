@@ -0,0 +1,189 @@
+//
+// roadie/queue_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDirQueue(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"task-b.yml", "task-a.yml", "note.txt"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("cannot create a file: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	queue := NewDirQueue(dir)
+	item, err := queue.Claim(ctx)
+	if err != nil {
+		t.Fatalf("Claim returns an error: %v", err)
+	} else if item == nil || item.Name() != "task-a" {
+		t.Fatalf("claimed item is %v, want task-a", item)
+	}
+	r, err := item.Open(ctx)
+	if err != nil {
+		t.Fatalf("Open returns an error: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "task-a.yml" {
+		t.Errorf("claimed item has %q (%v), want %q", data, err, "task-a.yml")
+	}
+
+	// A claimed item cannot be claimed until it is released.
+	other, err := queue.Claim(ctx)
+	if err != nil || other == nil || other.Name() != "task-b" {
+		t.Fatalf("claimed item is %v (%v), want task-b", other, err)
+	}
+	if err = item.Release(ctx); err != nil {
+		t.Fatalf("Release returns an error: %v", err)
+	}
+	item, err = queue.Claim(ctx)
+	if err != nil || item == nil || item.Name() != "task-a" {
+		t.Fatalf("claimed item is %v (%v), want task-a", item, err)
+	}
+
+	for _, i := range []QueueItem{item, other} {
+		if err = i.Done(ctx); err != nil {
+			t.Fatalf("Done returns an error: %v", err)
+		}
+	}
+	item, err = queue.Claim(ctx)
+	if err != nil || item != nil {
+		t.Errorf("Claim returns %v (%v) for an empty queue", item, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "note.txt")); err != nil {
+		t.Errorf("files other than scripts are modified: %v", err)
+	}
+
+}
+
+func TestDirQueueConcurrentClaims(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	n := 20
+	for i := 0; i != n; i++ {
+		if err = ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("task-%02d.yml", i)), nil, 0644); err != nil {
+			t.Fatalf("cannot create a file: %v", err)
+		}
+	}
+
+	var mutex sync.Mutex
+	claimed := make(map[string]int)
+	var wg sync.WaitGroup
+	for w := 0; w != 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queue := NewDirQueue(dir)
+			for {
+				item, err := queue.Claim(context.Background())
+				if err != nil || item == nil {
+					return
+				}
+				mutex.Lock()
+				claimed[item.Name()]++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != n {
+		t.Errorf("%v items are claimed, want %v", len(claimed), n)
+	}
+	for name, c := range claimed {
+		if c != 1 {
+			t.Errorf("%v is claimed %v times", name, c)
+		}
+	}
+
+}
+
+func TestDirQueueExpiredClaims(t *testing.T) {
+
+	defer setDuration(&QueueLeaseDuration, 200*time.Millisecond)()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"task-a.yml.claimed", "task-b.yml"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("cannot create a file: %v", err)
+		}
+	}
+	// task-a was claimed by a worker which stopped a while ago.
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(filepath.Join(dir, "task-a.yml.claimed"), old, old); err != nil {
+		t.Fatalf("cannot change the modification time: %v", err)
+	}
+
+	ctx := context.Background()
+	queue := NewDirQueue(dir)
+	item, err := queue.Claim(ctx)
+	if err != nil || item == nil || item.Name() != "task-a" {
+		t.Fatalf("claimed item is %v (%v), want task-a", item, err)
+	}
+	other, err := queue.Claim(ctx)
+	if err != nil || other == nil || other.Name() != "task-b" {
+		t.Fatalf("claimed item is %v (%v), want task-b", other, err)
+	}
+
+	// Claims being processed are renewed and don't expire.
+	time.Sleep(3 * QueueLeaseDuration)
+	if res, err := queue.Claim(ctx); err != nil || res != nil {
+		t.Fatalf("Claim returns %v (%v) while all items are processed", res, err)
+	}
+
+	// A claim which is no longer renewed expires.
+	other.(*dirQueueItem).finish()
+	time.Sleep(2 * QueueLeaseDuration)
+	res, err := queue.Claim(ctx)
+	if err != nil || res == nil || res.Name() != "task-b" {
+		t.Fatalf("claimed item is %v (%v), want task-b", res, err)
+	}
+	for _, i := range []QueueItem{item, res} {
+		if err = i.Done(ctx); err != nil {
+			t.Fatalf("Done returns an error: %v", err)
+		}
+	}
+
+}
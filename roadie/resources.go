@@ -0,0 +1,108 @@
+//
+// roadie/resources.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/mem"
+)
+
+const (
+	// DefaultMemoryRatio defines the ratio of the total memory given to
+	// sandbox containers.
+	DefaultMemoryRatio = 0.95
+	// maxSandboxName defines the maximum length of names made by SandboxName.
+	maxSandboxName = 100
+)
+
+// ResourceShare is a share of the resources of this machine given to a
+// sandbox container; zero values mean no limits.
+type ResourceShare struct {
+	// CPUSet lists CPUs, e.g. 0-3.
+	CPUSet string
+	// Memory is the memory limit in bytes.
+	Memory int64
+}
+
+// PartitionResources splits CPUs and DefaultMemoryRatio of the total memory
+// of this machine into n shares so that n sandbox containers run
+// concurrently; if n is less than two, a share without limits is returned.
+func PartitionResources(n int) (res []ResourceShare, err error) {
+
+	if n < 2 {
+		return []ResourceShare{{}}, nil
+	}
+	v, err := mem.VirtualMemory()
+	if err != nil {
+		return
+	}
+	return splitResources(runtime.NumCPU(), int64(float64(v.Total)*DefaultMemoryRatio), n), nil
+
+}
+
+// splitResources splits given numbers of CPUs and bytes of memory into n
+// shares; if there are fewer CPUs than shares, CPUs are shared.
+func splitResources(cpus int, memory int64, n int) (res []ResourceShare) {
+
+	for i := 0; i != n; i++ {
+		var cpuset string
+		if cpus < n {
+			cpuset = fmt.Sprint(i % cpus)
+		} else if begin, end := i*cpus/n, (i+1)*cpus/n-1; begin == end {
+			cpuset = fmt.Sprint(begin)
+		} else {
+			cpuset = fmt.Sprintf("%v-%v", begin, end)
+		}
+		res = append(res, ResourceShare{
+			CPUSet: cpuset,
+			Memory: memory / int64(n),
+		})
+	}
+	return
+
+}
+
+// SandboxName converts a given task name to a string which can be used as an
+// image tag and a container name; characters other than alphanumerics, _, .,
+// and - are replaced with -.
+func SandboxName(name string) string {
+
+	res := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, name)
+	res = strings.TrimLeft(res, ".-")
+	if len(res) > maxSandboxName {
+		res = res[:maxSandboxName]
+	}
+	if res == "" {
+		res = "task"
+	}
+	return res
+
+}
@@ -0,0 +1,88 @@
+//
+// roadie/resources_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitResources(t *testing.T) {
+
+	cases := []struct {
+		cpus   int
+		n      int
+		expect []string
+	}{
+		{8, 2, []string{"0-3", "4-7"}},
+		{8, 3, []string{"0-1", "2-4", "5-7"}},
+		{4, 4, []string{"0", "1", "2", "3"}},
+		{2, 3, []string{"0", "1", "0"}},
+	}
+	for _, c := range cases {
+		res := splitResources(c.cpus, 1200, c.n)
+		var cpusets []string
+		for _, v := range res {
+			cpusets = append(cpusets, v.CPUSet)
+			if v.Memory != int64(1200/c.n) {
+				t.Errorf("memory is %v, want %v", v.Memory, 1200/c.n)
+			}
+		}
+		if !reflect.DeepEqual(cpusets, c.expect) {
+			t.Errorf("splitResources(%v, %v) gives %v, want %v", c.cpus, c.n, cpusets, c.expect)
+		}
+	}
+
+}
+
+func TestPartitionResources(t *testing.T) {
+
+	res, err := PartitionResources(1)
+	if err != nil {
+		t.Fatalf("PartitionResources returns an error: %v", err)
+	}
+	if !reflect.DeepEqual(res, []ResourceShare{{}}) {
+		t.Errorf("single share has limits: %v", res)
+	}
+
+}
+
+func TestSandboxName(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		expect string
+	}{
+		{"task-20170601", "task-20170601"},
+		{"exp/lr=0.1 batch", "exp-lr-0.1-batch"},
+		{"-.task", "task"},
+		{"", "task"},
+		{strings.Repeat("a", 200), strings.Repeat("a", maxSandboxName)},
+	}
+	for _, c := range cases {
+		if res := SandboxName(c.name); res != c.expect {
+			t.Errorf("SandboxName(%q) = %q, want %q", c.name, res, c.expect)
+		}
+	}
+
+}
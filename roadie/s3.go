@@ -0,0 +1,346 @@
+//
+// roadie/s3.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultS3Region is the region used if not given.
+	DefaultS3Region = "us-east-1"
+	// emptyPayloadHash is the SHA256 hash of an empty payload.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Storage is a storage using an S3 compatible service; files are stored in
+// a bucket with keys <prefix>/<container>/<name>, and requests are signed
+// with AWS Signature Version 4.
+type S3Storage struct {
+	// Endpoint is the URL of the service, e.g. https://s3.amazonaws.com;
+	// buckets are accessed with path-style URLs.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// Client sends requests; http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// s3ListResult defines the response of ListObjectsV2.
+type s3ListResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// Upload stores an object. Since S3 requires the size and the hash of a
+// payload, the given data are spooled to a temporary file.
+func (s *S3Storage) Upload(ctx context.Context, container, name string, in io.Reader, contentType string) (err error) {
+
+	spool, err := ioutil.TempFile("", "roadie-s3-")
+	if err != nil {
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), in)
+	if err != nil {
+		return
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, s.key(container, name), nil, spool)
+	if err != nil {
+		return
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := s.do(req, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return
+	}
+	return res.Body.Close()
+
+}
+
+// Open opens an object.
+func (s *S3Storage) Open(ctx context.Context, container, name string) (io.ReadCloser, error) {
+
+	req, err := s.newRequest(ctx, http.MethodGet, s.key(container, name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+
+}
+
+// Delete deletes an object.
+func (s *S3Storage) Delete(ctx context.Context, container, name string) error {
+
+	req, err := s.newRequest(ctx, http.MethodDelete, s.key(container, name), nil, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+
+}
+
+// List calls a given handler with names of objects having a given prefix.
+func (s *S3Storage) List(ctx context.Context, container, prefix string, handler func(name string) error) (err error) {
+
+	root := s.key(container, "")
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {root + prefix},
+	}
+	for {
+		var req *http.Request
+		req, err = s.newRequest(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return
+		}
+		var res *http.Response
+		res, err = s.do(req, emptyPayloadHash)
+		if err != nil {
+			return
+		}
+		var list s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&list)
+		res.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, v := range list.Contents {
+			if err = handler(strings.TrimPrefix(v.Key, root)); err != nil {
+				return
+			}
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return
+		}
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+
+}
+
+// key returns the object key of a given file.
+func (s *S3Storage) key(container, name string) string {
+	return strings.TrimPrefix(path.Join(s.Prefix, container)+"/"+name, "/")
+}
+
+// newRequest creates a request to a given object in the bucket; if the key is
+// empty, the request is sent to the bucket.
+func (s *S3Storage) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (req *http.Request, err error) {
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3.amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return
+	}
+	// Keys are appended as they are since S3 doesn't clean object keys; e.g.
+	// a//b/ and a/b are different objects.
+	u.Path = path.Join("/", u.Path, s.Bucket) + "/" + key
+	// Use the same encoding as the signature.
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+
+	req, err = http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return
+	}
+	return req.WithContext(ctx), nil
+
+}
+
+// do signs and sends a request; responses with error status are returned as
+// errors.
+func (s *S3Storage) do(req *http.Request, payloadHash string) (res *http.Response, err error) {
+
+	region := s.Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+	// S3 requires the hash of the payload in a header.
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, payloadHash, s.AccessKey, s.SecretKey, region, "s3", time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err = client.Do(req)
+	if err != nil {
+		return
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("%v %v returns %v: %s", req.Method, req.URL.Path, res.Status, msg)
+	}
+	return
+
+}
+
+// signV4 signs a given request with AWS Signature Version 4; the host header,
+// the range header, the content type, and headers starting with x-amz- are
+// signed.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, now time.Time) {
+
+	now = now.UTC()
+	stamp := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", stamp)
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "range" || k == "content-type" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		stamp,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		accessKey, scope, signedHeaders, signature))
+
+}
+
+// hmacSHA256 computes HMAC-SHA256 of given data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes given query parameters sorted by their names.
+func canonicalQuery(query url.Values) string {
+
+	var names []string
+	for k := range query {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var params []string
+	for _, k := range names {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+
+}
+
+// uriEncode encodes a given string as AWS requires; slashes are encoded only
+// if encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+
+	var res bytes.Buffer
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			res.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			res.WriteByte(c)
+		default:
+			fmt.Fprintf(&res, "%%%02X", c)
+		}
+	}
+	return res.String()
+
+}
@@ -0,0 +1,188 @@
+//
+// roadie/sandbox_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/jkawamoto/roadie-azure/roadie/dockertest"
+)
+
+// TestStartStaleSandbox checks Start removes a container and a network left by
+// an interrupted execution before creating a new sandbox of the same name.
+func TestStartStaleSandbox(t *testing.T) {
+
+	for _, running := range []bool{true, false} {
+		t.Run(fmt.Sprintf("running=%v", running), func(t *testing.T) {
+
+			fake := dockertest.NewDocker("roadie/test")
+			fake.Behavior = func(c *dockertest.Container) int {
+				fmt.Fprintln(c.Stdout, "hello")
+				return 0
+			}
+			stale := fake.Seed("roadie-test", running)
+			_, err := fake.NetworkCreate(context.Background(), restrictedNetworkName("roadie-test"), types.NetworkCreate{
+				CheckDuplicate: true,
+			})
+			if err != nil {
+				t.Fatalf("NetworkCreate returns an error: %v", err)
+			}
+			// Another network whose name contains the name must be kept.
+			_, err = fake.NetworkCreate(context.Background(), restrictedNetworkName("roadie-test-2"), types.NetworkCreate{})
+			if err != nil {
+				t.Fatalf("NetworkCreate returns an error: %v", err)
+			}
+
+			var output bytes.Buffer
+			d := NewDockerClientFromAPI(fake, log.New(&output, "", 0))
+			err = d.Start(context.Background(), &DockerStartOpt{
+				ImageName:     "roadie/test",
+				ContainerName: "roadie-test",
+				Network:       NetworkNone,
+				GracePeriod:   100 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Start returns an error: %v", err)
+			}
+
+			if stale.Running() {
+				t.Error("the stale container is still running")
+			}
+			if c := fake.Container(stale.ID); c != nil {
+				t.Error("the stale container isn't removed")
+			}
+			if n := fake.Networks(); len(n) != 1 || n[0] != restrictedNetworkName("roadie-test-2") {
+				t.Errorf("networks are %v, want %v", n, []string{restrictedNetworkName("roadie-test-2")})
+			}
+			if c := fake.Containers(); len(c) != 2 || c[1].Name != "roadie-test" {
+				t.Errorf("containers are %v, want a new container named roadie-test", c)
+			}
+			if !strings.Contains(output.String(), "hello") {
+				t.Errorf("outputs of the new container are not forwarded: %q", output.String())
+			}
+
+		})
+	}
+
+}
+
+// TestStartDiagnosticsSecrets checks the inspection of a sandbox container in
+// a diagnostics bundle doesn't have secret values given as environment
+// variables.
+func TestStartDiagnosticsSecrets(t *testing.T) {
+
+	fake := dockertest.NewDocker("roadie/test")
+	diag := NewDiagnostics()
+	d := NewDockerClientFromAPI(fake, log.New(ioutil.Discard, "", 0))
+	err := d.Start(context.Background(), &DockerStartOpt{
+		ImageName:   "roadie/test",
+		Env:         []string{"TOKEN=secret-value", "NAME=test"},
+		Network:     NetworkNone,
+		Diagnostics: diag,
+		Secrets:     []string{"secret-value"},
+	})
+	if err != nil {
+		t.Fatalf("Start returns an error: %v", err)
+	}
+
+	// The bundle is a gzipped tar archive, which stores files as they are.
+	var buf bytes.Buffer
+	if _, err = diag.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo returns an error: %v", err)
+	}
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("cannot read the bundle: %v", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("cannot read the bundle: %v", err)
+	}
+	if !bytes.Contains(data, []byte("container.json")) {
+		t.Fatal("the bundle doesn't have container.json")
+	}
+	if bytes.Contains(data, []byte("secret-value")) {
+		t.Error("container.json has a secret value")
+	}
+	if !bytes.Contains(data, []byte("TOKEN="+SecretMask)) || !bytes.Contains(data, []byte("NAME=test")) {
+		t.Errorf("environment variables aren't recorded: %s", data)
+	}
+	if env := fake.Containers()[0].Env("TOKEN"); env != "secret-value" {
+		t.Errorf("environment variable of the container is %q, want %q", env, "secret-value")
+	}
+
+}
+
+// TestStartStopBy checks a canceled sandbox container ignoring SIGTERM is
+// killed by the time StopBy returns instead of after the grace period.
+func TestStartStopBy(t *testing.T) {
+
+	for _, rest := range []time.Duration{-time.Second, 100 * time.Millisecond} {
+		t.Run(fmt.Sprintf("rest=%v", rest), func(t *testing.T) {
+
+			fake := dockertest.NewDocker("roadie/test")
+			started := make(chan struct{})
+			fake.Behavior = func(c *dockertest.Container) int {
+				close(started)
+				<-c.Done()
+				return 0
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-started
+				cancel()
+			}()
+
+			d := NewDockerClientFromAPI(fake, log.New(ioutil.Discard, "", 0))
+			by := time.Now().Add(rest)
+			begin := time.Now()
+			err := d.Start(ctx, &DockerStartOpt{
+				ImageName:   "roadie/test",
+				Network:     NetworkNone,
+				GracePeriod: time.Hour,
+				StopBy: func() time.Time {
+					return by
+				},
+			})
+			if err != context.Canceled {
+				t.Errorf("Start returns %v, want %v", err, context.Canceled)
+			}
+			if elapsed := time.Since(begin); elapsed > 10*time.Second {
+				t.Errorf("stopping the container takes %v", elapsed)
+			}
+			if c := fake.Containers()[0]; c.ExitCode() != 137 {
+				t.Errorf("exit code is %v, want the container killed", c.ExitCode())
+			}
+
+		})
+	}
+
+}
@@ -26,20 +26,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/storage"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/jkawamoto/roadie-azure/assets"
-	"github.com/jkawamoto/roadie/cloud/azure"
 	"github.com/jkawamoto/roadie/script"
 	"github.com/ulikunitz/xz"
+	yaml "gopkg.in/yaml.v2"
 )
 
 const (
@@ -52,8 +53,52 @@ const (
 
 // Script defines a structure to run commands.
 type Script struct {
-	*script.Script
-	Logger *log.Logger
+	*script.Script `yaml:"-"`
+	// Env defines environment variables given to the sandbox container.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Secrets maps names of environment variables to names of secrets;
+	// the values of those secrets are given to the sandbox container.
+	Secrets map[string]string `yaml:"secrets,omitempty"`
+	// InheritEnv is true if the sandbox container inherits environment
+	// variables of the host.
+	InheritEnv bool `yaml:"inherit_env,omitempty"`
+	// Timeout defines the time limit of the whole task.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// StepTimeout defines the time limit of each run step.
+	StepTimeout time.Duration `yaml:"step_timeout,omitempty"`
+	// GracePeriod defines how long the sandbox container can take to stop
+	// after receiving SIGTERM; it will be killed afterwards.
+	GracePeriod time.Duration `yaml:"grace_period,omitempty"`
+	// Security defines options to harden the sandbox container.
+	Security Security `yaml:"security,omitempty"`
+	// ScratchSize limits the size of the scratch directory, e.g. 512m, in which
+	// case a tmpfs is used as the scratch directory.
+	ScratchSize string `yaml:"scratch_size,omitempty"`
+	// Sync defines options to upload result files while running.
+	Sync Sync `yaml:"sync,omitempty"`
+	// Matrix defines parameters of which every combination runs separately.
+	Matrix Matrix `yaml:"matrix,omitempty"`
+	// Combination is the combination of parameters given to this script if
+	// it is expanded from a matrix.
+	Combination *Combination `yaml:"-"`
+	// ResultDir is the directory where the sandbox container writes stdout
+	// files.
+	ResultDir string `yaml:"-"`
+	// Dir is the working directory where source code and data files are
+	// stored and upload patterns are matched; if empty, the current directory
+	// is used.
+	Dir    string      `yaml:"-"`
+	Logger *log.Logger `yaml:"-"`
+	// Recorder records outputs of commands preparing source code with their
+	// streams if not nil.
+	Recorder OutputRecorder `yaml:"-"`
+	// Masks are secret values replaced with SecretMask in stdout files when
+	// they are uploaded.
+	Masks []string `yaml:"-"`
+
+	// existing maps files matching upload patterns to their states recorded
+	// by SkipExisting; they are uploaded only if modified afterwards.
+	existing map[string]os.FileInfo
 }
 
 // NewScript creates a new script from a given named file with a logger.
@@ -65,11 +110,44 @@ func NewScript(filename string, logger *log.Logger) (res *Script, err error) {
 		return
 	}
 
+	// Read options which the original script doesn't support.
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(data, res)
+	if err != nil {
+		return
+	}
+
 	res.Logger = logger
 	return
 
 }
 
+// Environment returns environment variables given to the sandbox container;
+// secret references are resolved with a given set of secrets.
+func (s *Script) Environment(secrets Secrets) (res []string, err error) {
+
+	if s.InheritEnv {
+		res = append(res, os.Environ()...)
+	}
+	for k, v := range s.Env {
+		res = append(res, fmt.Sprintf("%v=%v", k, v))
+	}
+
+	var value string
+	for k, name := range s.Secrets {
+		value, err = secrets.Lookup(name)
+		if err != nil {
+			return
+		}
+		res = append(res, fmt.Sprintf("%v=%v", k, value))
+	}
+	return
+
+}
+
 // PrepareSourceCode prepares source code defined in a given task.
 func (s *Script) PrepareSourceCode(ctx context.Context) (err error) {
 
@@ -88,7 +166,9 @@ func (s *Script) PrepareSourceCode(ctx context.Context) (err error) {
 			{"git", []string{"pull", "origin", "master"}},
 		}
 		for _, c := range cmds {
-			err = ExecCommand(exec.CommandContext(ctx, c.name, c.args...), s.Logger)
+			cmd := exec.CommandContext(ctx, c.name, c.args...)
+			cmd.Dir = s.Dir
+			err = ExecCommand(cmd, s.Logger, s.Recorder)
 			if err != nil {
 				return
 			}
@@ -104,6 +184,7 @@ func (s *Script) PrepareSourceCode(ctx context.Context) (err error) {
 			return
 		}
 		defer obj.Body.Close()
+		obj.Dest = s.path(obj.Dest)
 
 		switch {
 		case strings.HasSuffix(obj.Name, ".gz") || strings.HasSuffix(obj.Name, ".xz") || strings.HasSuffix(obj.Name, ".zip"):
@@ -140,13 +221,13 @@ func (s *Script) PrepareSourceCode(ctx context.Context) (err error) {
 
 			return NewExpander(s.Logger).Expand(ctx, &Object{
 				Name: filename,
-				Dest: ".",
+				Dest: s.path("."),
 				Body: fp,
 			})
 
 		default:
 			// Plain file.
-			return os.Symlink(filename, filepath.Base(filename))
+			return os.Symlink(filename, s.path(filepath.Base(filename)))
 
 		}
 
@@ -175,6 +256,7 @@ func (s *Script) DownloadDataFiles(ctx context.Context) (err error) {
 			if err != nil {
 				return
 			}
+			obj.Dest = s.path(obj.Dest)
 
 			switch {
 			case strings.HasSuffix(obj.Name, ".gz") || strings.HasSuffix(obj.Name, ".xz") || strings.HasSuffix(obj.Name, ".zip"):
@@ -208,107 +290,187 @@ func (s *Script) DownloadDataFiles(ctx context.Context) (err error) {
 }
 
 // UploadResults uploads result files.
-func (s *Script) UploadResults(ctx context.Context, store *azure.StorageService) (err error) {
-
-	dir := strings.TrimPrefix(s.Name, "task-")
+func (s *Script) UploadResults(ctx context.Context, store Storage) (err error) {
 
 	s.Logger.Println("Uploading result files")
 	eg, ctx := errgroup.WithContext(ctx)
-	for i := range s.Run {
+	for _, f := range s.resultFiles() {
 
-		idx := i
+		file := f
 		eg.Go(func() (err error) {
+			s.Logger.Println("Uploading", file.Path)
+			name, err := s.uploadResult(ctx, store, file)
+			if err == nil && name != "" {
+				s.Logger.Printf("%v is uploaded", file.Path)
+			}
+			return
+		})
 
-			var reader io.Reader
-			s.Logger.Printf("Uploading stdout%v.txt\n", idx)
+	}
 
-			filename := fmt.Sprintf("/tmp/stdout%v.txt", idx)
-			info, err := os.Stat(filename)
-			if err != nil {
-				s.Logger.Printf("Cannot find stdout%v.txt\n", idx)
-				return
-			}
+	err = eg.Wait()
+	if err != nil {
+		s.Logger.Printf("Failed uploading result files: %v", err)
+		return
+	}
 
-			fp, err := os.Open(filename)
-			if err != nil {
-				s.Logger.Printf("Cannot find stdout%v.txt\n", idx)
-				return
-			}
-			defer fp.Close()
-			outfile := fmt.Sprintf("%s/stdout%v.txt", dir, idx)
-			reader = fp
-			contentType := "text/plain"
+	s.Logger.Println("Finished uploading result files")
+	return
 
-			if info.Size() > CompressThreshold {
+}
 
-				var xzReader io.Reader
-				xzReader, err = xz.NewReader(reader)
-				if err != nil {
-					s.Logger.Println("Cannot compress an uploading file:", err)
-				} else {
-					reader = xzReader
-					outfile = fmt.Sprintf("%v.xz", outfile)
-					contentType = "application/x-xz"
-				}
+// resultFile defines a local result file and its name in the result
+// container.
+type resultFile struct {
+	Path string
+	Name string
+	// Stdout is true if the file is a stdout file of a run step; large stdout
+	// files are compressed.
+	Stdout bool
+}
 
-			}
-			err = store.UploadWithMetadata(ctx, azure.ResultContainer, outfile, reader, &storage.BlobProperties{
-				ContentType: contentType,
-			}, nil)
-			if err != nil {
-				s.Logger.Printf("Fiald to upload stdout%v.txt", idx)
-				return
-			}
-			s.Logger.Printf("stdout%v.txt is uploaded", idx)
-			return
-		})
+// resultFiles returns stdout files of run steps and files matching upload
+// patterns.
+func (s *Script) resultFiles() (res []resultFile) {
 
+	dir := s.resultPrefix()
+	for i := range s.Run {
+		res = append(res, resultFile{
+			Path:   filepath.Join(s.ResultDir, fmt.Sprintf("stdout%v.txt", i)),
+			Name:   fmt.Sprintf("%s/stdout%v.txt", dir, i),
+			Stdout: true,
+		})
 	}
 
-	var matches []string
 	for _, v := range s.Upload {
-		matches, err = filepath.Glob(v)
+		matches, err := filepath.Glob(s.path(v))
 		if err != nil {
 			s.Logger.Printf("Not match any files to %v: %v", v, err)
 			continue
 		}
-
 		for _, file := range matches {
+			if s.unchanged(file) {
+				continue
+			}
+			res = append(res, resultFile{
+				Path: file,
+				Name: fmt.Sprintf("%s/%v", dir, filepath.Base(file)),
+			})
+		}
+	}
+	return
 
-			name := file
-			eg.Go(func() (err error) {
-				s.Logger.Println("Uploading", name)
-				fp, err := os.Open(name)
-				if err != nil {
-					s.Logger.Println("Cannot find", name, ":", err.Error())
-					return
-				}
-				defer fp.Close()
+}
 
-				err = store.UploadWithMetadata(ctx, azure.ResultContainer, fmt.Sprintf("%s/%v", dir, filepath.Base(name)), fp, nil, nil)
-				if err != nil {
-					s.Logger.Println("Cannot upload", name)
-					return
-				}
-				s.Logger.Printf("%v is uploaded", name)
-				return
-			})
+// SkipExisting records files matching upload patterns which exist now; they
+// aren't uploaded as result files unless they are modified afterwards. Since
+// combinations of a matrix share the working directory, results of a
+// combination would be uploaded as results of the following ones otherwise.
+func (s *Script) SkipExisting() {
 
+	s.existing = make(map[string]os.FileInfo)
+	for _, v := range s.Upload {
+		matches, err := filepath.Glob(s.path(v))
+		if err != nil {
+			continue
+		}
+		for _, file := range matches {
+			if info, err := os.Stat(file); err == nil {
+				s.existing[file] = info
+			}
 		}
+	}
+
+}
 
+// unchanged returns true if a given file was recorded by SkipExisting and
+// hasn't been modified since then.
+func (s *Script) unchanged(file string) bool {
+
+	prev, exist := s.existing[file]
+	if !exist {
+		return false
 	}
+	info, err := os.Stat(file)
+	return err == nil && info.Size() == prev.Size() && info.ModTime().Equal(prev.ModTime())
 
-	err = eg.Wait()
+}
+
+// OutputDirs returns directories in the working directory where upload
+// patterns find result files; the sandbox container writes to them.
+func (s *Script) OutputDirs() (res []string) {
+
+	seen := make(map[string]bool)
+	for _, v := range s.Upload {
+		matches, err := filepath.Glob(filepath.Dir(s.path(v)))
+		if err != nil {
+			continue
+		}
+		for _, dir := range matches {
+			if !seen[dir] {
+				seen[dir] = true
+				res = append(res, dir)
+			}
+		}
+	}
+	return
+
+}
+
+// uploadResult uploads a given result file and returns the name of the
+// uploaded file, which has a suffix .xz if the file is compressed. A missing
+// file isn't an error since run steps may not create stdout files.
+func (s *Script) uploadResult(ctx context.Context, store Storage, file resultFile) (name string, err error) {
+
+	fp, err := os.Open(file.Path)
+	if err != nil {
+		s.Logger.Println("Cannot find", file.Path, ":", err)
+		return "", nil
+	}
+	defer fp.Close()
+	info, err := fp.Stat()
 	if err != nil {
-		s.Logger.Printf("Failed uploading result files: %v", err)
 		return
 	}
 
-	s.Logger.Println("Finished uploading result files")
+	var reader io.Reader = fp
+	name = file.Name
+	contentType := ""
+	if file.Stdout {
+		contentType = "text/plain"
+		masked := NewMaskedReader(reader, s.Masks)
+		defer masked.Close()
+		reader = masked
+		if info.Size() > CompressThreshold {
+			var xzReader io.Reader
+			xzReader, err = xz.NewReader(reader)
+			if err != nil {
+				s.Logger.Println("Cannot compress an uploading file:", err)
+			} else {
+				reader = xzReader
+				name = fmt.Sprintf("%v.xz", name)
+				contentType = "application/x-xz"
+			}
+		}
+	}
+
+	err = store.Upload(ctx, ResultContainer, name, reader, contentType)
+	if err != nil {
+		s.Logger.Println("Cannot upload", file.Path, ":", err)
+	}
 	return
 
 }
 
+// path returns a given path in the working directory; absolute paths are
+// returned as they are.
+func (s *Script) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(s.Dir, name)
+}
+
 // Dockerfile generates a dockerfile for this script.
 func (s *Script) Dockerfile() (res []byte, err error) {
 
@@ -347,7 +509,7 @@ func (s *Script) Entrypoint() (res []byte, err error) {
 	}
 
 	buf := bytes.NewBuffer(nil)
-	err = temp.Execute(buf, s.Script)
+	err = temp.Execute(buf, s)
 	res = buf.Bytes()
 	return
 
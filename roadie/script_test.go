@@ -31,10 +31,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
-	"github.com/jkawamoto/roadie/cloud/azure"
-	"github.com/jkawamoto/roadie/cloud/azure/mock"
 	"github.com/jkawamoto/roadie/script"
 )
 
@@ -266,6 +266,38 @@ func TestPrepareSourceCode(t *testing.T) {
 		}
 	})
 
+	t.Run("archived file source in a working directory", func(t *testing.T) {
+		output.Reset()
+
+		temp, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("cannot create a temporary directory: %v", err)
+		}
+		defer os.RemoveAll(temp)
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("cannot get the working directory: %v", err)
+		}
+
+		s.Dir = temp
+		defer func() {
+			s.Dir = ""
+		}()
+		s.Source = "file://" + filepath.Join(wd, "archive_test.zip")
+		err = s.PrepareSourceCode(ctx)
+		if err != nil {
+			t.Fatalf("PrepareSourceCode returns an error: %v", err)
+		}
+		for _, target := range []string{"abc.txt", "folder/def.txt"} {
+			if _, err = os.Stat(filepath.Join(temp, target)); err != nil {
+				t.Errorf("working directory doesn't have file %q", target)
+			}
+		}
+		if _, err = os.Stat("abc.txt"); err == nil {
+			t.Error("source files are expanded in the current directory")
+		}
+	})
+
 }
 
 func TestDownloadDataFiles(t *testing.T) {
@@ -326,6 +358,12 @@ func TestUploadResults(t *testing.T) {
 	}
 	defer os.RemoveAll(tmp)
 
+	resultDir := filepath.Join(tmp, "results")
+	err = os.Mkdir(resultDir, 0755)
+	if err != nil {
+		t.Fatalf("cannot create a directory: %v", err)
+	}
+
 	script := Script{
 		Script: &script.Script{
 			Name: "task-abc",
@@ -337,20 +375,18 @@ func TestUploadResults(t *testing.T) {
 				filepath.Join(tmp, "*.txt"),
 			},
 		},
-		Logger: log.New(ioutil.Discard, "", log.LstdFlags),
+		ResultDir: resultDir,
+		Logger:    log.New(ioutil.Discard, "", log.LstdFlags),
+		Masks:     []string{"secret-value"},
 	}
 	var expected []string
 
-	// Create dummy output files.
+	// Create dummy output files; secret values in them will be masked.
 	for i := range script.Run {
-		filename := filepath.Join("/tmp", fmt.Sprintf("stdout%v.txt", i))
-		_, err = os.Stat(filename)
+		filename := filepath.Join(resultDir, fmt.Sprintf("stdout%v.txt", i))
+		err = ioutil.WriteFile(filename, []byte(filename+"\ntoken is secret-value\n"), 0644)
 		if err != nil {
-			err = ioutil.WriteFile(filename, []byte(filename), 0644)
-			if err != nil {
-				t.Fatalf("cannot create dummy output file %v: %v", filename, err)
-			}
-			defer os.Remove(filename)
+			t.Fatalf("cannot create dummy output file %v: %v", filename, err)
 		}
 		expected = append(expected, filepath.Base(filename))
 	}
@@ -365,20 +401,10 @@ func TestUploadResults(t *testing.T) {
 		expected = append(expected, filepath.Base(filename))
 	}
 
-	server := mock.NewStorageServer()
+	store, server := newMockStorage(t)
 	defer server.Close()
 
-	cli, err := server.GetClient()
-	if err != nil {
-		t.Fatalf("cannot get a client: %v", err)
-	}
-
-	store := azure.StorageService{
-		Client: cli.GetBlobService(),
-		Logger: log.New(ioutil.Discard, "", log.LstdFlags),
-	}
-
-	err = script.UploadResults(context.Background(), &store)
+	err = script.UploadResults(context.Background(), NewAzureStorage(StaticStorage(store)))
 	if err != nil {
 		t.Fatalf("UploadResults returns an error: %v", err)
 	}
@@ -388,9 +414,11 @@ func TestUploadResults(t *testing.T) {
 	}
 	for _, f := range expected {
 		name := filepath.Join("abc", f)
-		_, ok = c[name]
+		item, ok := c[name]
 		if !ok {
 			t.Errorf("uploaded file %q doesn't exist", name)
+		} else if strings.Contains(item.Body, "secret-value") {
+			t.Errorf("secret values in %q are not masked: %q", name, item.Body)
 		}
 	}
 	if t.Failed() {
@@ -448,5 +476,199 @@ func TestEntrypoint(t *testing.T) {
 	if !strings.Contains(res, "stdout0.txt") || !strings.Contains(res, "stdout1.txt") {
 		t.Error("Generated entrypoint is not correct:", res)
 	}
+	if strings.Contains(res, "timeout") {
+		t.Error("Generated entrypoint has time limits:", res)
+	}
+	if !strings.Contains(res, "${ROADIE_FIRST_STEP:-0}") {
+		t.Error("Generated entrypoint doesn't skip finished steps:", res)
+	}
+	if !strings.Contains(res, `trap "forward USR1" USR1`) {
+		t.Error("Generated entrypoint doesn't forward signals:", res)
+	}
+
+	script.StepTimeout = 30 * time.Minute
+	buf, err = script.Entrypoint()
+	if err != nil {
+		t.Fatalf("cannot create an entrypoint: %v", err)
+	}
+	res = string(buf)
+	if !strings.Contains(res, `timeout 1800 sh -c "cmd1"`) || !strings.Contains(res, `timeout 1800 sh -c "cmd2"`) {
+		t.Error("Generated entrypoint doesn't limit the time of each step:", res)
+	}
+	if !strings.Contains(res, "Step 1 timed out") {
+		t.Error("Generated entrypoint doesn't log timed out steps:", res)
+	}
+
+}
+
+// TestEntrypointStatus runs generated entrypoints and checks they exit with
+// the status of the first failed step.
+func TestEntrypointStatus(t *testing.T) {
+
+	if _, err := exec.LookPath("timeout"); err != nil {
+		t.Skip("timeout command isn't available")
+	}
+
+	cases := []struct {
+		name   string
+		run    []string
+		expect int
+	}{
+		{"succeeded", []string{"true", "echo ok"}, 0},
+		{"first step timed out", []string{"sleep 10", "echo ok"}, 124},
+		{"first step failed", []string{"exit 3", "exit 4"}, 3},
+		{"last step failed", []string{"echo ok", "exit 5"}, 5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			tmp, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatalf("cannot create a temporary directory: %v", err)
+			}
+			defer os.RemoveAll(tmp)
+
+			s := Script{
+				Script: &script.Script{
+					Run: c.run,
+				},
+				StepTimeout: time.Second,
+			}
+			buf, err := s.Entrypoint()
+			if err != nil {
+				t.Fatalf("cannot create an entrypoint: %v", err)
+			}
+			entrypoint := strings.Replace(string(buf), ContainerResultDir, tmp, -1)
+
+			cmd := exec.Command("bash", "-c", entrypoint)
+			output, err := cmd.CombinedOutput()
+			code := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+			} else if err != nil {
+				t.Fatalf("cannot run the entrypoint: %v", err)
+			}
+			if code != c.expect {
+				t.Errorf("entrypoint exits with %v, want %v: %s", code, c.expect, output)
+			}
+
+			// The following steps run even if a step fails.
+			data, err := ioutil.ReadFile(filepath.Join(tmp, "stdout1.txt"))
+			if err != nil {
+				t.Fatalf("the second step doesn't run: %v", err)
+			}
+			if strings.Contains(c.run[1], "echo") && string(data) != "ok\n" {
+				t.Errorf("stdout of the second step is %q, want %q", data, "ok\n")
+			}
+
+		})
+	}
+
+}
+
+func TestNewScript(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "script.yml")
+	err = ioutil.WriteFile(filename, []byte(`run:
+- cmd1
+env:
+  KEY: value
+secrets:
+  TOKEN: api-token
+`), 0644)
+	if err != nil {
+		t.Fatalf("cannot create a script file: %v", err)
+	}
+
+	s, err := NewScript(filename, log.New(ioutil.Discard, "", log.LstdFlags))
+	if err != nil {
+		t.Fatalf("NewScript returns an error: %v", err)
+	}
+	if len(s.Run) != 1 || s.Run[0] != "cmd1" {
+		t.Errorf("run section is %v, want %v", s.Run, []string{"cmd1"})
+	}
+	if s.Env["KEY"] != "value" {
+		t.Errorf("env section is %v", s.Env)
+	}
+	if s.Secrets["TOKEN"] != "api-token" {
+		t.Errorf("secrets section is %v", s.Secrets)
+	}
+
+}
+
+func TestEnvironment(t *testing.T) {
+
+	s := Script{
+		Script: new(script.Script),
+		Env: map[string]string{
+			"KEY": "value",
+		},
+		Secrets: map[string]string{
+			"TOKEN": "api-token",
+		},
+	}
+
+	env, err := s.Environment(Secrets{
+		"api-token": "secret-value",
+	})
+	if err != nil {
+		t.Fatalf("Environment returns an error: %v", err)
+	}
+	expected := map[string]struct{}{
+		"KEY=value":          struct{}{},
+		"TOKEN=secret-value": struct{}{},
+	}
+	if len(env) != len(expected) {
+		t.Errorf("Environment returns %v, want %v", env, expected)
+	}
+	for _, v := range env {
+		if _, ok := expected[v]; !ok {
+			t.Errorf("Environment returns an unexpected variable %q", v)
+		}
+	}
+
+	_, err = s.Environment(nil)
+	if err == nil {
+		t.Error("Environment doesn't return any errors with an undefined secret")
+	}
+
+}
+
+func TestOutputDirs(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	for _, dir := range []string{"out1", "out2"} {
+		if err = os.Mkdir(filepath.Join(tmp, dir), 0755); err != nil {
+			t.Fatalf("cannot create a directory: %v", err)
+		}
+	}
+
+	s := Script{
+		Script: &script.Script{
+			Upload: []string{"*.png", "out*/*.txt", "out1/*.csv", "missing/*.txt"},
+		},
+		Dir: tmp,
+	}
+	res := s.OutputDirs()
+	expect := []string{tmp, filepath.Join(tmp, "out1"), filepath.Join(tmp, "out2")}
+	if len(res) != len(expect) {
+		t.Fatalf("OutputDirs returns %v, want %v", res, expect)
+	}
+	for i, v := range res {
+		if v != expect[i] {
+			t.Errorf("OutputDirs returns %v, want %v", res, expect)
+		}
+	}
 
 }
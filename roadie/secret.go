@@ -0,0 +1,209 @@
+//
+// roadie/secret.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// SecretMask defines a string which replaces secret values in logs.
+	SecretMask = "********"
+)
+
+// Secrets maps secret names to their values.
+type Secrets map[string]string
+
+// ReadSecrets reads a YAML file which maps secret names to their values.
+func ReadSecrets(filename string) (res Secrets, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	res = make(Secrets)
+	err = yaml.Unmarshal(data, &res)
+	return
+
+}
+
+// Merge copies secrets in a given set to this set; secrets in the given set
+// overwrite existing ones.
+func (s Secrets) Merge(other Secrets) {
+	for k, v := range other {
+		s[k] = v
+	}
+}
+
+// Lookup returns the value of a given named secret.
+func (s Secrets) Lookup(name string) (value string, err error) {
+
+	value, ok := s[name]
+	if !ok {
+		err = fmt.Errorf("Secret %v is not defined", name)
+	}
+	return
+
+}
+
+// Values returns secret values in this set; longer values come first so that
+// a value containing another one is masked entirely.
+func (s Secrets) Values() (res []string) {
+
+	for _, v := range s {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return len(res[i]) > len(res[j])
+	})
+	return
+
+}
+
+// maskStrings returns a copy of given strings in which given secret values are
+// replaced with SecretMask.
+func maskStrings(values []string, secrets []string) []string {
+
+	if len(secrets) == 0 {
+		return values
+	}
+
+	var pairs []string
+	for _, v := range secrets {
+		pairs = append(pairs, v, SecretMask)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = replacer.Replace(v)
+	}
+	return res
+
+}
+
+// maskedWriter is a writer which replaces secret values with a mask.
+type maskedWriter struct {
+	io.Writer
+	replacer *strings.Replacer
+	mutex    sync.Mutex
+}
+
+// NewMaskedWriter creates a writer which replaces given secret values with
+// SecretMask before writing them to a given writer.
+func NewMaskedWriter(writer io.Writer, secrets []string) io.Writer {
+
+	if len(secrets) == 0 {
+		return writer
+	}
+
+	var pairs []string
+	for _, v := range secrets {
+		pairs = append(pairs, v, SecretMask)
+	}
+	w := &maskedWriter{
+		Writer:   writer,
+		replacer: strings.NewReplacer(pairs...),
+	}
+	if r, ok := writer.(OutputRecorder); ok {
+		return &maskedRecorder{
+			maskedWriter: w,
+			recorder:     r,
+		}
+	}
+	return w
+
+}
+
+// Write writes a given message replacing secret values. The returned length
+// is the length of the given message when no errors occur.
+func (w *maskedWriter) Write(p []byte) (n int, err error) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err = io.WriteString(w.Writer, w.replacer.Replace(string(p)))
+	if err != nil {
+		return
+	}
+	return len(p), nil
+
+}
+
+// NewMaskedReader creates a reader which replaces given secret values with
+// SecretMask in lines read from a given reader. Closing the returned reader
+// stops reading the given one.
+func NewMaskedReader(reader io.Reader, secrets []string) io.ReadCloser {
+
+	if len(secrets) == 0 {
+		return ioutil.NopCloser(reader)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		writer := NewMaskedWriter(w, secrets)
+		lines := bufio.NewReader(reader)
+		for {
+			// Secret values are masked line by line so that a value isn't
+			// split into two writes.
+			line, err := lines.ReadString('\n')
+			if len(line) != 0 {
+				if _, e := io.WriteString(writer, line); e != nil {
+					w.CloseWithError(e)
+					return
+				}
+			}
+			if err == io.EOF {
+				w.Close()
+				return
+			} else if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return r
+
+}
+
+// maskedRecorder is a masked writer of which the underlying writer is an
+// OutputRecorder.
+type maskedRecorder struct {
+	*maskedWriter
+	recorder OutputRecorder
+}
+
+// RecordOutput records a given line replacing secret values.
+func (w *maskedRecorder) RecordOutput(t time.Time, stream string, step int, line string) error {
+	return w.recorder.RecordOutput(t, stream, step, w.replacer.Replace(line))
+}
@@ -0,0 +1,115 @@
+//
+// roadie/secret_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadSecrets(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "secrets.yml")
+	err = ioutil.WriteFile(filename, []byte("api-token: abcdefg\npassword: 12345\n"), 0600)
+	if err != nil {
+		t.Fatalf("cannot create a secrets file: %v", err)
+	}
+
+	secrets, err := ReadSecrets(filename)
+	if err != nil {
+		t.Fatalf("ReadSecrets returns an error: %v", err)
+	}
+	if v, err := secrets.Lookup("api-token"); err != nil || v != "abcdefg" {
+		t.Errorf("secret api-token is %q (%v), want %q", v, err, "abcdefg")
+	}
+	if v, err := secrets.Lookup("password"); err != nil || v != "12345" {
+		t.Errorf("secret password is %q (%v), want %q", v, err, "12345")
+	}
+	if _, err = secrets.Lookup("undefined"); err == nil {
+		t.Error("Lookup doesn't return any errors for an undefined secret")
+	}
+
+}
+
+func TestMaskedReader(t *testing.T) {
+
+	secrets := Secrets{
+		"short": "abc",
+		"long":  "abcdefg",
+	}
+
+	// The reader returns a few bytes at a time so that a secret value is
+	// split into two reads.
+	msg := "token is abcdefg\npassword is abc"
+	reader := NewMaskedReader(iotest.OneByteReader(strings.NewReader(msg)), secrets.Values())
+	defer reader.Close()
+	res, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll returns an error: %v", err)
+	}
+	expected := fmt.Sprintf("token is %v\npassword is %v", SecretMask, SecretMask)
+	if string(res) != expected {
+		t.Errorf("read message is %q, want %q", res, expected)
+	}
+
+}
+
+func TestMaskedWriter(t *testing.T) {
+
+	secrets := Secrets{
+		"short": "abc",
+		"long":  "abcdefg",
+	}
+
+	var buf bytes.Buffer
+	writer := NewMaskedWriter(&buf, secrets.Values())
+	msg := "token is abcdefg and password is abc\n"
+	n, err := fmt.Fprint(writer, msg)
+	if err != nil {
+		t.Fatalf("Write returns an error: %v", err)
+	}
+	if n != len(msg) {
+		t.Errorf("Write returns %v, want %v", n, len(msg))
+	}
+
+	res := buf.String()
+	if strings.Contains(res, "abc") {
+		t.Errorf("secret values are not masked: %q", res)
+	}
+	expected := fmt.Sprintf("token is %v and password is %v\n", SecretMask, SecretMask)
+	if res != expected {
+		t.Errorf("written message is %q, want %q", res, expected)
+	}
+
+}
@@ -0,0 +1,152 @@
+//
+// roadie/security.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	// SandboxUID defines the user ID running sandbox containers when the
+	// workspace is owned by root.
+	SandboxUID = 1000
+	// SandboxGID defines the group ID running sandbox containers when the
+	// workspace is owned by root.
+	SandboxGID = 1000
+)
+
+// Security defines options to harden sandbox containers.
+type Security struct {
+	// Network is one of NetworkDefault, NetworkNone, and NetworkRestricted.
+	Network string `yaml:"network,omitempty"`
+	// Allow lists host names, IP addresses, or CIDR blocks sandbox containers
+	// can connect to when Network is NetworkRestricted.
+	Allow []string `yaml:"allow,omitempty"`
+	// NonRoot runs sandbox containers as the owner of the workspace.
+	NonRoot bool `yaml:"non_root,omitempty"`
+	// ReadOnly makes the root file system read-only.
+	ReadOnly bool `yaml:"read_only,omitempty"`
+	// Scratch lists writable paths in a read-only root file system.
+	Scratch []string `yaml:"scratch,omitempty"`
+	// DropCapabilities drops all kernel capabilities but ones in CapAdd.
+	DropCapabilities bool     `yaml:"drop_capabilities,omitempty"`
+	CapAdd           []string `yaml:"cap_add,omitempty"`
+	// NoNewPrivileges prevents processes from gaining new privileges.
+	NoNewPrivileges bool `yaml:"no_new_privileges,omitempty"`
+	// Seccomp is the path to a custom seccomp profile.
+	Seccomp string `yaml:"seccomp,omitempty"`
+}
+
+// Apply sets options of this security profile to a given start option.
+// If NonRoot is set and the given workspace is owned by root, the ownership of
+// the workspace and given directories in it, which the sandbox writes to, will
+// be changed to SandboxUID and SandboxGID. Files and the other directories are
+// kept owned by root; the sandbox can create files in those directories but
+// cannot modify source code and data files.
+func (s *Security) Apply(opt *DockerStartOpt, workspace string, writable []string) (err error) {
+
+	switch s.Network {
+	case NetworkDefault, NetworkNone:
+	case NetworkRestricted:
+		opt.AllowedHosts = s.Allow
+	default:
+		return fmt.Errorf("Unsupported network mode: %v", s.Network)
+	}
+	opt.Network = s.Network
+
+	if s.NonRoot {
+		var uid, gid int
+		uid, gid, err = workspaceOwner(workspace, writable)
+		if err != nil {
+			return
+		}
+		opt.User = fmt.Sprintf("%v:%v", uid, gid)
+		opt.Env = append(opt.Env, "HOME=/tmp")
+	}
+
+	opt.ReadOnly = s.ReadOnly
+	opt.Tmpfs = s.Scratch
+	if s.DropCapabilities {
+		opt.CapDrop = []string{"ALL"}
+		opt.CapAdd = s.CapAdd
+	}
+	if s.NoNewPrivileges {
+		opt.SecurityOpt = append(opt.SecurityOpt, "no-new-privileges")
+	}
+
+	if s.Seccomp != "" {
+		// Docker requires the content of a profile instead of a path.
+		var data []byte
+		data, err = ioutil.ReadFile(s.Seccomp)
+		if err != nil {
+			return
+		}
+		opt.SecurityOpt = append(opt.SecurityOpt, fmt.Sprintf("seccomp=%s", data))
+	}
+	return
+
+}
+
+// workspaceOwner returns the user and group IDs of a given workspace; if the
+// workspace is owned by root, the ownership of the workspace and given
+// writable directories in it is changed to SandboxUID and SandboxGID.
+// Directories which don't exist or are out of the workspace are ignored.
+func workspaceOwner(workspace string, writable []string) (uid, gid int, err error) {
+
+	info, err := os.Stat(workspace)
+	if err != nil {
+		return
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		err = fmt.Errorf("Cannot find the owner of %v", workspace)
+		return
+	}
+	if stat.Uid != 0 {
+		return int(stat.Uid), int(stat.Gid), nil
+	}
+
+	uid, gid = SandboxUID, SandboxGID
+	if err = os.Lchown(workspace, uid, gid); err != nil {
+		return
+	}
+	for _, dir := range writable {
+		rel, err2 := filepath.Rel(workspace, dir)
+		if err2 != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		info, err2 := os.Lstat(dir)
+		if err2 != nil || !info.IsDir() {
+			continue
+		}
+		if err = os.Lchown(dir, uid, gid); err != nil {
+			return
+		}
+	}
+	return
+
+}
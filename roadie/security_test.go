@@ -0,0 +1,241 @@
+//
+// roadie/security_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSecurityApply(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	profile := filepath.Join(tmp, "seccomp.json")
+	err = ioutil.WriteFile(profile, []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`), 0644)
+	if err != nil {
+		t.Fatalf("cannot create a seccomp profile: %v", err)
+	}
+
+	s := Security{
+		Network:          NetworkRestricted,
+		Allow:            []string{"10.0.0.1"},
+		NonRoot:          true,
+		ReadOnly:         true,
+		Scratch:          []string{"/tmp"},
+		DropCapabilities: true,
+		CapAdd:           []string{"CHOWN"},
+		NoNewPrivileges:  true,
+		Seccomp:          profile,
+	}
+	var opt DockerStartOpt
+	err = s.Apply(&opt, tmp, nil)
+	if err != nil {
+		t.Fatalf("Apply returns an error: %v", err)
+	}
+
+	if opt.Network != NetworkRestricted || len(opt.AllowedHosts) != 1 {
+		t.Errorf("network is %q with %v, want %q with %v", opt.Network, opt.AllowedHosts, NetworkRestricted, s.Allow)
+	}
+	expectedUser := fmt.Sprintf("%v:%v", os.Getuid(), os.Getgid())
+	if os.Getuid() == 0 {
+		expectedUser = fmt.Sprintf("%v:%v", SandboxUID, SandboxGID)
+	}
+	if opt.User != expectedUser {
+		t.Errorf("user is %q, want %q", opt.User, expectedUser)
+	}
+	if !opt.ReadOnly || len(opt.Tmpfs) != 1 {
+		t.Errorf("read-only is %v with %v, want true with %v", opt.ReadOnly, opt.Tmpfs, s.Scratch)
+	}
+	if len(opt.CapDrop) != 1 || opt.CapDrop[0] != "ALL" {
+		t.Errorf("dropped capabilities are %v, want %v", opt.CapDrop, []string{"ALL"})
+	}
+	if len(opt.CapAdd) != 1 || opt.CapAdd[0] != "CHOWN" {
+		t.Errorf("added capabilities are %v, want %v", opt.CapAdd, s.CapAdd)
+	}
+	if len(opt.SecurityOpt) != 2 || opt.SecurityOpt[0] != "no-new-privileges" || !strings.HasPrefix(opt.SecurityOpt[1], "seccomp={") {
+		t.Errorf("security options are %v", opt.SecurityOpt)
+	}
+
+	s = Security{
+		Network: "unknown",
+	}
+	if err = s.Apply(&opt, tmp, nil); err == nil {
+		t.Error("Apply doesn't return any errors with an unsupported network mode")
+	}
+
+}
+
+func TestResolveHost(t *testing.T) {
+
+	cases := []struct {
+		host   string
+		expect string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"localhost", "127.0.0.1"},
+	}
+
+	for _, c := range cases {
+		res, err := resolveHost(c.host)
+		if err != nil {
+			t.Fatalf("resolveHost returns an error: %v", err)
+		}
+		if len(res) == 0 || res[0] != c.expect {
+			t.Errorf("resolveHost(%q) returns %v, want %v", c.host, res, c.expect)
+		}
+	}
+
+}
+
+func TestRestrictedRules(t *testing.T) {
+
+	rules := restrictedRules("roadie0", []string{"10.0.0.1"}, []string{"168.63.129.16"})
+	expect := []string{
+		"-i roadie0 -d 10.0.0.1 -j ACCEPT",
+		"-i roadie0 -d 168.63.129.16 -p udp --dport 53 -j ACCEPT",
+		"-i roadie0 -d 168.63.129.16 -p tcp --dport 53 -j ACCEPT",
+		"-i roadie0 ! -o roadie0 -j DROP",
+	}
+	if len(rules) != len(expect) {
+		t.Fatalf("restrictedRules returns %v, want %v", rules, expect)
+	}
+	for i, rule := range rules {
+		if strings.Join(rule, " ") != expect[i] {
+			t.Errorf("rule %v is %q, want %q", i, strings.Join(rule, " "), expect[i])
+		}
+		// Every accepted connection must have its destination.
+		if rule[len(rule)-1] == "ACCEPT" && !strings.Contains(strings.Join(rule, " "), " -d ") {
+			t.Errorf("rule %v accepts any destinations", i)
+		}
+	}
+
+}
+
+func TestNameservers(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "resolv.conf")
+	err = ioutil.WriteFile(filename, []byte("# comment\nsearch example.com\nnameserver 127.0.0.53\nnameserver 168.63.129.16\nnameserver ::1\n"), 0644)
+	if err != nil {
+		t.Fatalf("cannot create a resolver configuration: %v", err)
+	}
+	res, err := nameservers(filename)
+	if err != nil {
+		t.Fatalf("nameservers returns an error: %v", err)
+	}
+	if len(res) != 1 || res[0] != "168.63.129.16" {
+		t.Errorf("nameservers returns %v, want %v", res, []string{"168.63.129.16"})
+	}
+
+	// Docker uses upstream name servers of systemd-resolved if the host has
+	// only the local stub resolver.
+	err = ioutil.WriteFile(filename, []byte("nameserver 127.0.0.53\n"), 0644)
+	if err != nil {
+		t.Fatalf("cannot create a resolver configuration: %v", err)
+	}
+	resolved := filepath.Join(tmp, "resolved.conf")
+	err = ioutil.WriteFile(resolved, []byte("nameserver 10.0.0.2\nnameserver 10.0.0.3\n"), 0644)
+	if err != nil {
+		t.Fatalf("cannot create a resolver configuration: %v", err)
+	}
+	if res, err = nameservers(filename, resolved); err != nil {
+		t.Fatalf("nameservers returns an error: %v", err)
+	} else if expect := []string{"10.0.0.2", "10.0.0.3"}; !reflect.DeepEqual(res, expect) {
+		t.Errorf("nameservers returns %v, want %v", res, expect)
+	}
+
+	// Docker uses the public name servers if neither has usable ones.
+	if res, err = nameservers(filename, filepath.Join(tmp, "not-existing.conf")); err != nil {
+		t.Fatalf("nameservers returns an error: %v", err)
+	} else if len(res) != len(defaultNameservers) {
+		t.Errorf("nameservers returns %v, want %v", res, defaultNameservers)
+	}
+
+}
+
+func TestWorkspaceOwner(t *testing.T) {
+
+	if os.Getuid() != 0 {
+		t.Skip("changing ownership requires root")
+	}
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	outputs := filepath.Join(tmp, "outputs")
+	sources := filepath.Join(tmp, "src")
+	for _, dir := range []string{outputs, sources} {
+		if err = os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("cannot create a directory: %v", err)
+		}
+	}
+	source := filepath.Join(sources, "main.py")
+	if err = ioutil.WriteFile(source, []byte("print(1)\n"), 0644); err != nil {
+		t.Fatalf("cannot create a file: %v", err)
+	}
+
+	uid, gid, err := workspaceOwner(tmp, []string{outputs, os.TempDir()})
+	if err != nil {
+		t.Fatalf("workspaceOwner returns an error: %v", err)
+	}
+	if uid != SandboxUID || gid != SandboxGID {
+		t.Errorf("workspaceOwner returns %v:%v, want %v:%v", uid, gid, SandboxUID, SandboxGID)
+	}
+
+	cases := map[string]uint32{
+		tmp:          SandboxUID,
+		outputs:      SandboxUID,
+		sources:      0,
+		source:       0,
+		os.TempDir(): 0,
+	}
+	for path, expect := range cases {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatalf("cannot find %v: %v", path, err)
+		}
+		if owner := info.Sys().(*syscall.Stat_t).Uid; owner != expect {
+			t.Errorf("owner of %v is %v, want %v", path, owner, expect)
+		}
+	}
+
+}
@@ -0,0 +1,331 @@
+//
+// roadie/status.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	// OutcomeSucceeded means the task finished without errors.
+	OutcomeSucceeded = "succeeded"
+	// OutcomeFailed means the task failed.
+	OutcomeFailed = "failed"
+	// OutcomeCancelled means the task was cancelled.
+	OutcomeCancelled = "cancelled"
+	// OutcomeTimeout means the task exceeded its time limit.
+	OutcomeTimeout = "timeout"
+	// OutcomeEvicted means the machine running the task was evicted.
+	OutcomeEvicted = "evicted"
+)
+
+var (
+	// StatusInterval defines how often the status file is updated even if
+	// nothing changes, i.e. the interval of heartbeats.
+	StatusInterval = 30 * time.Second
+)
+
+// PhaseTime defines when a phase started and ended.
+type PhaseTime struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// StepStatus defines the progress of a run step.
+type StepStatus struct {
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	ExitCode *int       `json:"exit_code,omitempty"`
+}
+
+// CombinationStatus defines the progress of a combination of parameters in
+// a matrix.
+type CombinationStatus struct {
+	Phases map[string]*PhaseTime `json:"phases"`
+	Steps  []StepStatus          `json:"steps,omitempty"`
+}
+
+// TaskStatus defines the JSON format of a status file.
+type TaskStatus struct {
+	Name   string                `json:"name"`
+	Phase  string                `json:"phase,omitempty"`
+	Phases map[string]*PhaseTime `json:"phases"`
+	Steps  []StepStatus          `json:"steps,omitempty"`
+	// Combination is the ID of the combination running now; phases and steps
+	// of each combination are recorded in Combinations instead of Phases and
+	// Steps.
+	Combination  string                        `json:"combination,omitempty"`
+	Combinations map[string]*CombinationStatus `json:"combinations,omitempty"`
+	Heartbeat    time.Time                     `json:"heartbeat"`
+	// Outcome is one of OutcomeSucceeded, OutcomeFailed, OutcomeCancelled,
+	// OutcomeTimeout, and OutcomeEvicted; it is empty while the task is
+	// running.
+	Outcome string `json:"outcome,omitempty"`
+	// ExitCode is the exit code of the sandbox container.
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StatusReporter maintains a status file of a task, which is named
+// <name>-status.json, in the log container of a storage. The file is updated when the
+// status changes and every StatusInterval. Methods are safe for concurrent
+// use.
+type StatusReporter struct {
+	ctx   context.Context
+	store Storage
+	name  string
+	debug io.Writer
+
+	mutex  sync.Mutex
+	status TaskStatus
+
+	updated chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewStatusReporter creates a new status reporter of a given named task;
+// errors are written to a given debug writer if it isn't nil.
+func NewStatusReporter(ctx context.Context, store Storage, name string, debug io.Writer) *StatusReporter {
+
+	if debug == nil {
+		debug = ioutil.Discard
+	}
+
+	r := &StatusReporter{
+		ctx:   ctx,
+		store: store,
+		name:  fmt.Sprintf("%v-status.json", name),
+		debug: debug,
+		status: TaskStatus{
+			Name:   name,
+			Phases: make(map[string]*PhaseTime),
+		},
+		updated: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(StatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-r.updated:
+			case <-r.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+			r.upload()
+		}
+	}()
+	r.notify()
+	return r
+
+}
+
+// SetCombination ends the current phase and starts recording phases and steps
+// of a given combination.
+func (r *StatusReporter) SetCombination(id string) {
+
+	r.update(func(s *TaskStatus, now time.Time) {
+		s.endPhase(now)
+		if s.Combinations == nil {
+			s.Combinations = make(map[string]*CombinationStatus)
+		}
+		s.Combination = id
+		s.Phase = ""
+		s.Combinations[id] = &CombinationStatus{
+			Phases: make(map[string]*PhaseTime),
+		}
+	})
+
+}
+
+// SetPhase ends the current phase and starts a given phase.
+func (r *StatusReporter) SetPhase(phase string) {
+
+	r.update(func(s *TaskStatus, now time.Time) {
+		s.endPhase(now)
+		s.Phase = phase
+		phases, _ := s.current()
+		phases[phase] = &PhaseTime{
+			Start: now,
+		}
+	})
+
+}
+
+// SetSteps sets the number of run steps.
+func (r *StatusReporter) SetSteps(n int) {
+
+	r.update(func(s *TaskStatus, _ time.Time) {
+		_, steps := s.current()
+		*steps = make([]StepStatus, n)
+	})
+
+}
+
+// BeginStep records a given run step began.
+func (r *StatusReporter) BeginStep(index int) {
+
+	r.update(func(s *TaskStatus, now time.Time) {
+		if step := s.step(index); step != nil {
+			step.Start = &now
+		}
+	})
+
+}
+
+// EndStep records a given run step ended with a given exit code.
+func (r *StatusReporter) EndStep(index, code int) {
+
+	r.update(func(s *TaskStatus, now time.Time) {
+		if step := s.step(index); step != nil {
+			step.End = &now
+			step.ExitCode = &code
+		}
+	})
+
+}
+
+// Finish records the outcome of the task; the exit code is recorded if it
+// isn't nil and the error is recorded if it isn't nil. The current phase ends.
+func (r *StatusReporter) Finish(outcome string, code *int, err error) {
+
+	r.update(func(s *TaskStatus, now time.Time) {
+		s.endPhase(now)
+		s.Outcome = outcome
+		s.ExitCode = code
+		if err != nil {
+			s.Error = err.Error()
+		}
+	})
+
+}
+
+// Status returns a copy of the current status.
+func (r *StatusReporter) Status() (res TaskStatus) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Copy the status via JSON so that the copy doesn't share pointers.
+	data, err := json.Marshal(&r.status)
+	if err == nil {
+		err = json.Unmarshal(data, &res)
+	}
+	if err != nil {
+		fmt.Fprintln(r.debug, "Cannot copy the task status:", err)
+	}
+	return
+
+}
+
+// Close stops heartbeats and uploads the last status.
+func (r *StatusReporter) Close() error {
+
+	select {
+	case <-r.stop:
+		return nil
+	default:
+	}
+	close(r.stop)
+	<-r.done
+	return r.upload()
+
+}
+
+// update modifies the status by a given function and schedules uploading it.
+func (r *StatusReporter) update(f func(s *TaskStatus, now time.Time)) {
+
+	r.mutex.Lock()
+	f(&r.status, time.Now().UTC())
+	r.mutex.Unlock()
+	r.notify()
+
+}
+
+// notify schedules uploading the status.
+func (r *StatusReporter) notify() {
+	select {
+	case r.updated <- struct{}{}:
+	default:
+	}
+}
+
+// upload uploads the current status with a new heartbeat.
+func (r *StatusReporter) upload() (err error) {
+
+	r.mutex.Lock()
+	r.status.Heartbeat = time.Now().UTC()
+	data, err := json.MarshalIndent(&r.status, "", "  ")
+	r.mutex.Unlock()
+	if err != nil {
+		fmt.Fprintln(r.debug, "Cannot encode the task status:", err)
+		return
+	}
+
+	err = r.store.Upload(r.ctx, LogContainer, r.name, bytes.NewReader(data), "application/json")
+	if err != nil {
+		fmt.Fprintln(r.debug, "Cannot upload the task status:", err)
+	}
+	return
+
+}
+
+// current returns phases and steps of the running combination; they are the
+// ones of the task if no combination is running.
+func (s *TaskStatus) current() (map[string]*PhaseTime, *[]StepStatus) {
+	if c, exist := s.Combinations[s.Combination]; exist {
+		return c.Phases, &c.Steps
+	}
+	return s.Phases, &s.Steps
+}
+
+// endPhase records the current phase ended at a given time.
+func (s *TaskStatus) endPhase(now time.Time) {
+	phases, _ := s.current()
+	if current, exist := phases[s.Phase]; exist && current.End == nil {
+		current.End = &now
+	}
+}
+
+// step returns the status of a given run step of the running combination; it
+// returns nil if the index is out of range.
+func (s *TaskStatus) step(index int) *StepStatus {
+	_, steps := s.current()
+	if index < 0 || index >= len(*steps) {
+		return nil
+	}
+	return &(*steps)[index]
+}
@@ -0,0 +1,132 @@
+//
+// roadie/status_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStatusReporter(t *testing.T) {
+
+	store, server := newMockStorage(t)
+	defer server.Close()
+
+	testName := "test-name"
+	r := NewStatusReporter(context.Background(), NewAzureStorage(StaticStorage(store)), testName, nil)
+	r.SetPhase(PhaseBuild)
+	r.SetPhase(PhaseRun)
+	r.SetSteps(2)
+	r.BeginStep(0)
+	r.EndStep(0, 0)
+	r.BeginStep(1)
+	r.EndStep(1, 3)
+	r.EndStep(5, 0)
+	code := 3
+	r.Finish(OutcomeFailed, &code, fmt.Errorf("test error"))
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close returns an error: %v", err)
+	}
+
+	f, ok := server.Items["log"][fmt.Sprintf("%v-status.json", testName)]
+	if !ok {
+		t.Fatal("status file doesn't exist")
+	}
+	var res TaskStatus
+	if err := json.Unmarshal([]byte(f.Body), &res); err != nil {
+		t.Fatalf("cannot parse the status file: %v", err)
+	}
+
+	if res.Name != testName || res.Phase != PhaseRun || res.Outcome != OutcomeFailed || res.Error != "test error" {
+		t.Errorf("status is %+v", res)
+	}
+	if res.ExitCode == nil || *res.ExitCode != code {
+		t.Errorf("exit code is %v, want %v", res.ExitCode, code)
+	}
+	if p := res.Phases[PhaseBuild]; p == nil || p.End == nil {
+		t.Errorf("build phase is %+v, want an ended phase", p)
+	}
+	if p := res.Phases[PhaseRun]; p == nil || p.End == nil {
+		t.Errorf("run phase is %+v, want an ended phase", p)
+	}
+	if len(res.Steps) != 2 {
+		t.Fatalf("%v steps are recorded, want 2", len(res.Steps))
+	}
+	for i, expect := range []int{0, 3} {
+		step := res.Steps[i]
+		if step.Start == nil || step.End == nil || step.ExitCode == nil || *step.ExitCode != expect {
+			t.Errorf("step %v is %+v, want exit code %v", i, step, expect)
+		}
+	}
+	if res.Heartbeat.IsZero() {
+		t.Error("heartbeat isn't recorded")
+	}
+
+}
+
+func TestStatusReporterCombinations(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewStatusReporter(context.Background(), NewLocalStorage(dir), "test-name", nil)
+	defer r.Close()
+	r.SetPhase(PhaseSource)
+	for _, id := range []string{"1", "2"} {
+		r.SetCombination(id)
+		r.SetPhase(PhaseBuild)
+		r.SetSteps(1)
+		r.SetPhase(PhaseRun)
+		r.BeginStep(0)
+		r.EndStep(0, 0)
+	}
+	r.Finish(OutcomeSucceeded, nil, nil)
+
+	res := r.Status()
+	if p := res.Phases[PhaseSource]; p == nil || p.End == nil {
+		t.Errorf("source phase is %+v, want an ended phase", p)
+	}
+	if _, exist := res.Phases[PhaseBuild]; exist {
+		t.Error("build phase of a combination is recorded as a phase of the task")
+	}
+	if res.Combination != "2" || len(res.Combinations) != 2 {
+		t.Fatalf("combinations are %v (current %v), want 2 combinations", res.Combinations, res.Combination)
+	}
+	for id, c := range res.Combinations {
+		for _, phase := range []string{PhaseBuild, PhaseRun} {
+			if p := c.Phases[phase]; p == nil || p.End == nil {
+				t.Errorf("%v phase of combination %v is %+v, want an ended phase", phase, id, p)
+			}
+		}
+		if len(c.Steps) != 1 || c.Steps[0].ExitCode == nil {
+			t.Errorf("steps of combination %v are %+v", id, c.Steps)
+		}
+	}
+
+}
@@ -0,0 +1,288 @@
+//
+// roadie/storage.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jkawamoto/roadie/cloud/azure"
+)
+
+const (
+	// StartupContainer is the container having config and script files.
+	StartupContainer = azure.StartupContainer
+	// LogContainer is the container having log files.
+	LogContainer = azure.LogContainer
+	// ResultContainer is the container having result files.
+	ResultContainer = azure.ResultContainer
+
+	// StorageAzure is the type of Azure Blob storage.
+	StorageAzure = "azure"
+	// StorageLocal is the type of local directory storage.
+	StorageLocal = "local"
+	// StorageS3 is the type of S3 compatible storage.
+	StorageS3 = "s3"
+)
+
+// Storage is an interface of storage services; files are identified by
+// containers, e.g. LogContainer, and names which may contain slashes.
+type Storage interface {
+	// Upload stores a file read from a given reader; if the content type is
+	// empty, the storage's default is used.
+	Upload(ctx context.Context, container, name string, in io.Reader, contentType string) error
+	// Open opens a file to read it.
+	Open(ctx context.Context, container, name string) (io.ReadCloser, error)
+	// Delete deletes a file.
+	Delete(ctx context.Context, container, name string) error
+	// List calls a given handler with the name of each file of which the name
+	// starts with a given prefix.
+	List(ctx context.Context, container, prefix string, handler func(name string) error) error
+}
+
+// Appender is implemented by storages which can append data to a file so
+// that the file can be read while it is written, e.g. log files.
+type Appender interface {
+	// Append appends given data to a file; the file is created if not exists.
+	Append(ctx context.Context, container, name string, data []byte, contentType string) error
+}
+
+// StorageConfig defines the storage section of a config file.
+type StorageConfig struct {
+	// Type is one of StorageAzure, StorageLocal, and StorageS3; StorageAzure
+	// is used if empty.
+	Type string `yaml:"type,omitempty"`
+	// Path is the root directory of a local storage.
+	Path string `yaml:"path,omitempty"`
+	// Endpoint, Region, Bucket, Prefix, AccessKey, and SecretKey define an
+	// S3 compatible storage.
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	Bucket    string `yaml:"bucket,omitempty"`
+	Prefix    string `yaml:"prefix,omitempty"`
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+}
+
+// IsAzure returns true if this section chooses Azure Blob storage, which
+// requires credentials of Azure.
+func (c *StorageConfig) IsAzure() bool {
+	return c.Type == "" || c.Type == StorageAzure
+}
+
+// Storage creates a storage defined in this section; a given provider is used
+// for Azure Blob storage.
+func (c *StorageConfig) Storage(provider StorageProvider) (store Storage, err error) {
+
+	switch c.Type {
+	case "", StorageAzure:
+		if provider == nil {
+			return nil, fmt.Errorf("Azure storage requires a credential")
+		}
+		return NewAzureStorage(provider), nil
+
+	case StorageLocal:
+		if c.Path == "" {
+			return nil, fmt.Errorf("Local storage requires a path")
+		}
+		return NewLocalStorage(c.Path), nil
+
+	case StorageS3:
+		if c.Bucket == "" {
+			return nil, fmt.Errorf("S3 storage requires a bucket")
+		}
+		return &S3Storage{
+			Endpoint:  c.Endpoint,
+			Region:    c.Region,
+			Bucket:    c.Bucket,
+			Prefix:    c.Prefix,
+			AccessKey: c.AccessKey,
+			SecretKey: c.SecretKey,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported storage type: %v", c.Type)
+	}
+
+}
+
+// LocalStorage is a storage which stores files in a local directory; each
+// container is a sub directory.
+type LocalStorage struct {
+	Root string
+}
+
+// NewLocalStorage creates a new storage using a given root directory.
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{
+		Root: root,
+	}
+}
+
+// Upload stores a file; the content type is ignored.
+func (s *LocalStorage) Upload(ctx context.Context, container, name string, in io.Reader, contentType string) (err error) {
+
+	filename, err := s.path(container, name)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+
+	// Write to a temporary file and rename it so that readers never see
+	// partially written files.
+	fp, err := ioutil.TempFile(filepath.Dir(filename), ".upload-")
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(fp, &contextReader{ctx: ctx, Reader: in})
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(fp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+	}
+	return
+
+}
+
+// Append appends given data to a file; the content type is ignored.
+func (s *LocalStorage) Append(ctx context.Context, container, name string, data []byte, contentType string) (err error) {
+
+	filename, err := s.path(container, name)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+
+	fp, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	_, err = fp.Write(data)
+	return
+
+}
+
+// Open opens a file.
+func (s *LocalStorage) Open(ctx context.Context, container, name string) (io.ReadCloser, error) {
+
+	filename, err := s.path(container, name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filename)
+
+}
+
+// Delete deletes a file.
+func (s *LocalStorage) Delete(ctx context.Context, container, name string) error {
+
+	filename, err := s.path(container, name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filename)
+
+}
+
+// List calls a given handler with names of files having a given prefix.
+func (s *LocalStorage) List(ctx context.Context, container, prefix string, handler func(name string) error) error {
+
+	root, err := s.path(container, "")
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+
+		if os.IsNotExist(err) && path == root {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		return handler(name)
+
+	})
+
+}
+
+// path returns the path to a given file; it returns an error if the path is
+// outside of the container.
+func (s *LocalStorage) path(container, name string) (res string, err error) {
+
+	if container == "" || strings.ContainsAny(container, `/\`) || container == "." || container == ".." {
+		return "", fmt.Errorf("Invalid container name: %q", container)
+	}
+	root := filepath.Join(s.Root, container)
+	res = filepath.Join(root, filepath.FromSlash(name))
+	if res != root && !strings.HasPrefix(res, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("Invalid file name: %q", name)
+	}
+	return
+
+}
+
+// contextReader is a reader which stops reading when a context is done.
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+// Read reads data unless the context is done.
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
@@ -0,0 +1,203 @@
+//
+// roadie/storage_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStorage tests uploading, opening, listing, and deleting files in a
+// given storage.
+func testStorage(t *testing.T, store Storage) {
+
+	ctx := context.Background()
+	files := map[string]string{
+		"task/stdout0.txt": "abc",
+		"task/stdout1.txt": "def",
+		"other.txt":        "ghi",
+	}
+	for name, body := range files {
+		if err := store.Upload(ctx, ResultContainer, name, strings.NewReader(body), "text/plain"); err != nil {
+			t.Fatalf("Upload(%v) returns an error: %v", name, err)
+		}
+	}
+
+	for name, body := range files {
+		r, err := store.Open(ctx, ResultContainer, name)
+		if err != nil {
+			t.Fatalf("Open(%v) returns an error: %v", name, err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("cannot read %v: %v", name, err)
+		}
+		if string(data) != body {
+			t.Errorf("%v has %q, want %q", name, data, body)
+		}
+	}
+	if _, err := store.Open(ctx, LogContainer, "task/stdout0.txt"); err == nil {
+		t.Error("Open returns no errors for a file in another container")
+	}
+
+	var names []string
+	err := store.List(ctx, ResultContainer, "task/", func(name string) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List returns an error: %v", err)
+	}
+	sort.Strings(names)
+	if expect := []string{"task/stdout0.txt", "task/stdout1.txt"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("List finds %v, want %v", names, expect)
+	}
+
+	if err = store.Delete(ctx, ResultContainer, "other.txt"); err != nil {
+		t.Fatalf("Delete returns an error: %v", err)
+	}
+	if _, err = store.Open(ctx, ResultContainer, "other.txt"); err == nil {
+		t.Error("deleted file can be opened")
+	}
+
+}
+
+func TestLocalStorage(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	testStorage(t, NewLocalStorage(root))
+
+}
+
+func TestLocalStorageAppend(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	store := NewLocalStorage(root)
+	var expect string
+	for i := 0; i != 3; i++ {
+		msg := fmt.Sprintf("msg,%v\n", i)
+		if err = store.Append(context.Background(), LogContainer, "task.log", []byte(msg), "text/plain"); err != nil {
+			t.Fatalf("Append returns an error: %v", err)
+		}
+		expect += msg
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, LogContainer, "task.log"))
+	if err != nil {
+		t.Fatalf("cannot read the appended file: %v", err)
+	}
+	if string(data) != expect {
+		t.Errorf("appended file has %q, want %q", data, expect)
+	}
+
+}
+
+func TestLocalStoragePath(t *testing.T) {
+
+	store := NewLocalStorage("/tmp/roadie")
+	cases := []struct {
+		container string
+		name      string
+		valid     bool
+	}{
+		{ResultContainer, "task/stdout0.txt", true},
+		{ResultContainer, "../secret", false},
+		{ResultContainer, "task/../../secret", false},
+		{"..", "secret", false},
+	}
+	for _, c := range cases {
+		_, err := store.path(c.container, c.name)
+		if c.valid && err != nil {
+			t.Errorf("path(%q, %q) returns an error: %v", c.container, c.name, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("path(%q, %q) returns no errors", c.container, c.name)
+		}
+	}
+
+}
+
+func TestLocalStorageClients(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	store := NewLocalStorage(root)
+	testName := "test-name"
+
+	log := NewLogWriter(context.Background(), store, testName+".log", nil)
+	fmt.Fprintln(log, "msg")
+	if err = log.Close(); err != nil {
+		t.Fatalf("cannot close a log writer: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, LogContainer, testName+".log"))
+	if err != nil {
+		t.Fatalf("cannot read the log file: %v", err)
+	}
+	if string(data) != "msg\n" {
+		t.Errorf("log file has %q, want %q", data, "msg\n")
+	}
+
+	r := NewStatusReporter(context.Background(), store, testName, nil)
+	r.Finish(OutcomeSucceeded, nil, nil)
+	if err = r.Close(); err != nil {
+		t.Fatalf("cannot close a status reporter: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(root, LogContainer, testName+"-status.json")); err != nil {
+		t.Errorf("status file doesn't exist: %v", err)
+	}
+
+	defer setDuration(&CancelCheckInterval, 10*time.Millisecond)()
+	err = store.Upload(context.Background(), StartupContainer, CancelMarker(testName), strings.NewReader(""), "")
+	if err != nil {
+		t.Fatalf("cannot create a cancel marker: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = WaitCancelMarker(ctx, store, testName); err != nil {
+		t.Fatalf("WaitCancelMarker returns an error: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(root, StartupContainer, CancelMarker(testName))); !os.IsNotExist(err) {
+		t.Errorf("cancel marker isn't deleted: %v", err)
+	}
+
+}
@@ -0,0 +1,150 @@
+//
+// roadie/sync.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// SyncPollInterval defines how often result files are checked for
+	// changes when Sync.OnChange is set.
+	SyncPollInterval = 10 * time.Second
+)
+
+// Sync defines options to upload result files while run steps are running so
+// that an interrupted task doesn't lose them.
+type Sync struct {
+	// Interval defines how often new and modified result files are uploaded.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// OnChange uploads result files soon after they are modified; they are
+	// checked every SyncPollInterval.
+	OnChange bool `yaml:"on_change,omitempty"`
+}
+
+// Enabled returns true if result files are uploaded while running.
+func (s *Sync) Enabled() bool {
+	return s.Interval > 0 || s.OnChange
+}
+
+// period returns how often result files are checked.
+func (s *Sync) period() time.Duration {
+	if s.OnChange && (s.Interval <= 0 || s.Interval > SyncPollInterval) {
+		return SyncPollInterval
+	}
+	return s.Interval
+}
+
+// syncedFile defines the state of a local file when it was uploaded.
+type syncedFile struct {
+	ModTime time.Time
+	Size    int64
+	// Name is the name of the uploaded file.
+	Name string
+}
+
+// ResultSyncer uploads result files of a script which are new or modified
+// since the last sync.
+type ResultSyncer struct {
+	script *Script
+	store  Storage
+	synced map[string]syncedFile
+	mutex  sync.Mutex
+}
+
+// NewResultSyncer creates a result syncer uploading result files of a given
+// script to a given storage.
+func NewResultSyncer(script *Script, store Storage) *ResultSyncer {
+	return &ResultSyncer{
+		script: script,
+		store:  store,
+		synced: make(map[string]syncedFile),
+	}
+}
+
+// Run uploads result files periodically as the script's sync options define
+// until a given context is canceled.
+func (r *ResultSyncer) Run(ctx context.Context) {
+
+	if !r.script.Sync.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(r.script.Sync.period())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := r.Sync(ctx); err != nil && ctx.Err() == nil {
+				r.script.Logger.Println("* Cannot sync result files:", err)
+			} else if n != 0 {
+				r.script.Logger.Printf("Synced %v result files", n)
+			}
+		}
+	}
+
+}
+
+// Sync uploads result files which are new or modified since the last sync and
+// returns the number of uploaded files. If a file is uploaded with another
+// name, e.g. because it is compressed, the previous one is deleted.
+func (r *ResultSyncer) Sync(ctx context.Context) (n int, err error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, file := range r.script.resultFiles() {
+		info, e := os.Stat(file.Path)
+		if e != nil {
+			continue
+		}
+		prev, ok := r.synced[file.Path]
+		if ok && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		name, e := r.script.uploadResult(ctx, r.store, file)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		} else if name == "" {
+			continue
+		}
+		if ok && prev.Name != name {
+			r.store.Delete(ctx, ResultContainer, prev.Name)
+		}
+		r.synced[file.Path] = syncedFile{
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+			Name:    name,
+		}
+		n++
+	}
+	return
+
+}
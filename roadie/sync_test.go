@@ -0,0 +1,174 @@
+//
+// roadie/sync_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jkawamoto/roadie/script"
+)
+
+func TestResultSyncer(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	resultDir := filepath.Join(tmp, "results")
+	if err = os.Mkdir(resultDir, 0755); err != nil {
+		t.Fatalf("cannot create a directory: %v", err)
+	}
+	s := &Script{
+		Script: &script.Script{
+			Name:   "task-abc",
+			Run:    []string{"cmd1", "cmd2"},
+			Upload: []string{"*.ckpt"},
+		},
+		ResultDir: resultDir,
+		Dir:       tmp,
+		Logger:    log.New(ioutil.Discard, "", log.LstdFlags),
+	}
+	store := NewLocalStorage(filepath.Join(tmp, "store"))
+	syncer := NewResultSyncer(s, store)
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatalf("cannot write %v: %v", name, err)
+		}
+	}
+	check := func(expect int) {
+		n, err := syncer.Sync(context.Background())
+		if err != nil {
+			t.Fatalf("Sync returns an error: %v", err)
+		}
+		if n != expect {
+			t.Errorf("Sync uploads %v files, want %v", n, expect)
+		}
+	}
+
+	// Nothing to upload.
+	check(0)
+
+	write(filepath.Join(resultDir, "stdout0.txt"), "step 0")
+	write(filepath.Join(tmp, "epoch-1.ckpt"), "1")
+	check(2)
+	for _, name := range []string{"abc/stdout0.txt", "abc/epoch-1.ckpt"} {
+		if _, err = os.Stat(filepath.Join(tmp, "store", ResultContainer, name)); err != nil {
+			t.Errorf("%v isn't uploaded: %v", name, err)
+		}
+	}
+
+	// Unmodified files aren't uploaded again.
+	check(0)
+
+	write(filepath.Join(resultDir, "stdout0.txt"), "step 0 continues")
+	write(filepath.Join(tmp, "epoch-2.ckpt"), "2")
+	check(2)
+	data, err := ioutil.ReadFile(filepath.Join(tmp, "store", ResultContainer, "abc/stdout0.txt"))
+	if err != nil {
+		t.Fatalf("cannot read the uploaded stdout file: %v", err)
+	}
+	if string(data) != "step 0 continues" {
+		t.Errorf("uploaded stdout file is %q", data)
+	}
+
+}
+
+func TestResultSyncerRun(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	s := &Script{
+		Script: &script.Script{
+			Name: "task-abc",
+			Run:  []string{"cmd1"},
+		},
+		Sync: Sync{
+			OnChange: true,
+		},
+		ResultDir: tmp,
+		Logger:    log.New(ioutil.Discard, "", log.LstdFlags),
+	}
+	if err = ioutil.WriteFile(filepath.Join(tmp, "stdout0.txt"), []byte("abc"), 0644); err != nil {
+		t.Fatalf("cannot write a stdout file: %v", err)
+	}
+
+	defer setDuration(&SyncPollInterval, 10*time.Millisecond)()
+
+	store := NewLocalStorage(filepath.Join(tmp, "store"))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewResultSyncer(s, store).Run(ctx)
+		close(done)
+	}()
+
+	uploaded := filepath.Join(tmp, "store", ResultContainer, "abc", "stdout0.txt")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err = os.Stat(uploaded); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("stdout file isn't synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+}
+
+func TestSyncPeriod(t *testing.T) {
+
+	cases := []struct {
+		sync   Sync
+		expect time.Duration
+	}{
+		{Sync{Interval: time.Hour}, time.Hour},
+		{Sync{Interval: time.Hour, OnChange: true}, SyncPollInterval},
+		{Sync{Interval: time.Second, OnChange: true}, time.Second},
+		{Sync{OnChange: true}, SyncPollInterval},
+	}
+	for _, c := range cases {
+		if !c.sync.Enabled() {
+			t.Errorf("%+v isn't enabled", c.sync)
+		}
+		if res := c.sync.period(); res != c.expect {
+			t.Errorf("period of %+v is %v, want %v", c.sync, res, c.expect)
+		}
+	}
+	if (&Sync{}).Enabled() {
+		t.Error("sync without options is enabled")
+	}
+
+}
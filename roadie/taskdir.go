@@ -0,0 +1,174 @@
+//
+// roadie/taskdir.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+const (
+	// ContainerResultDir defines the path in sandbox containers where stdout
+	// files of run steps are written.
+	ContainerResultDir = "/roadie/results"
+	// ContainerScratchDir defines the path of the scratch directory in sandbox
+	// containers.
+	ContainerScratchDir = "/tmp"
+)
+
+// TaskDir is a private directory of a task; it has a directory for result
+// files and a scratch directory both of which are mounted to the sandbox
+// container.
+type TaskDir struct {
+	// Root is the path to this directory.
+	Root string
+	// ScratchSize is the size limit of the scratch directory in bytes;
+	// if it is positive, a tmpfs is used instead of a directory in Root.
+	ScratchSize int64
+}
+
+// NewTaskDir creates a new task directory for a given named task.
+func NewTaskDir(name string, scratchSize int64) (dir *TaskDir, err error) {
+
+	root, err := ioutil.TempDir("", fmt.Sprintf("roadie-%v-", name))
+	if err != nil {
+		return
+	}
+	dir, err = OpenTaskDir(root, scratchSize)
+	if err != nil {
+		os.RemoveAll(root)
+	}
+	return
+
+}
+
+// OpenTaskDir opens a task directory at a given path and creates it if it
+// doesn't exist; existing files are kept so that an interrupted task can
+// resume.
+func OpenTaskDir(root string, scratchSize int64) (dir *TaskDir, err error) {
+
+	if err = os.MkdirAll(root, 0700); err != nil {
+		return
+	}
+	dir = &TaskDir{
+		Root:        root,
+		ScratchSize: scratchSize,
+	}
+
+	// Those directories must be writable from the sandbox container even if
+	// it doesn't run as root; the root directory is accessible only from the
+	// owner.
+	for _, sub := range []string{dir.ResultDir(), dir.ScratchDir()} {
+		if err = os.MkdirAll(sub, 0755); err != nil {
+			return nil, err
+		}
+		if err = os.Chmod(sub, os.ModeSticky|0777); err != nil {
+			return nil, err
+		}
+	}
+	return
+
+}
+
+// ResultDir returns the path to the directory for result files.
+func (d *TaskDir) ResultDir() string {
+	return filepath.Join(d.Root, "results")
+}
+
+// ScratchDir returns the path to the scratch directory.
+func (d *TaskDir) ScratchDir() string {
+	return filepath.Join(d.Root, "scratch")
+}
+
+// Mounts returns mount points for the sandbox container.
+func (d *TaskDir) Mounts() []mount.Mount {
+
+	scratch := mount.Mount{
+		Type:   mount.TypeBind,
+		Source: d.ScratchDir(),
+		Target: ContainerScratchDir,
+	}
+	if d.ScratchSize > 0 {
+		scratch = mount.Mount{
+			Type:   mount.TypeTmpfs,
+			Target: ContainerScratchDir,
+			TmpfsOptions: &mount.TmpfsOptions{
+				SizeBytes: d.ScratchSize,
+			},
+		}
+	}
+
+	return []mount.Mount{
+		mount.Mount{
+			Type:   mount.TypeBind,
+			Source: d.ResultDir(),
+			Target: ContainerResultDir,
+		},
+		scratch,
+	}
+
+}
+
+// Remove deletes this directory and all files in it.
+func (d *TaskDir) Remove() error {
+	return os.RemoveAll(d.Root)
+}
+
+// ParseSize parses a size such as 512m and 2g; suffixes k, m, and g are
+// supported.
+func ParseSize(size string) (res int64, err error) {
+
+	size = strings.ToLower(strings.TrimSpace(size))
+	if size == "" {
+		return
+	}
+
+	unit := int64(1)
+	switch size[len(size)-1] {
+	case 'k':
+		unit = 1024
+	case 'm':
+		unit = 1024 * 1024
+	case 'g':
+		unit = 1024 * 1024 * 1024
+	}
+	if unit != 1 {
+		size = size[:len(size)-1]
+	}
+
+	res, err = strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return
+	} else if res < 0 {
+		err = fmt.Errorf("Size must not be negative: %v", size)
+		return
+	}
+	res *= unit
+	return
+
+}
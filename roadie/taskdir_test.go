@@ -0,0 +1,141 @@
+//
+// roadie/taskdir_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestTaskDir(t *testing.T) {
+
+	dir, err := NewTaskDir("test", 0)
+	if err != nil {
+		t.Fatalf("NewTaskDir returns an error: %v", err)
+	}
+	defer dir.Remove()
+
+	for _, sub := range []string{dir.ResultDir(), dir.ScratchDir()} {
+		info, err := os.Stat(sub)
+		if err != nil {
+			t.Fatalf("directory %v doesn't exist: %v", sub, err)
+		}
+		if info.Mode().Perm() != 0777 {
+			t.Errorf("permission of %v is %v, want %v", sub, info.Mode().Perm(), os.FileMode(0777))
+		}
+	}
+
+	mounts := dir.Mounts()
+	if len(mounts) != 2 {
+		t.Fatalf("Mounts returns %v mounts, want 2", len(mounts))
+	}
+	if mounts[0].Source != dir.ResultDir() || mounts[0].Target != ContainerResultDir {
+		t.Errorf("result directory is mounted as %v", mounts[0])
+	}
+	if mounts[1].Type != mount.TypeBind || mounts[1].Source != dir.ScratchDir() || mounts[1].Target != ContainerScratchDir {
+		t.Errorf("scratch directory is mounted as %v", mounts[1])
+	}
+
+	dir.ScratchSize = 1024
+	mounts = dir.Mounts()
+	if mounts[1].Type != mount.TypeTmpfs || mounts[1].TmpfsOptions.SizeBytes != 1024 {
+		t.Errorf("scratch directory is mounted as %v, want a tmpfs", mounts[1])
+	}
+
+	err = dir.Remove()
+	if err != nil {
+		t.Fatalf("Remove returns an error: %v", err)
+	}
+	if _, err = os.Stat(dir.Root); !os.IsNotExist(err) {
+		t.Errorf("task directory %v still exists", dir.Root)
+	}
+
+}
+
+func TestOpenTaskDir(t *testing.T) {
+
+	dir, err := NewTaskDir("test", 0)
+	if err != nil {
+		t.Fatalf("NewTaskDir returns an error: %v", err)
+	}
+	defer dir.Remove()
+
+	filename := filepath.Join(dir.ResultDir(), "stdout0.txt")
+	if err = ioutil.WriteFile(filename, []byte("abc"), 0644); err != nil {
+		t.Fatalf("WriteFile returns an error: %v", err)
+	}
+
+	res, err := OpenTaskDir(dir.Root, 0)
+	if err != nil {
+		t.Fatalf("OpenTaskDir returns an error: %v", err)
+	}
+	if res.ResultDir() != dir.ResultDir() {
+		t.Errorf("result directory is %v, want %v", res.ResultDir(), dir.ResultDir())
+	}
+	if _, err = os.Stat(filename); err != nil {
+		t.Errorf("%v is removed: %v", filename, err)
+	}
+
+	// The directory is created again if it was removed.
+	dir.Remove()
+	if res, err = OpenTaskDir(dir.Root, 0); err != nil {
+		t.Fatalf("OpenTaskDir returns an error: %v", err)
+	}
+	if _, err = os.Stat(res.ScratchDir()); err != nil {
+		t.Errorf("scratch directory doesn't exist: %v", err)
+	}
+
+}
+
+func TestParseSize(t *testing.T) {
+
+	cases := []struct {
+		size   string
+		expect int64
+	}{
+		{"", 0},
+		{"100", 100},
+		{"2k", 2048},
+		{"512m", 512 * 1024 * 1024},
+		{"1G", 1024 * 1024 * 1024},
+	}
+	for _, c := range cases {
+		res, err := ParseSize(c.size)
+		if err != nil {
+			t.Fatalf("ParseSize(%q) returns an error: %v", c.size, err)
+		}
+		if res != c.expect {
+			t.Errorf("ParseSize(%q) = %v, want %v", c.size, res, c.expect)
+		}
+	}
+
+	for _, size := range []string{"abc", "-1m"} {
+		if _, err := ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%q) doesn't return any errors", size)
+		}
+	}
+
+}
@@ -0,0 +1,205 @@
+//
+// roadie/token.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/jkawamoto/roadie/cloud/azure"
+)
+
+var (
+	// TokenRefreshMargin defines how long before a token expires it is
+	// refreshed.
+	TokenRefreshMargin = 10 * time.Minute
+	// TokenRetryInterval defines the interval of retries when refreshing a
+	// token fails.
+	TokenRetryInterval = time.Minute
+
+	// newStorageService creates a storage service; tests replace it.
+	newStorageService = azure.NewStorageService
+)
+
+// StorageProvider provides a storage service which has a valid credential.
+// Users should get the storage service every time they access the cloud
+// storage since the credential can be renewed.
+type StorageProvider interface {
+	StorageService() *azure.StorageService
+}
+
+// staticStorage is a StorageProvider which always returns the same storage
+// service.
+type staticStorage struct {
+	store *azure.StorageService
+}
+
+// StaticStorage returns a StorageProvider which always provides a given
+// storage service.
+func StaticStorage(store *azure.StorageService) StorageProvider {
+	return &staticStorage{
+		store: store,
+	}
+}
+
+// StorageService returns the storage service.
+func (s *staticStorage) StorageService() *azure.StorageService {
+	return s.store
+}
+
+// TokenSource is a StorageProvider which authorizes accesses to the cloud
+// storage with a credential. If the authorization is based on a token, it
+// refreshes the token in background before it expires and renews the storage
+// service with the refreshed token.
+type TokenSource struct {
+	ctx    context.Context
+	cred   Credential
+	logger *log.Logger
+
+	mutex   sync.RWMutex
+	cfg     azure.Config
+	store   *azure.StorageService
+	expires bool
+
+	done chan struct{}
+}
+
+// NewTokenSource creates a new token source with a given config and a given
+// credential; the config isn't modified. If the config has a token which
+// doesn't expire soon, it is used until it is going to expire. Refreshing the
+// token stops when the given context is done.
+func NewTokenSource(ctx context.Context, cfg *azure.Config, cred Credential, logger *log.Logger) (s *TokenSource, err error) {
+
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", log.LstdFlags)
+	}
+
+	s = &TokenSource{
+		ctx:     ctx,
+		cred:    cred,
+		logger:  logger,
+		cfg:     *cfg,
+		expires: true,
+		done:    make(chan struct{}),
+	}
+
+	// Authorize with the credential if the token will expire soon or
+	// creating a storage service fails with it.
+	if s.cfg.Token.AccessToken == "" || s.cfg.Token.WillExpireIn(TokenRefreshMargin) {
+		err = s.Refresh()
+	} else if s.store, err = newStorageService(ctx, &s.cfg, logger); err != nil {
+		err = s.Refresh()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go s.run()
+	return
+
+}
+
+// run refreshes the token every time it is going to expire until the context
+// is done.
+func (s *TokenSource) run() {
+
+	defer close(s.done)
+	for {
+		s.mutex.RLock()
+		expires := s.expires
+		s.mutex.RUnlock()
+		if !expires {
+			<-s.ctx.Done()
+			return
+		}
+
+		wait := time.Until(s.Token().Expires().Add(-TokenRefreshMargin))
+		if wait < TokenRetryInterval {
+			// Avoid busy loops when refreshing fails or tokens have short lives.
+			wait = TokenRetryInterval
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if err := s.Refresh(); err != nil {
+			s.logger.Println("Cannot refresh the token:", err)
+		}
+	}
+
+}
+
+// Refresh authorizes with the credential again and renews the storage
+// service.
+func (s *TokenSource) Refresh() (err error) {
+
+	s.mutex.RLock()
+	cfg := s.cfg
+	s.mutex.RUnlock()
+
+	store, token, err := s.cred.Authorize(s.ctx, &cfg, s.logger)
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if token != nil {
+		s.cfg.Token = *token
+	}
+	s.store = store
+	s.expires = token != nil
+	return
+
+}
+
+// Token returns the current token.
+func (s *TokenSource) Token() adal.Token {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.cfg.Token
+}
+
+// Config returns a copy of the config having the current token.
+func (s *TokenSource) Config() azure.Config {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.cfg
+}
+
+// StorageService returns the storage service using the current token.
+func (s *TokenSource) StorageService() *azure.StorageService {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.store
+}
+
+// Wait waits until refreshing the token stops.
+func (s *TokenSource) Wait() {
+	<-s.done
+}
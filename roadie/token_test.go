@@ -0,0 +1,143 @@
+//
+// roadie/token_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/jkawamoto/roadie/cloud/azure"
+)
+
+// newTestToken creates a token which expires after a given duration.
+func newTestToken(access string, d time.Duration) adal.Token {
+	return adal.Token{
+		AccessToken: access,
+		ExpiresOn:   json.Number(fmt.Sprint(time.Now().Add(d).Unix())),
+	}
+}
+
+// testCredential is a credential which issues numbered tokens expiring after
+// twice TokenRefreshMargin.
+type testCredential struct {
+	count int
+}
+
+// Authorize issues a new token and creates a storage service with it.
+func (c *testCredential) Authorize(ctx context.Context, cfg *azure.Config, logger *log.Logger) (store *azure.StorageService, token *adal.Token, err error) {
+
+	c.count++
+	res := newTestToken(fmt.Sprintf("token-%v", c.count), 2*TokenRefreshMargin)
+	authorized := *cfg
+	authorized.Token = res
+	store, err = newStorageService(ctx, &authorized, logger)
+	return store, &res, err
+
+}
+
+func TestTokenSource(t *testing.T) {
+
+	defer setDuration(&TokenRefreshMargin, time.Hour)()
+	defer setDuration(&TokenRetryInterval, 10*time.Millisecond)()
+	factory := newStorageService
+	defer func() {
+		newStorageService = factory
+	}()
+
+	// Each storage service is associated with the token used to create it.
+	var mutex sync.Mutex
+	tokens := make(map[*azure.StorageService]string)
+	newStorageService = func(ctx context.Context, cfg *azure.Config, logger *log.Logger) (*azure.StorageService, error) {
+		if cfg.Token.AccessToken == "invalid" {
+			return nil, fmt.Errorf("invalid token")
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		store := new(azure.StorageService)
+		tokens[store] = cfg.Token.AccessToken
+		return store, nil
+	}
+	refresh := new(testCredential)
+	tokenOf := func(s *TokenSource) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return tokens[s.StorageService()]
+	}
+
+	cases := []struct {
+		name   string
+		token  adal.Token
+		expect string
+	}{
+		{"valid token", newTestToken("valid", 2*TokenRefreshMargin), "valid"},
+		{"token expiring soon", newTestToken("valid", TokenRefreshMargin/2), "token-1"},
+		{"invalid token", newTestToken("invalid", 2*TokenRefreshMargin), "token-1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			refresh.count = 0
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s, err := NewTokenSource(ctx, &azure.Config{Token: c.token}, refresh, nil)
+			if err != nil {
+				t.Fatalf("NewTokenSource returns an error: %v", err)
+			}
+			if res := tokenOf(s); res != c.expect {
+				t.Errorf("storage service uses %q, want %q", res, c.expect)
+			}
+			cancel()
+			s.Wait()
+
+		})
+	}
+
+	// Tokens are refreshed in background before they expire.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refresh.count = 0
+	s, err := NewTokenSource(ctx, &azure.Config{
+		Token: newTestToken("valid", TokenRefreshMargin+time.Second),
+	}, refresh, nil)
+	if err != nil {
+		t.Fatalf("NewTokenSource returns an error: %v", err)
+	}
+	if res := tokenOf(s); res != "valid" {
+		t.Errorf("storage service uses %q, want %q", res, "valid")
+	}
+	time.Sleep(2 * time.Second)
+	if res := tokenOf(s); res != "token-1" {
+		t.Errorf("storage service uses %q, want %q", res, "token-1")
+	}
+	if res := s.Token().AccessToken; res != "token-1" {
+		t.Errorf("current token is %q, want %q", res, "token-1")
+	}
+	cancel()
+	s.Wait()
+
+}
@@ -22,15 +22,25 @@
 package roadie
 
 import (
-	"bufio"
+	"fmt"
+	"io"
 	"log"
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
-// ExecCommand runs a given command forwarding its outputs to a given logger.
-func ExecCommand(cmd *exec.Cmd, logger *log.Logger) (err error) {
+const (
+	// MaxLineLength defines the maximum length of a forwarded output line;
+	// longer lines are truncated.
+	MaxLineLength = 16 * 1024
+)
+
+// ExecCommand runs a given command forwarding its outputs to a given logger;
+// if a given recorder isn't nil, outputs are recorded with their streams
+// instead.
+func ExecCommand(cmd *exec.Cmd, logger *log.Logger, recorder OutputRecorder) (err error) {
 
 	var wg sync.WaitGroup
 
@@ -42,10 +52,9 @@ func ExecCommand(cmd *exec.Cmd, logger *log.Logger) (err error) {
 		go func() {
 			defer wg.Done()
 			defer stdout.Close()
-			scanner := bufio.NewScanner(stdout)
-			for scanner.Scan() {
-				logger.Println(scanner.Text())
-			}
+			scanLines(stdout, func(line string) {
+				logOutput(logger, recorder, time.Time{}, StreamStdout, NoStep, line)
+			})
 		}()
 	}
 
@@ -57,18 +66,138 @@ func ExecCommand(cmd *exec.Cmd, logger *log.Logger) (err error) {
 		go func() {
 			defer wg.Done()
 			defer stderr.Close()
-			scanner := bufio.NewScanner(stderr)
-			for scanner.Scan() {
-				logger.Println(scanner.Text())
-			}
+			scanLines(stderr, func(line string) {
+				logOutput(logger, recorder, time.Time{}, StreamStderr, NoStep, line)
+			})
 		}()
 	}
 
 	err = cmd.Start()
-	if err == nil {
-		err = cmd.Wait()
+	if err != nil {
+		return
 	}
+	// Wait must be called after all outputs are read since it closes the pipes.
 	wg.Wait()
+	return cmd.Wait()
+
+}
+
+// scanLines reads lines from a given reader and calls a given handler with
+// each line. Lines longer than MaxLineLength are truncated with a marker.
+// Progress updates separated by carriage returns, e.g. progress bars, are
+// collapsed into their final states.
+func scanLines(r io.Reader, handler func(line string)) (err error) {
+
+	writer := newLineWriter(false, func(_ time.Time, line string) {
+		handler(line)
+	})
+	_, err = io.Copy(writer, r)
+	writer.Close()
 	return
 
 }
+
+// lineWriter is a writer which splits written data into lines in the same
+// way as scanLines. If timestamps is true, each line is expected to start
+// with a timestamp in RFC3339 format followed by a space, which is given to
+// the handler separately.
+type lineWriter struct {
+	handler    func(t time.Time, line string)
+	timestamps bool
+
+	buf, last         []byte
+	dropped, dropLast int
+	// head is true while reading the timestamp at the beginning of a line.
+	head  bool
+	stamp []byte
+	time  time.Time
+}
+
+// newLineWriter creates a new line writer calling a given handler.
+func newLineWriter(timestamps bool, handler func(t time.Time, line string)) *lineWriter {
+	return &lineWriter{
+		handler:    handler,
+		timestamps: timestamps,
+		head:       timestamps,
+	}
+}
+
+// Write splits given data into lines.
+func (w *lineWriter) Write(p []byte) (int, error) {
+
+	for _, c := range p {
+
+		if w.head {
+			if c != ' ' && c != '\n' && len(w.stamp) < len(time.RFC3339Nano) {
+				w.stamp = append(w.stamp, c)
+				continue
+			}
+			w.head = false
+			if t, err := time.Parse(time.RFC3339Nano, string(w.stamp)); err == nil {
+				w.time = t
+				w.stamp = w.stamp[:0]
+				if c == ' ' {
+					continue
+				}
+			} else {
+				// It isn't a timestamp; treat it as a part of the line.
+				stamp := w.stamp
+				w.stamp = nil
+				w.Write(stamp)
+			}
+		}
+
+		switch c {
+		case '\n':
+			w.emit()
+		case '\r':
+			if len(w.buf) != 0 {
+				w.last = append([]byte(nil), w.buf...)
+				w.dropLast = w.dropped
+			}
+			w.buf, w.dropped = w.buf[:0], 0
+		default:
+			if len(w.buf) < MaxLineLength {
+				w.buf = append(w.buf, c)
+			} else {
+				w.dropped++
+			}
+		}
+
+	}
+	return len(p), nil
+
+}
+
+// Close emits the last line if it doesn't end with a new line.
+func (w *lineWriter) Close() error {
+	if len(w.stamp) != 0 {
+		stamp := w.stamp
+		w.head, w.stamp = false, nil
+		w.Write(stamp)
+	}
+	if len(w.buf) != 0 || w.last != nil {
+		w.emit()
+	}
+	return nil
+}
+
+// emit calls the handler with the current line.
+func (w *lineWriter) emit() {
+
+	if len(w.buf) == 0 && w.last != nil {
+		// The line ends with a carriage return; use the final state.
+		w.buf, w.dropped = w.last, w.dropLast
+	}
+	line := string(w.buf)
+	if w.dropped != 0 {
+		line = fmt.Sprintf("%v... [truncated %v bytes]", line, w.dropped)
+	}
+	w.handler(w.time, line)
+
+	w.buf, w.last = w.buf[:0], nil
+	w.dropped, w.dropLast = 0, 0
+	w.head = w.timestamps
+	w.time = time.Time{}
+
+}
@@ -29,6 +29,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestExecCommand(t *testing.T) {
@@ -37,7 +38,7 @@ func TestExecCommand(t *testing.T) {
 	logger := log.New(&output, "", log.Ltime)
 	cmd := exec.Command("ls")
 
-	err := ExecCommand(cmd, logger)
+	err := ExecCommand(cmd, logger, nil)
 	if err != nil {
 		t.Fatalf("ExecCommand returns an error: %v", err)
 	}
@@ -64,3 +65,71 @@ func TestExecCommand(t *testing.T) {
 	}
 
 }
+
+func TestScanLines(t *testing.T) {
+
+	long := strings.Repeat("a", MaxLineLength+10)
+	cases := []struct {
+		input  string
+		expect []string
+	}{
+		{"abc\ndef\n", []string{"abc", "def"}},
+		{"abc\n\ndef", []string{"abc", "", "def"}},
+		{"abc\r\ndef\r\n", []string{"abc", "def"}},
+		{" 10%\r 50%\r100%\ndone\n", []string{"100%", "done"}},
+		{" 10%\r 50%\r100%\r", []string{"100%"}},
+		{long + "\nabc\n", []string{strings.Repeat("a", MaxLineLength) + "... [truncated 10 bytes]", "abc"}},
+	}
+
+	for _, c := range cases {
+		var res []string
+		err := scanLines(strings.NewReader(c.input), func(line string) {
+			res = append(res, line)
+		})
+		if err != nil {
+			t.Fatalf("scanLines returns an error: %v", err)
+		}
+		if len(res) != len(c.expect) {
+			t.Errorf("scanLines(%.20q) returns %v lines, want %v", c.input, len(res), len(c.expect))
+			continue
+		}
+		for i := range res {
+			if res[i] != c.expect[i] {
+				t.Errorf("line %v is %.40q, want %.40q", i, res[i], c.expect[i])
+			}
+		}
+	}
+
+}
+
+func TestLineWriterTimestamps(t *testing.T) {
+
+	var times []time.Time
+	var lines []string
+	writer := newLineWriter(true, func(stamp time.Time, line string) {
+		times = append(times, stamp)
+		lines = append(lines, line)
+	})
+	for _, chunk := range []string{"2017-10-06T12:00:00.1", "23456789Z abc\n", "no timestamp\n", "2017-10-06T12:00:01Z def"} {
+		writer.Write([]byte(chunk))
+	}
+	writer.Close()
+
+	expects := []struct {
+		time time.Time
+		line string
+	}{
+		{time.Date(2017, 10, 6, 12, 0, 0, 123456789, time.UTC), "abc"},
+		{time.Time{}, "no timestamp"},
+		{time.Date(2017, 10, 6, 12, 0, 1, 0, time.UTC), "def"},
+	}
+	if len(lines) != len(expects) {
+		t.Fatalf("%v lines are written, want %v: %q", len(lines), len(expects), lines)
+	}
+	for i, e := range expects {
+		if !times[i].Equal(e.time) || lines[i] != e.line {
+			t.Errorf("line %v is %v %q, want %v %q", i, times[i], lines[i], e.time, e.line)
+		}
+	}
+
+}
@@ -0,0 +1,218 @@
+//
+// roadie/validate.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Problem is a problem found in a script file.
+type Problem struct {
+	// Line is the line number of the problem; it is zero if unknown.
+	Line int
+	// Field is the name of the field having the problem, e.g. data[1].
+	Field   string
+	Message string
+}
+
+// String returns a message with the line number and the field.
+func (p Problem) String() string {
+
+	if p.Line == 0 {
+		return fmt.Sprintf("%v: %v", p.Field, p.Message)
+	}
+	return fmt.Sprintf("line %v: %v: %v", p.Line, p.Field, p.Message)
+
+}
+
+// ValidateScript checks a given named script file and returns problems found
+// in it; the error is returned only if the file cannot be read.
+func ValidateScript(filename string) (problems []Problem, err error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	lines := scriptLines(strings.Split(string(data), "\n"))
+	report := func(key string, index int, format string, args ...interface{}) {
+		field := key
+		if index >= 0 {
+			field = fmt.Sprintf("%v[%v]", key, index)
+		}
+		problems = append(problems, Problem{
+			Line:    lines.find(key, index),
+			Field:   field,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	s, err := NewScript(filename, log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		// The message of a syntax error has the line number.
+		problems = append(problems, Problem{
+			Field:   "script",
+			Message: err.Error(),
+		})
+		return problems, nil
+	}
+
+	if msg := checkSource(s.Source); msg != "" {
+		report("source", -1, "%v", msg)
+	}
+	for i, v := range s.Data {
+		if msg := checkDataURL(v); msg != "" {
+			report("data", i, "%v", msg)
+		}
+	}
+	if err := s.Matrix.Validate(); err != nil {
+		report("matrix", -1, "%v", err)
+	}
+	if len(s.Run) == 0 {
+		report("run", -1, "no commands are given")
+	}
+	for i, v := range s.Upload {
+		if _, err := filepath.Match(v, ""); err != nil {
+			report("upload", i, "invalid pattern %q: %v", v, err)
+		}
+	}
+	if s.Sync.Interval < 0 {
+		report("sync", -1, "interval must not be negative: %v", s.Sync.Interval)
+	}
+	if _, err := ParseSize(s.ScratchSize); err != nil {
+		report("scratch_size", -1, "%v", err)
+	}
+	if _, err := s.Dockerfile(); err != nil {
+		report("image", -1, "cannot render Dockerfile: %v", err)
+	}
+	if _, err := s.Entrypoint(); err != nil {
+		report("run", -1, "cannot render entrypoint.sh: %v", err)
+	}
+	return
+
+}
+
+// checkSource returns a message if a given source URL isn't supported by
+// PrepareSourceCode.
+func checkSource(source string) string {
+
+	switch {
+	case source == "" || strings.HasSuffix(source, ".git"):
+		return ""
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "dropbox://"):
+		return checkArchive(source)
+	case strings.HasPrefix(source, "file://"):
+		return checkArchive(strings.TrimPrefix(source, "file://"))
+	}
+	return fmt.Sprintf("unsupported source %q; use a git repository, an http(s), dropbox, or file URL", source)
+
+}
+
+// checkDataURL returns a message if a given data URL isn't supported by
+// OpenURL and Expander.
+func checkDataURL(u string) string {
+
+	loc, err := url.Parse(u)
+	if err != nil {
+		return fmt.Sprintf("invalid URL %q: %v", u, err)
+	}
+	switch loc.Scheme {
+	case "http", "https", "dropbox":
+	default:
+		return fmt.Sprintf("unsupported URL %q; use an http(s) or dropbox URL", u)
+	}
+
+	// A destination can follow the path as OpenURL does.
+	name := loc.Path
+	if comps := filepath.SplitList(loc.Path); len(comps) > 1 && !strings.HasSuffix(comps[1], "/") {
+		name = comps[1]
+	} else if len(comps) > 1 {
+		name = comps[0]
+	}
+	return checkArchive(path.Base(name))
+
+}
+
+// checkArchive returns a message if a given file seems an archive but Expander
+// doesn't support it.
+func checkArchive(name string) string {
+
+	switch {
+	case strings.HasSuffix(name, "tar.gz") || strings.HasSuffix(name, "tar.xz") || strings.HasSuffix(name, "zip"):
+		return ""
+	case strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".xz"):
+		return fmt.Sprintf("%v is compressed but not a tarball; only .tar.gz, .tar.xz, and .zip can be expanded", path.Base(name))
+	}
+	return ""
+
+}
+
+// scriptLines is the lines of a script file, which are used to find line
+// numbers of fields.
+type scriptLines []string
+
+// find returns the line number of a given top-level key; if the index isn't
+// negative, it returns the line number of the item of the list. If the key
+// isn't found, it returns zero.
+func (l scriptLines) find(key string, index int) int {
+
+	for i, line := range l {
+		if !strings.HasPrefix(line, key+":") {
+			continue
+		}
+		if index < 0 {
+			return i + 1
+		}
+
+		n := 0
+		indent := -1
+		for j := i + 1; j < len(l); j++ {
+			trimmed := strings.TrimLeft(l[j], " \t")
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			} else if trimmed == l[j] && !strings.HasPrefix(trimmed, "-") {
+				// The next top-level key.
+				break
+			} else if trimmed != "-" && !strings.HasPrefix(trimmed, "- ") {
+				continue
+			}
+			// Items of nested lists are ignored.
+			if indent < 0 {
+				indent = len(l[j]) - len(trimmed)
+			} else if len(l[j])-len(trimmed) != indent {
+				continue
+			}
+			if n == index {
+				return j + 1
+			}
+			n++
+		}
+		return i + 1
+	}
+	return 0
+
+}
@@ -0,0 +1,142 @@
+//
+// roadie/validate_test.go
+//
+// Copyright (c) 2017 Junpei Kawamoto
+//
+// This file is part of Roadie Azure.
+//
+// Roadie Azure is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Roadie Azure is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Roadie Azure. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package roadie
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateScript(t *testing.T) {
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("cannot create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	cases := []struct {
+		script string
+		expect []Problem
+	}{
+		{
+			script: `image: ubuntu
+source: https://example.com/src.tar.gz
+data:
+  - https://example.com/a.zip
+  - https://example.com/b.csv:/data/b.csv
+run:
+  - echo hello
+upload:
+  - "*.txt"
+`,
+		},
+		{
+			script: `source: ftp://example.com/src.tar.gz
+data:
+  - https://example.com/a.tar.gz
+  # comment
+  - https://example.com/b.csv.gz
+  - s3://bucket/c.csv
+upload:
+  - "[.txt"
+`,
+			expect: []Problem{
+				{1, "source", `unsupported source "ftp://example.com/src.tar.gz"; use a git repository, an http(s), dropbox, or file URL`},
+				{5, "data[1]", "b.csv.gz is compressed but not a tarball; only .tar.gz, .tar.xz, and .zip can be expanded"},
+				{6, "data[2]", `unsupported URL "s3://bucket/c.csv"; use an http(s) or dropbox URL`},
+				{0, "run", "no commands are given"},
+				{8, "upload[0]", `invalid pattern "[.txt": syntax error in pattern`},
+			},
+		},
+		{
+			script: `run:
+  - echo hello
+scratch_size: abc
+`,
+			expect: []Problem{
+				{3, "scratch_size", `strconv.ParseInt: parsing "abc": invalid syntax`},
+			},
+		},
+		{
+			script: `run:
+  - echo hello
+sync:
+  interval: -5m
+`,
+			expect: []Problem{
+				{3, "sync", "interval must not be negative: -5m0s"},
+			},
+		},
+	}
+
+	filename := filepath.Join(tmp, "script.yml")
+	for i, c := range cases {
+		if err = ioutil.WriteFile(filename, []byte(c.script), 0644); err != nil {
+			t.Fatalf("cannot write a script file: %v", err)
+		}
+		res, err := ValidateScript(filename)
+		if err != nil {
+			t.Fatalf("ValidateScript returns an error: %v", err)
+		}
+		if !reflect.DeepEqual(res, c.expect) {
+			t.Errorf("case %v: ValidateScript returns %v, want %v", i, res, c.expect)
+		}
+	}
+
+}
+
+func TestScriptLines(t *testing.T) {
+
+	lines := scriptLines([]string{
+		"name: test",
+		"run:",
+		"- a",
+		"- |",
+		"  - not an item",
+		"- b",
+		"upload:",
+		"  - c",
+	})
+	cases := []struct {
+		key    string
+		index  int
+		expect int
+	}{
+		{"name", -1, 1},
+		{"run", 0, 3},
+		{"run", 1, 4},
+		{"run", 2, 6},
+		{"run", 3, 2},
+		{"upload", 0, 8},
+		{"data", -1, 0},
+	}
+	for _, c := range cases {
+		if res := lines.find(c.key, c.index); res != c.expect {
+			t.Errorf("find(%q, %v) = %v, want %v", c.key, c.index, res, c.expect)
+		}
+	}
+
+}